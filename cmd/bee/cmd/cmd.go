@@ -64,6 +64,9 @@ const (
 	optionNameFullNode                   = "full-node"
 	optionNamePostageContractAddress     = "postage-stamp-address"
 	optionNameBlockTime                  = "block-time"
+	optionNameLightNodeLimit             = "light-node-limit"
+	optionNameHandshakeCapabilities      = "handshake-capabilities"
+	optionNameHandshakeProtocolIDs       = "handshake-protocol-ids"
 )
 
 func init() {
@@ -235,6 +238,9 @@ func (c *command) setAllFlags(cmd *cobra.Command) {
 	cmd.Flags().String(optionNamePostageContractAddress, "", "postage stamp contract address")
 	cmd.Flags().String(optionNameTransactionHash, "", "proof-of-identity transaction hash")
 	cmd.Flags().Uint64(optionNameBlockTime, 15, "chain block time")
+	cmd.Flags().StringSlice(optionNameHandshakeCapabilities, nil, "optional features advertised to the peers during handshakes")
+	cmd.Flags().StringSlice(optionNameHandshakeProtocolIDs, nil, "libp2p protocol ids of the handshake in the order of preference, the default one is used if empty")
+	cmd.Flags().Int(optionNameLightNodeLimit, 0, "maximal number of light nodes accepted at the same time, 0 means no limit")
 	cmd.Flags().String(optionNameSwapDeploymentGasPrice, "", "gas price in wei to use for deployment and funding")
 }
 
@@ -154,6 +154,9 @@ Welcome to the Swarm.... Bzzz Bzzzz Bzzzz
 				PostageContractAddress:     c.config.GetString(optionNamePostageContractAddress),
 				BlockTime:                  c.config.GetUint64(optionNameBlockTime),
 				DeployGasPrice:             c.config.GetString(optionNameSwapDeploymentGasPrice),
+				LightNodeLimit:             c.config.GetInt(optionNameLightNodeLimit),
+				HandshakeCapabilities:      c.config.GetStringSlice(optionNameHandshakeCapabilities),
+				HandshakeProtocolIDs:       c.config.GetStringSlice(optionNameHandshakeProtocolIDs),
 			})
 			if err != nil {
 				return err
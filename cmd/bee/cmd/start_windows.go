@@ -37,8 +37,9 @@ func createWindowsEventLogger(svcName string, logger logging.Logger) (logging.Lo
 }
 
 type windowsEventLogger struct {
-	logger logging.Logger
-	winlog debug.Log
+	logger  logging.Logger
+	winlog  debug.Log
+	sampler logging.Sampler
 }
 
 func (l *windowsEventLogger) Tracef(format string, args ...interface{}) {
@@ -96,3 +97,15 @@ func (l *windowsEventLogger) WriterLevel(level logrus.Level) *io.PipeWriter {
 func (l *windowsEventLogger) NewEntry() *logrus.Entry {
 	return l.logger.NewEntry()
 }
+
+func (l *windowsEventLogger) SetLevel(level logrus.Level) {
+	l.logger.SetLevel(level)
+}
+
+func (l *windowsEventLogger) Level() logrus.Level {
+	return l.logger.Level()
+}
+
+func (l *windowsEventLogger) Sampled(key string, every int) logging.Logger {
+	return l.sampler.Sampled(l, key, every)
+}
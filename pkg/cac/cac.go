@@ -1,7 +1,6 @@
 package cac
 
 import (
-	"bytes"
 	"encoding/binary"
 	"errors"
 
@@ -54,7 +53,7 @@ func newWithSpan(data, span []byte) (swarm.Chunk, error) {
 	cdata := make([]byte, len(data)+len(span))
 	copy(cdata[:swarm.SpanSize], span)
 	copy(cdata[swarm.SpanSize:], data)
-	return swarm.NewChunk(swarm.NewAddress(hash), cdata), nil
+	return swarm.NewValidChunk(swarm.NewAddress(hash), cdata)
 }
 
 // hasher is a helper function to hash a given data based on the given span.
@@ -71,18 +70,31 @@ func hasher(data []byte) func([]byte) ([]byte, error) {
 	}
 }
 
-// Valid checks whether the given chunk is a valid content-addressed chunk.
-func Valid(c swarm.Chunk) bool {
-	data := c.Data()
+// ContentAddress returns the binary merkle tree hash of the chunk data, which
+// is expected to start with the span, as it is stored in a content-addressed
+// chunk.
+func ContentAddress(data []byte) (swarm.Address, error) {
 	if len(data) < swarm.SpanSize {
-		return false
+		return swarm.ZeroAddress, errTooShortChunkData
 	}
 
 	if len(data) > swarm.ChunkSize+swarm.SpanSize {
-		return false
+		return swarm.ZeroAddress, errTooLargeChunkData
 	}
 
 	h := hasher(data[swarm.SpanSize:])
-	hash, _ := h(data[:swarm.SpanSize])
-	return bytes.Equal(hash, c.Address().Bytes())
+	hash, err := h(data[:swarm.SpanSize])
+	if err != nil {
+		return swarm.ZeroAddress, err
+	}
+	return swarm.NewAddress(hash), nil
+}
+
+// Valid checks whether the given chunk is a valid content-addressed chunk.
+func Valid(c swarm.Chunk) bool {
+	address, err := ContentAddress(c.Data())
+	if err != nil {
+		return false
+	}
+	return address.Equal(c.Address())
 }
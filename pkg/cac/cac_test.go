@@ -119,6 +119,49 @@ func TestValid(t *testing.T) {
 	}
 }
 
+// TestContentAddress checks that the content address of the chunk data is
+// its binary merkle tree hash.
+func TestContentAddress(t *testing.T) {
+	bmtHashOfFoo := "2387e8e7d8a48c2a9339c97c1dc3461a9a7aa07e994c5cb8b38fd7c1b3e6ea48"
+
+	foo := "foo"
+	fooLength := len(foo)
+	fooBytes := make([]byte, swarm.SpanSize+fooLength)
+	binary.LittleEndian.PutUint64(fooBytes, uint64(fooLength))
+	copy(fooBytes[swarm.SpanSize:], foo)
+
+	address, err := cac.ContentAddress(fooBytes)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := address.String(); got != bmtHashOfFoo {
+		t.Fatalf("got address %s, want %s", got, bmtHashOfFoo)
+	}
+
+	for _, tc := range []struct {
+		name    string
+		data    []byte
+		wantErr error
+	}{
+		{
+			name:    "short data",
+			data:    make([]byte, swarm.SpanSize-1),
+			wantErr: cac.ErrTooShortChunkData,
+		},
+		{
+			name:    "large data",
+			data:    make([]byte, swarm.ChunkSize+swarm.SpanSize+1),
+			wantErr: cac.ErrTooLargeChunkData,
+		},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			if _, err := cac.ContentAddress(tc.data); !errors.Is(err, tc.wantErr) {
+				t.Fatalf("got %v want %v", err, tc.wantErr)
+			}
+		})
+	}
+}
+
 /// TestInvalid checks whether a chunk is not a valid content-addressed chunk
 func TestInvalid(t *testing.T) {
 	// Generates a chunk with the given data. No validation is performed here,
@@ -150,6 +193,11 @@ func TestInvalid(t *testing.T) {
 			address: "0000e8e7d8a48c2a9339c97c1dc3461a9a7aa07e994c5cb8b38fd7c1b3e6ea48",
 			data:    dataWithSpan([]byte("foo")),
 		},
+		{
+			name:    "tampered data",
+			address: "2387e8e7d8a48c2a9339c97c1dc3461a9a7aa07e994c5cb8b38fd7c1b3e6ea48",
+			data:    dataWithSpan([]byte("fop")),
+		},
 		{
 			name:    "empty address",
 			address: "",
@@ -7,13 +7,20 @@ package crypto
 import (
 	"crypto/ecdsa"
 	"crypto/elliptic"
+	"crypto/hmac"
 	"crypto/rand"
+	"crypto/sha512"
 	"encoding/binary"
+	"encoding/hex"
 	"errors"
 	"fmt"
+	"io"
+	"math/big"
+	"strings"
 
 	"github.com/btcsuite/btcd/btcec"
 	"github.com/ethersphere/bee/pkg/swarm"
+	"golang.org/x/crypto/pbkdf2"
 	"golang.org/x/crypto/sha3"
 )
 
@@ -24,6 +31,14 @@ const (
 	AddressSize = 20
 )
 
+var (
+	// ErrEmptyMnemonic is returned if the key is generated from an empty mnemonic.
+	ErrEmptyMnemonic = errors.New("empty mnemonic")
+	// ErrInvalidMnemonicSeed is returned if the seed derived from the mnemonic
+	// does not produce a valid secp256k1 private key.
+	ErrInvalidMnemonicSeed = errors.New("invalid mnemonic seed")
+)
+
 // NewOverlayAddress constructs a Swarm Address from ECDSA public key.
 func NewOverlayAddress(p ecdsa.PublicKey, networkID uint64) (swarm.Address, error) {
 	ethAddr, err := NewEthereumAddress(p)
@@ -44,7 +59,48 @@ func NewOverlayFromEthereumAddress(ethAddr []byte, networkID uint64) swarm.Addre
 // GenerateSecp256k1Key generates an ECDSA private key using
 // secp256k1 elliptic curve.
 func GenerateSecp256k1Key() (*ecdsa.PrivateKey, error) {
-	return ecdsa.GenerateKey(btcec.S256(), rand.Reader)
+	return GenerateSecp256k1KeyFromReader(rand.Reader)
+}
+
+// GenerateSecp256k1KeyFromReader generates an ECDSA private key using
+// secp256k1 elliptic curve from the random bytes read from r. The same
+// bytes always produce the same key, so a seeded reader can be used to
+// get reproducible keys in tests.
+func GenerateSecp256k1KeyFromReader(r io.Reader) (*ecdsa.PrivateKey, error) {
+	b := make([]byte, btcec.PrivKeyBytesLen)
+	for {
+		if _, err := io.ReadFull(r, b); err != nil {
+			return nil, err
+		}
+		// retry with new bytes if they are not a valid scalar
+		if k := new(big.Int).SetBytes(b); k.Sign() != 0 && k.Cmp(btcec.S256().N) < 0 {
+			return DecodeSecp256k1PrivateKey(b)
+		}
+	}
+}
+
+// GenerateSecp256k1KeyFromMnemonic deterministically generates an ECDSA
+// private key using secp256k1 elliptic curve from a BIP-39 mnemonic and
+// passphrase. The key is the BIP-32 master key of the BIP-39 seed. The
+// mnemonic is used as given, without word list validation or normalization.
+func GenerateSecp256k1KeyFromMnemonic(mnemonic, passphrase string) (*ecdsa.PrivateKey, error) {
+	if mnemonic == "" {
+		return nil, ErrEmptyMnemonic
+	}
+
+	seed := pbkdf2.Key([]byte(mnemonic), []byte("mnemonic"+passphrase), 2048, 64, sha512.New)
+
+	mac := hmac.New(sha512.New, []byte("Bitcoin seed"))
+	if _, err := mac.Write(seed); err != nil {
+		return nil, err
+	}
+	key := mac.Sum(nil)[:btcec.PrivKeyBytesLen]
+
+	if k := new(big.Int).SetBytes(key); k.Sign() == 0 || k.Cmp(btcec.S256().N) >= 0 {
+		return nil, ErrInvalidMnemonicSeed
+	}
+
+	return DecodeSecp256k1PrivateKey(key)
 }
 
 // EncodeSecp256k1PrivateKey encodes raw ECDSA private key.
@@ -57,6 +113,54 @@ func EncodeSecp256k1PublicKey(k *ecdsa.PublicKey) []byte {
 	return (*btcec.PublicKey)(k).SerializeCompressed()
 }
 
+// DecodeSecp256k1PublicKey decodes raw ECDSA public key in either the 33-byte
+// compressed or the 65-byte uncompressed format.
+func DecodeSecp256k1PublicKey(data []byte) (*ecdsa.PublicKey, error) {
+	if l := len(data); l != btcec.PubKeyBytesLenCompressed && l != btcec.PubKeyBytesLenUncompressed {
+		return nil, fmt.Errorf("secp256k1 public key data size %d expected %d or %d", l, btcec.PubKeyBytesLenCompressed, btcec.PubKeyBytesLenUncompressed)
+	}
+	pubk, err := btcec.ParsePubKey(data, btcec.S256())
+	if err != nil {
+		return nil, err
+	}
+	return (*ecdsa.PublicKey)(pubk), nil
+}
+
+// EncodeSecp256k1PublicKeyHex encodes raw ECDSA public key in a 33-byte
+// compressed format as a hex string.
+func EncodeSecp256k1PublicKeyHex(k *ecdsa.PublicKey) string {
+	return hex.EncodeToString(EncodeSecp256k1PublicKey(k))
+}
+
+// DecodeSecp256k1PublicKeyHex decodes raw ECDSA public key from a hex string
+// in either the 33-byte compressed or the 65-byte uncompressed format.
+func DecodeSecp256k1PublicKeyHex(s string) (*ecdsa.PublicKey, error) {
+	data, err := hex.DecodeString(s)
+	if err != nil {
+		return nil, fmt.Errorf("decode secp256k1 public key hex: %w", err)
+	}
+	return DecodeSecp256k1PublicKey(data)
+}
+
+// fingerprintSize is the number of bytes of the key hash in a fingerprint.
+const fingerprintSize = 4
+
+// Fingerprint returns a short, stable identifier of the public key for logs
+// and dashboards, the first bytes of the keccak256 hash of the compressed key
+// as colon separated hex, for example "1a:2b:3c:4d". It is not unique enough
+// to be used as a key identity.
+func Fingerprint(pub *ecdsa.PublicKey) string {
+	h := sha3.NewLegacyKeccak256()
+	_, _ = h.Write(EncodeSecp256k1PublicKey(pub))
+	sum := h.Sum(nil)
+
+	groups := make([]string, fingerprintSize)
+	for i := range groups {
+		groups[i] = hex.EncodeToString(sum[i : i+1])
+	}
+	return strings.Join(groups, ":")
+}
+
 // DecodeSecp256k1PrivateKey decodes raw ECDSA private key.
 func DecodeSecp256k1PrivateKey(data []byte) (*ecdsa.PrivateKey, error) {
 	if l := len(data); l != btcec.PrivKeyBytesLen {
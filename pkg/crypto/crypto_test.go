@@ -6,7 +6,12 @@ package crypto_test
 
 import (
 	"bytes"
+	"crypto/elliptic"
 	"encoding/hex"
+	"errors"
+	"io"
+	"math/rand"
+	"strings"
 	"testing"
 
 	"github.com/ethersphere/bee/pkg/crypto"
@@ -33,6 +38,87 @@ func TestGenerateSecp256k1Key(t *testing.T) {
 	}
 }
 
+func TestGenerateSecp256k1KeyFromReader(t *testing.T) {
+	k1, err := crypto.GenerateSecp256k1KeyFromReader(rand.New(rand.NewSource(1)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	k2, err := crypto.GenerateSecp256k1KeyFromReader(rand.New(rand.NewSource(1)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(crypto.EncodeSecp256k1PrivateKey(k1), crypto.EncodeSecp256k1PrivateKey(k2)) {
+		t.Fatal("keys generated from the same seed are not equal")
+	}
+	if !k1.Curve.IsOnCurve(k1.X, k1.Y) {
+		t.Fatal("public key is not on the curve")
+	}
+
+	k3, err := crypto.GenerateSecp256k1KeyFromReader(rand.New(rand.NewSource(2)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if bytes.Equal(crypto.EncodeSecp256k1PrivateKey(k1), crypto.EncodeSecp256k1PrivateKey(k3)) {
+		t.Fatal("keys generated from different seeds are equal")
+	}
+
+	t.Run("invalid scalar", func(t *testing.T) {
+		// bytes greater than the curve order are skipped
+		key := bytes.Repeat([]byte{1}, 32)
+		r := bytes.NewReader(append(bytes.Repeat([]byte{0xff}, 32), key...))
+		k, err := crypto.GenerateSecp256k1KeyFromReader(r)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got := crypto.EncodeSecp256k1PrivateKey(k); !bytes.Equal(got, key) {
+			t.Fatalf("got key %x, want %x", got, key)
+		}
+	})
+
+	t.Run("short reader", func(t *testing.T) {
+		_, err := crypto.GenerateSecp256k1KeyFromReader(bytes.NewReader(make([]byte, 31)))
+		if !errors.Is(err, io.ErrUnexpectedEOF) {
+			t.Fatalf("got error %v, want %v", err, io.ErrUnexpectedEOF)
+		}
+	})
+}
+
+func TestGenerateSecp256k1KeyFromMnemonic(t *testing.T) {
+	// BIP-39 test vector with the BIP-32 master key of its seed
+	mnemonic := "abandon abandon abandon abandon abandon abandon abandon abandon abandon abandon abandon about"
+	passphrase := "TREZOR"
+	expectKeyHex := "cbedc75b0d6412c85c79bc13875112ef912fd1e756631b5a00330866f22ff184"
+	expectAddressHex := "d7fdc6389223c747de571b22c2860b6b1ce9643a"
+
+	k, err := crypto.GenerateSecp256k1KeyFromMnemonic(mnemonic, passphrase)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := hex.EncodeToString(crypto.EncodeSecp256k1PrivateKey(k)); got != expectKeyHex {
+		t.Fatalf("key mismatch %s %s", got, expectKeyHex)
+	}
+
+	address, err := crypto.NewEthereumAddress(k.PublicKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := hex.EncodeToString(address); got != expectAddressHex {
+		t.Fatalf("address mismatch %s %s", got, expectAddressHex)
+	}
+
+	k2, err := crypto.GenerateSecp256k1KeyFromMnemonic(mnemonic, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if k2.Equal(k) {
+		t.Fatal("keys generated with different passphrases are equal")
+	}
+
+	if _, err := crypto.GenerateSecp256k1KeyFromMnemonic("", passphrase); !errors.Is(err, crypto.ErrEmptyMnemonic) {
+		t.Fatalf("got error %v, want %v", err, crypto.ErrEmptyMnemonic)
+	}
+}
+
 func TestNewAddress(t *testing.T) {
 	k, err := crypto.GenerateSecp256k1Key()
 	if err != nil {
@@ -62,44 +148,184 @@ func TestEncodeSecp256k1PrivateKey(t *testing.T) {
 	}
 }
 
-func TestSecp256k1PrivateKeyFromBytes(t *testing.T) {
-	data := []byte("data")
+func TestDecodeSecp256k1PublicKey(t *testing.T) {
+	k, err := crypto.GenerateSecp256k1Key()
+	if err != nil {
+		t.Fatal(err)
+	}
+	want, err := crypto.NewEthereumAddress(k.PublicKey)
+	if err != nil {
+		t.Fatal(err)
+	}
 
-	k1 := crypto.Secp256k1PrivateKeyFromBytes(data)
-	if k1 == nil {
-		t.Fatal("nil key")
+	for _, tc := range []struct {
+		name string
+		data []byte
+	}{
+		{
+			name: "compressed",
+			data: crypto.EncodeSecp256k1PublicKey(&k.PublicKey),
+		},
+		{
+			name: "uncompressed",
+			data: elliptic.Marshal(k.Curve, k.X, k.Y),
+		},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			pub, err := crypto.DecodeSecp256k1PublicKey(tc.data)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if pub.X.Cmp(k.X) != 0 || pub.Y.Cmp(k.Y) != 0 {
+				t.Fatal("encoded and decoded keys are not equal")
+			}
+			got, err := crypto.NewEthereumAddress(*pub)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !bytes.Equal(got, want) {
+				t.Fatalf("got address %x, want %x", got, want)
+			}
+		})
 	}
 
-	k2 := crypto.Secp256k1PrivateKeyFromBytes(data)
-	if k2 == nil {
-		t.Fatal("nil key")
+	t.Run("invalid length", func(t *testing.T) {
+		if _, err := crypto.DecodeSecp256k1PublicKey(make([]byte, 32)); err == nil {
+			t.Fatal("expected error")
+		}
+	})
+}
+
+func TestSecp256k1PublicKeyHex(t *testing.T) {
+	k, err := crypto.GenerateSecp256k1Key()
+	if err != nil {
+		t.Fatal(err)
 	}
 
-	if !bytes.Equal(k1.D.Bytes(), k2.D.Bytes()) {
-		t.Fatal("two generated keys are not equal")
+	s := crypto.EncodeSecp256k1PublicKeyHex(&k.PublicKey)
+	if want := hex.EncodeToString(crypto.EncodeSecp256k1PublicKey(&k.PublicKey)); s != want {
+		t.Fatalf("got %s, want %s", s, want)
 	}
-}
 
-func TestNewEthereumAddress(t *testing.T) {
-	privKeyHex := "2c26b46b68ffc68ff99b453c1d30413413422d706483bfa0f98a5e886266e7ae"
-	privKeyBytes, err := hex.DecodeString(privKeyHex)
+	pub, err := crypto.DecodeSecp256k1PublicKeyHex(s)
 	if err != nil {
 		t.Fatal(err)
 	}
-	privKey, err := crypto.DecodeSecp256k1PrivateKey(privKeyBytes)
+	if pub.X.Cmp(k.X) != 0 || pub.Y.Cmp(k.Y) != 0 {
+		t.Fatal("encoded and decoded keys are not equal")
+	}
+
+	for _, tc := range []struct {
+		name string
+		s    string
+	}{
+		{
+			name: "invalid hex",
+			s:    "0x" + s,
+		},
+		{
+			name: "odd length",
+			s:    s[1:],
+		},
+		{
+			name: "invalid length",
+			s:    s[:len(s)-2],
+		},
+		{
+			name: "not on curve",
+			s:    "02" + strings.Repeat("00", 32),
+		},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			if _, err := crypto.DecodeSecp256k1PublicKeyHex(tc.s); err == nil {
+				t.Fatal("expected error")
+			}
+		})
+	}
+}
+
+func TestFingerprint(t *testing.T) {
+	// the key of the owner 8d3766440f0d7b949a5e32995d09619a7f86e632 in the
+	// single-owner chunk tests
+	data, err := hex.DecodeString("634fb5a872396d9693e5c9f9d7233cfa93f395c093371017ff44aa9ae6564cdd")
 	if err != nil {
 		t.Fatal(err)
 	}
-	expectAddressHex := "2f63cbeb054ce76050827e42dd75268f6b9d87c5"
-	expectAddress, err := hex.DecodeString(expectAddressHex)
+	privKey, err := crypto.DecodeSecp256k1PrivateKey(data)
 	if err != nil {
 		t.Fatal(err)
 	}
-	address, err := crypto.NewEthereumAddress(privKey.PublicKey)
+
+	want := "68:08:82:c9"
+	if got := crypto.Fingerprint(&privKey.PublicKey); got != want {
+		t.Fatalf("got fingerprint %s, want %s", got, want)
+	}
+
+	other, err := crypto.GenerateSecp256k1Key()
 	if err != nil {
 		t.Fatal(err)
 	}
-	if !bytes.Equal(address, expectAddress) {
-		t.Fatalf("address mismatch %x %x", address, expectAddress)
+	if got := crypto.Fingerprint(&other.PublicKey); got == want {
+		t.Fatalf("got the same fingerprint %s for another key", got)
+	}
+}
+
+func TestSecp256k1PrivateKeyFromBytes(t *testing.T) {
+	data := []byte("data")
+
+	k1 := crypto.Secp256k1PrivateKeyFromBytes(data)
+	if k1 == nil {
+		t.Fatal("nil key")
+	}
+
+	k2 := crypto.Secp256k1PrivateKeyFromBytes(data)
+	if k2 == nil {
+		t.Fatal("nil key")
+	}
+
+	if !bytes.Equal(k1.D.Bytes(), k2.D.Bytes()) {
+		t.Fatal("two generated keys are not equal")
+	}
+}
+
+func TestNewEthereumAddress(t *testing.T) {
+	for _, tc := range []struct {
+		name          string
+		privKeyHex    string
+		expectAddress string
+	}{
+		{
+			name:          "key",
+			privKeyHex:    "2c26b46b68ffc68ff99b453c1d30413413422d706483bfa0f98a5e886266e7ae",
+			expectAddress: "2f63cbeb054ce76050827e42dd75268f6b9d87c5",
+		},
+		{
+			// the key used in TestDefaultSignerDeterministic
+			name:          "deterministic signer key",
+			privKeyHex:    "634fb5a872396d9693e5c9f9d7233cfa93f395c093371017ff44aa9ae6564cdd",
+			expectAddress: "8d3766440f0d7b949a5e32995d09619a7f86e632",
+		},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			privKeyBytes, err := hex.DecodeString(tc.privKeyHex)
+			if err != nil {
+				t.Fatal(err)
+			}
+			privKey, err := crypto.DecodeSecp256k1PrivateKey(privKeyBytes)
+			if err != nil {
+				t.Fatal(err)
+			}
+			expectAddress, err := hex.DecodeString(tc.expectAddress)
+			if err != nil {
+				t.Fatal(err)
+			}
+			address, err := crypto.NewEthereumAddress(privKey.PublicKey)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !bytes.Equal(address, expectAddress) {
+				t.Fatalf("address mismatch %x %x", address, expectAddress)
+			}
+		})
 	}
 }
@@ -9,6 +9,9 @@ import (
 	"errors"
 )
 
+// ErrInvalidPublicKey is returned if the public key is not on the curve of the private key.
+var ErrInvalidPublicKey = errors.New("invalid public key")
+
 // DH is an interface allowing to generate shared keys for public key
 // using a salt from a known private key
 // TODO: implement clef support beside in-memory
@@ -26,11 +29,13 @@ func NewDH(key *ecdsa.PrivateKey) DH {
 }
 
 // SharedKey creates ECDH shared secret using the in-memory key as private key and the given public key
-// and hashes it with the salt to return the shared key
-// safety warning: this method is not meant to be exposed as it does not validate private and public keys
-// are  on the same curve
+// and hashes it with the salt to return the shared key.
+// It returns ErrInvalidPublicKey if the public key is not a point on the curve of the private key.
 func (dh *defaultDH) SharedKey(pub *ecdsa.PublicKey, salt []byte) ([]byte, error) {
-	x, _ := pub.Curve.ScalarMult(pub.X, pub.Y, dh.key.D.Bytes())
+	if pub == nil || pub.X == nil || pub.Y == nil || !dh.key.Curve.IsOnCurve(pub.X, pub.Y) {
+		return nil, ErrInvalidPublicKey
+	}
+	x, _ := dh.key.Curve.ScalarMult(pub.X, pub.Y, dh.key.D.Bytes())
 	if x == nil {
 		return nil, errors.New("shared secret is point at infinity")
 	}
@@ -9,7 +9,9 @@ import (
 	"crypto/ecdsa"
 	"crypto/rand"
 	"encoding/hex"
+	"errors"
 	"io"
+	"math/big"
 	"testing"
 
 	"github.com/btcsuite/btcd/btcec"
@@ -88,3 +90,21 @@ func TestSharedKey(t *testing.T) {
 	}
 
 }
+
+func TestSharedKeyInvalidPublicKey(t *testing.T) {
+	key, err := crypto.GenerateSecp256k1Key()
+	if err != nil {
+		t.Fatal(err)
+	}
+	dh := crypto.NewDH(key)
+
+	// a point which is not on the secp256k1 curve
+	pub := &ecdsa.PublicKey{
+		Curve: btcec.S256(),
+		X:     new(big.Int).Add(key.X, big.NewInt(1)),
+		Y:     key.Y,
+	}
+	if _, err := dh.SharedKey(pub, nil); !errors.Is(err, crypto.ErrInvalidPublicKey) {
+		t.Fatalf("got error %v, want %v", err, crypto.ErrInvalidPublicKey)
+	}
+}
@@ -0,0 +1,63 @@
+// Copyright 2021 The Swarm Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package crypto
+
+import (
+	"bytes"
+	"encoding/binary"
+)
+
+// SignMessage signs the message for authentication between peers. The
+// signature is detached and it can be verified with VerifyMessage.
+func SignMessage(signer Signer, msg []byte) ([]byte, error) {
+	return SignDomainMessage(signer, nil, msg)
+}
+
+// VerifyMessage checks if the signature of the message, created by
+// SignMessage, is signed by the expected owner, the ethereum address in
+// bytes. An error is returned only if the signature is malformed.
+func VerifyMessage(expectedOwner, msg, sig []byte) (bool, error) {
+	return VerifyDomainMessage(expectedOwner, nil, msg, sig)
+}
+
+// SignDomainMessage signs the message in the domain, so that the signature
+// is not valid for the same message in another domain, for example in
+// another protocol.
+func SignDomainMessage(signer Signer, domain, msg []byte) ([]byte, error) {
+	digest, err := messageDigest(domain, msg)
+	if err != nil {
+		return nil, err
+	}
+	return signer.Sign(digest)
+}
+
+// VerifyDomainMessage checks if the signature of the message in the domain,
+// created by SignDomainMessage, is signed by the expected owner.
+func VerifyDomainMessage(expectedOwner, domain, msg, sig []byte) (bool, error) {
+	digest, err := messageDigest(domain, msg)
+	if err != nil {
+		return false, err
+	}
+	pub, err := Recover(sig, digest)
+	if err != nil {
+		return false, err
+	}
+	owner, err := NewEthereumAddress(*pub)
+	if err != nil {
+		return false, err
+	}
+	return bytes.Equal(owner, expectedOwner), nil
+}
+
+// messageDigest returns the keccak256 hash of the message prefixed with the
+// length of the domain and the domain, so that the boundary between the
+// domain and the message is unambiguous.
+func messageDigest(domain, msg []byte) ([]byte, error) {
+	data := make([]byte, 8, 8+len(domain)+len(msg))
+	binary.BigEndian.PutUint64(data, uint64(len(domain)))
+	data = append(data, domain...)
+	data = append(data, msg...)
+	return LegacyKeccak256(data)
+}
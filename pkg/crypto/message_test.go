@@ -0,0 +1,108 @@
+// Copyright 2021 The Swarm Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package crypto_test
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/ethersphere/bee/pkg/crypto"
+)
+
+func TestSignMessage(t *testing.T) {
+	privKey, err := crypto.GenerateSecp256k1Key()
+	if err != nil {
+		t.Fatal(err)
+	}
+	signer := crypto.NewDefaultSigner(privKey)
+	owner, err := crypto.NewEthereumAddress(privKey.PublicKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	otherPrivKey, err := crypto.GenerateSecp256k1Key()
+	if err != nil {
+		t.Fatal(err)
+	}
+	otherOwner, err := crypto.NewEthereumAddress(otherPrivKey.PublicKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	msg := []byte("hello peer")
+	sig, err := crypto.SignMessage(signer, msg)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	t.Run("valid", func(t *testing.T) {
+		ok, err := crypto.VerifyMessage(owner, msg, sig)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !ok {
+			t.Fatal("valid signature not verified")
+		}
+	})
+
+	t.Run("tampered message", func(t *testing.T) {
+		ok, err := crypto.VerifyMessage(owner, []byte("hello peeR"), sig)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if ok {
+			t.Fatal("signature of tampered message verified")
+		}
+	})
+
+	t.Run("wrong owner", func(t *testing.T) {
+		ok, err := crypto.VerifyMessage(otherOwner, msg, sig)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if ok {
+			t.Fatal("signature verified for wrong owner")
+		}
+	})
+
+	t.Run("malformed signature", func(t *testing.T) {
+		if _, err := crypto.VerifyMessage(owner, msg, sig[:64]); !errors.Is(err, crypto.ErrInvalidLength) {
+			t.Fatalf("got error %v, want %v", err, crypto.ErrInvalidLength)
+		}
+	})
+
+	t.Run("domain", func(t *testing.T) {
+		domain := []byte("pingpong")
+		domainSig, err := crypto.SignDomainMessage(signer, domain, msg)
+		if err != nil {
+			t.Fatal(err)
+		}
+		ok, err := crypto.VerifyDomainMessage(owner, domain, msg, domainSig)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !ok {
+			t.Fatal("valid domain signature not verified")
+		}
+
+		for _, tc := range []struct {
+			name   string
+			domain []byte
+			msg    []byte
+		}{
+			{name: "no domain", msg: msg},
+			{name: "other domain", domain: []byte("hive"), msg: msg},
+			// the boundary between the domain and the message is signed
+			{name: "shifted boundary", domain: []byte("ping"), msg: append([]byte("pong"), msg...)},
+		} {
+			ok, err := crypto.VerifyDomainMessage(owner, tc.domain, tc.msg, domainSig)
+			if err != nil {
+				t.Fatalf("%s: %v", tc.name, err)
+			}
+			if ok {
+				t.Fatalf("%s: domain signature verified", tc.name)
+			}
+		}
+	})
+}
@@ -6,9 +6,11 @@ package crypto
 
 import (
 	"crypto/ecdsa"
+	"crypto/elliptic"
 	"errors"
 	"fmt"
 	"math/big"
+	"sync"
 
 	"github.com/btcsuite/btcd/btcec"
 	"github.com/ethereum/go-ethereum/common"
@@ -18,8 +20,23 @@ import (
 
 var (
 	ErrInvalidLength = errors.New("invalid signature length")
+	// ErrBadRecoveryID is returned if the recovery id of the signature is not valid.
+	ErrBadRecoveryID = errors.New("invalid signature recovery id")
+	// ErrNotSupported is returned if the signer does not support the operation.
+	ErrNotSupported = errors.New("operation not supported by signer")
+	// ErrInvalidSignature is returned if the signature is not created by
+	// the expected key.
+	ErrInvalidSignature = errors.New("invalid signature")
+	// ErrHighSSignature is returned if the S value of the signature is in
+	// the upper half of the curve order. Only the low S form is accepted, as
+	// otherwise a second valid signature could be derived from any signature.
+	ErrHighSSignature = errors.New("signature with high S value")
 )
 
+// secp256k1HalfN is the half of the secp256k1 curve order, the highest S
+// value of a signature in the low S form.
+var secp256k1HalfN = new(big.Int).Rsh(btcec.S256().N, 1)
+
 type Signer interface {
 	// Sign signs data with ethereum prefix (eip191 type 0x45).
 	Sign(data []byte) ([]byte, error)
@@ -49,6 +66,12 @@ func Recover(signature, data []byte) (*ecdsa.PublicKey, error) {
 	if len(signature) != 65 {
 		return nil, ErrInvalidLength
 	}
+	if !validRecoveryID(signature[64]) {
+		return nil, ErrBadRecoveryID
+	}
+	if isHighS(signature) {
+		return nil, ErrHighSSignature
+	}
 	// Convert to btcec input format with 'recovery id' v at the beginning.
 	btcsig := make([]byte, 65)
 	btcsig[0] = signature[64]
@@ -63,10 +86,81 @@ func Recover(signature, data []byte) (*ecdsa.PublicKey, error) {
 	return (*ecdsa.PublicKey)(p), err
 }
 
+// isHighS checks if the S value of the [R || S || V] signature is not in the
+// low S form.
+func isHighS(signature []byte) bool {
+	return new(big.Int).SetBytes(signature[32:64]).Cmp(secp256k1HalfN) > 0
+}
+
+// validRecoveryID checks if v is a recovery id accepted by
+// `btcec.RecoverCompact`, 27 to 34 inclusive.
+func validRecoveryID(v byte) bool {
+	return v >= 27 && v <= 34
+}
+
+// EthereumSigner signs digests without any prefix, producing signatures
+// that can be verified with the ethereum ecrecover precompile.
+type EthereumSigner struct {
+	signer *defaultSigner
+}
+
+// NewEthereumSigner creates a new EthereumSigner with the key.
+func NewEthereumSigner(key *ecdsa.PrivateKey) *EthereumSigner {
+	return &EthereumSigner{
+		signer: &defaultSigner{key: key},
+	}
+}
+
+// Sign signs the digest and returns the signature in the ethereum
+// [R || S || V] format, where v is 27 or 28.
+func (e *EthereumSigner) Sign(digest []byte) ([]byte, error) {
+	if len(digest) != 32 {
+		return nil, fmt.Errorf("invalid digest length %d", len(digest))
+	}
+	return e.signer.sign(digest, false)
+}
+
+// VerifyEthereum verifies that the ethereum [R || S || V] signature of the
+// digest is created by the key of pub. Both 0/1 and 27/28 recovery ids are
+// accepted. ErrInvalidSignature is returned if the signature is valid but
+// created by a different key.
+func VerifyEthereum(pub *ecdsa.PublicKey, digest, signature []byte) error {
+	if len(signature) != 65 {
+		return ErrInvalidLength
+	}
+	v := signature[64]
+	if v < 27 {
+		v += 27
+	}
+	if v != 27 && v != 28 {
+		return ErrBadRecoveryID
+	}
+	if isHighS(signature) {
+		return ErrHighSSignature
+	}
+	// Convert to btcec input format with 'recovery id' v at the beginning.
+	btcsig := make([]byte, 65)
+	btcsig[0] = v
+	copy(btcsig[1:], signature)
+
+	p, _, err := btcec.RecoverCompact(btcec.S256(), btcsig, digest)
+	if err != nil {
+		return err
+	}
+	if p.X.Cmp(pub.X) != 0 || p.Y.Cmp(pub.Y) != 0 {
+		return ErrInvalidSignature
+	}
+	return nil
+}
+
 type defaultSigner struct {
 	key *ecdsa.PrivateKey
 }
 
+// NewDefaultSigner creates a Signer which signs with the private key. The
+// signer does not modify the key and keeps no other state, so it is safe for
+// concurrent use as long as the key is not modified by the caller. The public
+// key returned by it is shared and must not be modified either.
 func NewDefaultSigner(key *ecdsa.PrivateKey) Signer {
 	return &defaultSigner{
 		key: key,
@@ -134,6 +228,7 @@ func (d *defaultSigner) SignTypedData(typedData *eip712.TypedData) ([]byte, erro
 }
 
 // sign the provided hash and convert it to the ethereum (r,s,v) format.
+// The signature is in the low S form.
 func (d *defaultSigner) sign(sighash []byte, isCompressedKey bool) ([]byte, error) {
 	signature, err := btcec.SignCompact(btcec.S256(), (*btcec.PrivateKey)(d.key), sighash, false)
 	if err != nil {
@@ -147,11 +242,140 @@ func (d *defaultSigner) sign(sighash []byte, isCompressedKey bool) ([]byte, erro
 	return signature, nil
 }
 
+type signerFunc struct {
+	sign      func(data []byte) ([]byte, error)
+	publicKey func() (*ecdsa.PublicKey, error)
+}
+
+// NewSignerFunc creates a Signer from the provided functions, allowing
+// signing with keys that are not available locally, like on hardware
+// wallets or remote key management services. The sign function is
+// expected to sign data with ethereum prefix (eip191 type 0x45). Signing
+// transactions and typed data is not supported by the returned Signer.
+func NewSignerFunc(sign func(data []byte) ([]byte, error), publicKey func() (*ecdsa.PublicKey, error)) Signer {
+	return &signerFunc{
+		sign:      sign,
+		publicKey: publicKey,
+	}
+}
+
+// Sign signs data with the provided sign function.
+func (s *signerFunc) Sign(data []byte) ([]byte, error) {
+	return s.sign(data)
+}
+
+// SignTx is not supported and returns ErrNotSupported.
+func (s *signerFunc) SignTx(transaction *types.Transaction, chainID *big.Int) (*types.Transaction, error) {
+	return nil, ErrNotSupported
+}
+
+// SignTypedData is not supported and returns ErrNotSupported.
+func (s *signerFunc) SignTypedData(typedData *eip712.TypedData) ([]byte, error) {
+	return nil, ErrNotSupported
+}
+
+// PublicKey returns the public key from the provided public key function.
+func (s *signerFunc) PublicKey() (*ecdsa.PublicKey, error) {
+	return s.publicKey()
+}
+
+// EthereumAddress returns the ethereum address derived from the public key.
+func (s *signerFunc) EthereumAddress() (common.Address, error) {
+	publicKey, err := s.PublicKey()
+	if err != nil {
+		return common.Address{}, err
+	}
+	eth, err := NewEthereumAddress(*publicKey)
+	if err != nil {
+		return common.Address{}, err
+	}
+	var ethAddress common.Address
+	copy(ethAddress[:], eth)
+	return ethAddress, nil
+}
+
+// CachingSigner is a Signer which keeps its public key and derives the
+// ethereum address and the encodings of the public key only once. It is safe
+// for concurrent use.
+type CachingSigner struct {
+	Signer
+	publicKey    *ecdsa.PublicKey
+	once         sync.Once
+	ethAddress   common.Address
+	compressed   []byte
+	uncompressed []byte
+	err          error
+}
+
+// NewCachingSigner creates a new CachingSigner with the key.
+func NewCachingSigner(key *ecdsa.PrivateKey) *CachingSigner {
+	return newCachingSigner(NewDefaultSigner(key), &key.PublicKey)
+}
+
+// newCachingSigner creates a new CachingSigner which signs with the signer of
+// the key with the public key.
+func newCachingSigner(signer Signer, publicKey *ecdsa.PublicKey) *CachingSigner {
+	return &CachingSigner{
+		Signer:    signer,
+		publicKey: publicKey,
+	}
+}
+
+// init derives the cached values on the first call.
+func (c *CachingSigner) init() error {
+	c.once.Do(func() {
+		eth, err := NewEthereumAddress(*c.publicKey)
+		if err != nil {
+			c.err = err
+			return
+		}
+		copy(c.ethAddress[:], eth)
+		c.compressed = EncodeSecp256k1PublicKey(c.publicKey)
+		c.uncompressed = elliptic.Marshal(btcec.S256(), c.publicKey.X, c.publicKey.Y)
+	})
+	return c.err
+}
+
+// PublicKey returns the public key this signer uses, which is kept since the
+// signer was created.
+func (c *CachingSigner) PublicKey() (*ecdsa.PublicKey, error) {
+	return c.publicKey, nil
+}
+
+// EthereumAddress returns the cached ethereum address this signer uses.
+func (c *CachingSigner) EthereumAddress() (common.Address, error) {
+	if err := c.init(); err != nil {
+		return common.Address{}, err
+	}
+	return c.ethAddress, nil
+}
+
+// CompressedPublicKey returns the cached 33-byte compressed encoding of the
+// public key. The returned slice must not be modified.
+func (c *CachingSigner) CompressedPublicKey() ([]byte, error) {
+	if err := c.init(); err != nil {
+		return nil, err
+	}
+	return c.compressed, nil
+}
+
+// UncompressedPublicKey returns the cached 65-byte uncompressed encoding of
+// the public key. The returned slice must not be modified.
+func (c *CachingSigner) UncompressedPublicKey() ([]byte, error) {
+	if err := c.init(); err != nil {
+		return nil, err
+	}
+	return c.uncompressed, nil
+}
+
 // RecoverEIP712 recovers the public key for eip712 signed data.
 func RecoverEIP712(signature []byte, data *eip712.TypedData) (*ecdsa.PublicKey, error) {
 	if len(signature) != 65 {
 		return nil, errors.New("invalid length")
 	}
+	if isHighS(signature) {
+		return nil, ErrHighSSignature
+	}
 	// Convert to btcec input format with 'recovery id' v at the beginning.
 	btcsig := make([]byte, 65)
 	btcsig[0] = signature[64]
@@ -6,11 +6,16 @@ package crypto_test
 
 import (
 	"bytes"
+	"crypto/ecdsa"
+	"crypto/elliptic"
 	"encoding/hex"
 	"errors"
 	"math/big"
+	"sync"
+	"sync/atomic"
 	"testing"
 
+	"github.com/btcsuite/btcd/btcec"
 	"github.com/ethereum/go-ethereum/common"
 	"github.com/ethereum/go-ethereum/common/math"
 	"github.com/ethereum/go-ethereum/core/types"
@@ -62,6 +67,17 @@ func TestDefaultSigner(t *testing.T) {
 			t.Fatalf("expected invalid length error but got %v", err)
 		}
 	})
+
+	t.Run("OK - recover with bad recovery id", func(t *testing.T) {
+		badSignature := make([]byte, len(signature))
+		copy(badSignature, signature)
+		badSignature[64] = 0
+
+		_, err := crypto.Recover(badSignature, testBytes)
+		if !errors.Is(err, crypto.ErrBadRecoveryID) {
+			t.Fatalf("expected bad recovery id error but got %v", err)
+		}
+	})
 }
 
 func TestDefaultSignerEthereumAddress(t *testing.T) {
@@ -214,6 +230,146 @@ func TestRecoverEIP712(t *testing.T) {
 	}
 }
 
+// TestDefaultSignerTypedDataSpec signs the example from the EIP-712
+// specification and checks it against the signature from the specification,
+// which is also the one produced by wallets like MetaMask.
+func TestDefaultSignerTypedDataSpec(t *testing.T) {
+	// the private key is keccak256("cow")
+	data, err := hex.DecodeString("c85ef7d79691fe79573b1a7064c19c1a9819ebdbd1faaab1a8ec92344438aaf4")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	privKey, err := crypto.DecodeSecp256k1PrivateKey(data)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	typedData := &eip712.TypedData{
+		Domain: eip712.TypedDataDomain{
+			Name:              "Ether Mail",
+			Version:           "1",
+			ChainId:           math.NewHexOrDecimal256(1),
+			VerifyingContract: "0xCcCCccccCCCCcCCCCCCcCcCccCcCCCcCcccccccC",
+		},
+		Types: eip712.Types{
+			"EIP712Domain": {
+				{Name: "name", Type: "string"},
+				{Name: "version", Type: "string"},
+				{Name: "chainId", Type: "uint256"},
+				{Name: "verifyingContract", Type: "address"},
+			},
+			"Person": {
+				{Name: "name", Type: "string"},
+				{Name: "wallet", Type: "address"},
+			},
+			"Mail": {
+				{Name: "from", Type: "Person"},
+				{Name: "to", Type: "Person"},
+				{Name: "contents", Type: "string"},
+			},
+		},
+		Message: eip712.TypedDataMessage{
+			"from": map[string]interface{}{
+				"name":   "Cow",
+				"wallet": "0xCD2a3d9F938E13CD947Ec05AbC7FE734Df8DD826",
+			},
+			"to": map[string]interface{}{
+				"name":   "Bob",
+				"wallet": "0xbBbBBBBbbBBBbbbBbbBbbbbBBbBbbbbBbBbbBBbB",
+			},
+			"contents": "Hello, Bob!",
+		},
+		PrimaryType: "Mail",
+	}
+
+	rawData, err := eip712.EncodeForSigning(typedData)
+	if err != nil {
+		t.Fatal(err)
+	}
+	sighash, err := crypto.LegacyKeccak256(rawData)
+	if err != nil {
+		t.Fatal(err)
+	}
+	expectedHash, err := hex.DecodeString("be609aee343fb3c4b28e1df9e632fca64fcfaede20f02e86244efddf30957bd2")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(expectedHash, sighash) {
+		t.Fatalf("wrong hash. expected %x, got %x", expectedHash, sighash)
+	}
+
+	sig, err := crypto.NewDefaultSigner(privKey).SignTypedData(typedData)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	expected, err := hex.DecodeString("4355c47d63924e8a72e509b65029052eb6c299d53a04e167c5775fd466751c9d07299936d304c153f6443dfa05f40ff007d72911b6f72307f996231605b915621c")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if !bytes.Equal(expected, sig) {
+		t.Fatalf("wrong signature. expected %x, got %x", expected, sig)
+	}
+}
+
+func TestSignerFunc(t *testing.T) {
+	privKey, err := crypto.GenerateSecp256k1Key()
+	if err != nil {
+		t.Fatal(err)
+	}
+	remote := crypto.NewDefaultSigner(privKey)
+	signer := crypto.NewSignerFunc(remote.Sign, remote.PublicKey)
+
+	t.Run("OK - sign & recover", func(t *testing.T) {
+		testBytes := []byte("test string")
+		signature, err := signer.Sign(testBytes)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		pubKey, err := crypto.Recover(signature, testBytes)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if pubKey.X.Cmp(privKey.PublicKey.X) != 0 || pubKey.Y.Cmp(privKey.PublicKey.Y) != 0 {
+			t.Fatalf("wanted %v but got %v", &privKey.PublicKey, pubKey)
+		}
+	})
+
+	t.Run("OK - ethereum address", func(t *testing.T) {
+		got, err := signer.EthereumAddress()
+		if err != nil {
+			t.Fatal(err)
+		}
+		want, err := remote.EthereumAddress()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got != want {
+			t.Fatalf("wanted %v but got %v", want, got)
+		}
+	})
+
+	t.Run("FAIL - public key error", func(t *testing.T) {
+		errPublicKey := errors.New("public key not available")
+		signer := crypto.NewSignerFunc(remote.Sign, func() (*ecdsa.PublicKey, error) {
+			return nil, errPublicKey
+		})
+		if _, err := signer.EthereumAddress(); !errors.Is(err, errPublicKey) {
+			t.Fatalf("got error %v, want %v", err, errPublicKey)
+		}
+	})
+
+	t.Run("FAIL - sign typed data", func(t *testing.T) {
+		if _, err := signer.SignTypedData(&eip712.TypedData{}); !errors.Is(err, crypto.ErrNotSupported) {
+			t.Fatalf("got error %v, want %v", err, crypto.ErrNotSupported)
+		}
+	})
+}
+
 func TestDefaultSignerDeterministic(t *testing.T) {
 	data, err := hex.DecodeString("634fb5a872396d9693e5c9f9d7233cfa93f395c093371017ff44aa9ae6564cdd")
 	if err != nil {
@@ -243,3 +399,341 @@ func TestDefaultSignerDeterministic(t *testing.T) {
 		t.Fatal("signature mismatch")
 	}
 }
+
+func TestDefaultSignerConcurrent(t *testing.T) {
+	privKey, err := crypto.GenerateSecp256k1Key()
+	if err != nil {
+		t.Fatal(err)
+	}
+	signer := crypto.NewDefaultSigner(privKey)
+	digest := []byte("concurrent")
+
+	const goroutines = 50
+	sigs := make([][]byte, goroutines)
+	errs := make([]error, goroutines)
+	var wg sync.WaitGroup
+	for i := 0; i < goroutines; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			sig, err := signer.Sign(digest)
+			if err != nil {
+				errs[i] = err
+				return
+			}
+			if _, err := signer.PublicKey(); err != nil {
+				errs[i] = err
+				return
+			}
+			pub, err := crypto.Recover(sig, digest)
+			if err != nil {
+				errs[i] = err
+				return
+			}
+			if !pub.Equal(&privKey.PublicKey) {
+				errs[i] = errors.New("recovered public key mismatch")
+				return
+			}
+			sigs[i] = sig
+		}(i)
+	}
+	wg.Wait()
+
+	for i, err := range errs {
+		if err != nil {
+			t.Fatalf("goroutine %d: %v", i, err)
+		}
+	}
+	for i, sig := range sigs {
+		if !bytes.Equal(sig, sigs[0]) {
+			t.Fatalf("goroutine %d: signature mismatch", i)
+		}
+	}
+}
+
+func TestEthereumSigner(t *testing.T) {
+	// key and digest are taken from the go-ethereum crypto tests,
+	// the digest is keccak256("foo") and signing is deterministic (rfc6979)
+	data, err := hex.DecodeString("289c2857d4598e37fb9647507e47a309d6133539bf21a8b9cb6df88fd5232032")
+	if err != nil {
+		t.Fatal(err)
+	}
+	privKey, err := crypto.DecodeSecp256k1PrivateKey(data)
+	if err != nil {
+		t.Fatal(err)
+	}
+	digest, err := crypto.LegacyKeccak256([]byte("foo"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	sig, err := crypto.NewEthereumSigner(privKey).Sign(digest)
+	if err != nil {
+		t.Fatal(err)
+	}
+	expSig, err := hex.DecodeString("d155e94305af7e07dd8c32873e5c03cb95c9e05960ef85be9c07f671da58c73718c19adc397a211aa9e87e519e2038c5a3b658618db335f74f800b8e0cfeef441c")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(expSig, sig) {
+		t.Fatalf("got signature %x, want %x", sig, expSig)
+	}
+
+	if err := crypto.VerifyEthereum(&privKey.PublicKey, digest, sig); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := crypto.NewEthereumSigner(privKey).Sign(digest[1:]); err == nil {
+		t.Fatal("expected error for short digest")
+	}
+}
+
+func TestVerifyEthereum(t *testing.T) {
+	// reference vector from the go-ethereum crypto signature tests
+	digest, err := hex.DecodeString("ce0677bb30baa8cf067c88db9811f4333d131bf8bcf12fe7065d211dce971008")
+	if err != nil {
+		t.Fatal(err)
+	}
+	sig, err := hex.DecodeString("90f27b8b488db00b00606796d2987f6a5f59ae62ea05effe84fef5b8b0e549984a691139ad57a3f0b906637673aa2f63d1f55cb1a69199d4009eea23ceaddc9301")
+	if err != nil {
+		t.Fatal(err)
+	}
+	pubBytes, err := hex.DecodeString("04e32df42865e97135acfb65f3bae71bdc86f4d49150ad6a440b6f15878109880a0a2b2667f7e725ceea70c673093bf67663e0312623c8e091b13cf2c0f11ef652")
+	if err != nil {
+		t.Fatal(err)
+	}
+	pub, err := crypto.DecodeSecp256k1PublicKey(pubBytes)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	t.Run("recovery id 0/1", func(t *testing.T) {
+		if err := crypto.VerifyEthereum(pub, digest, sig); err != nil {
+			t.Fatal(err)
+		}
+	})
+
+	t.Run("recovery id 27/28", func(t *testing.T) {
+		s := append([]byte(nil), sig...)
+		s[64] += 27
+		if err := crypto.VerifyEthereum(pub, digest, s); err != nil {
+			t.Fatal(err)
+		}
+	})
+
+	t.Run("bad recovery id", func(t *testing.T) {
+		s := append([]byte(nil), sig...)
+		s[64] = 2
+		if err := crypto.VerifyEthereum(pub, digest, s); !errors.Is(err, crypto.ErrBadRecoveryID) {
+			t.Fatalf("got error %v, want %v", err, crypto.ErrBadRecoveryID)
+		}
+	})
+
+	t.Run("invalid length", func(t *testing.T) {
+		if err := crypto.VerifyEthereum(pub, digest, sig[:64]); !errors.Is(err, crypto.ErrInvalidLength) {
+			t.Fatalf("got error %v, want %v", err, crypto.ErrInvalidLength)
+		}
+	})
+
+	t.Run("other key", func(t *testing.T) {
+		privKey, err := crypto.GenerateSecp256k1Key()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err := crypto.VerifyEthereum(&privKey.PublicKey, digest, sig); !errors.Is(err, crypto.ErrInvalidSignature) {
+			t.Fatalf("got error %v, want %v", err, crypto.ErrInvalidSignature)
+		}
+	})
+}
+
+func TestHighSSignature(t *testing.T) {
+	privKey, err := crypto.GenerateSecp256k1Key()
+	if err != nil {
+		t.Fatal(err)
+	}
+	halfN := new(big.Int).Rsh(btcec.S256().N, 1)
+
+	// malleate returns the other valid signature of the same data, with S
+	// replaced by N-S and the parity of the recovery id flipped.
+	malleate := func(t *testing.T, sig []byte) []byte {
+		t.Helper()
+
+		s := new(big.Int).SetBytes(sig[32:64])
+		if s.Cmp(halfN) > 0 {
+			t.Fatal("signature is not in the low S form")
+		}
+		m := append([]byte(nil), sig...)
+		new(big.Int).Sub(btcec.S256().N, s).FillBytes(m[32:64])
+		m[64] = 27 + ((m[64] - 27) ^ 1)
+		return m
+	}
+
+	t.Run("recover", func(t *testing.T) {
+		data := []byte("data")
+		sig, err := crypto.NewDefaultSigner(privKey).Sign(data)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if _, err := crypto.Recover(malleate(t, sig), data); !errors.Is(err, crypto.ErrHighSSignature) {
+			t.Fatalf("got error %v, want %v", err, crypto.ErrHighSSignature)
+		}
+	})
+
+	t.Run("verify ethereum", func(t *testing.T) {
+		digest, err := crypto.LegacyKeccak256([]byte("data"))
+		if err != nil {
+			t.Fatal(err)
+		}
+		sig, err := crypto.NewEthereumSigner(privKey).Sign(digest)
+		if err != nil {
+			t.Fatal(err)
+		}
+		high := malleate(t, sig)
+
+		// the high S signature is valid for the key if it is not rejected
+		btcsig := append([]byte{high[64]}, high[:64]...)
+		pub, _, err := btcec.RecoverCompact(btcec.S256(), btcsig, digest)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !pub.ToECDSA().Equal(&privKey.PublicKey) {
+			t.Fatal("malleated signature recovers another key")
+		}
+
+		if err := crypto.VerifyEthereum(&privKey.PublicKey, digest, high); !errors.Is(err, crypto.ErrHighSSignature) {
+			t.Fatalf("got error %v, want %v", err, crypto.ErrHighSSignature)
+		}
+	})
+}
+
+func TestCachingSigner(t *testing.T) {
+	privKey, err := crypto.GenerateSecp256k1Key()
+	if err != nil {
+		t.Fatal(err)
+	}
+	signer := crypto.NewCachingSigner(privKey)
+
+	wantAddress, err := crypto.NewDefaultSigner(privKey).EthereumAddress()
+	if err != nil {
+		t.Fatal(err)
+	}
+	wantUncompressed := elliptic.Marshal(privKey.Curve, privKey.X, privKey.Y)
+
+	var wg sync.WaitGroup
+	for i := 0; i < 10; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			address, err := signer.EthereumAddress()
+			if err != nil {
+				t.Error(err)
+				return
+			}
+			if address != wantAddress {
+				t.Errorf("got address %x, want %x", address, wantAddress)
+			}
+		}()
+	}
+	wg.Wait()
+
+	compressed, err := signer.CompressedPublicKey()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := crypto.EncodeSecp256k1PublicKey(&privKey.PublicKey); !bytes.Equal(compressed, want) {
+		t.Fatalf("got compressed public key %x, want %x", compressed, want)
+	}
+	uncompressed, err := signer.UncompressedPublicKey()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(uncompressed, wantUncompressed) {
+		t.Fatalf("got uncompressed public key %x, want %x", uncompressed, wantUncompressed)
+	}
+
+	// signing is done by the wrapped default signer
+	sig, err := signer.Sign([]byte("foo"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	pubKey, err := crypto.Recover(sig, []byte("foo"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !pubKey.Equal(&privKey.PublicKey) {
+		t.Fatal("recovered public key mismatch")
+	}
+}
+
+// countingSigner counts the calls to the methods which return the public key
+// or values derived from it.
+type countingSigner struct {
+	crypto.Signer
+	publicKeyCalls       int32
+	ethereumAddressCalls int32
+	signCalls            int32
+}
+
+func (c *countingSigner) PublicKey() (*ecdsa.PublicKey, error) {
+	atomic.AddInt32(&c.publicKeyCalls, 1)
+	return c.Signer.PublicKey()
+}
+
+func (c *countingSigner) EthereumAddress() (common.Address, error) {
+	atomic.AddInt32(&c.ethereumAddressCalls, 1)
+	return c.Signer.EthereumAddress()
+}
+
+func (c *countingSigner) Sign(data []byte) ([]byte, error) {
+	atomic.AddInt32(&c.signCalls, 1)
+	return c.Signer.Sign(data)
+}
+
+func TestCachingSignerMemoizes(t *testing.T) {
+	privKey, err := crypto.GenerateSecp256k1Key()
+	if err != nil {
+		t.Fatal(err)
+	}
+	inner := &countingSigner{Signer: crypto.NewDefaultSigner(privKey)}
+	signer := crypto.NewCachingSignerWithSigner(inner, &privKey.PublicKey)
+
+	var wg sync.WaitGroup
+	for i := 0; i < 10; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			publicKey, err := signer.PublicKey()
+			if err != nil {
+				t.Error(err)
+				return
+			}
+			if !publicKey.Equal(&privKey.PublicKey) {
+				t.Error("public key mismatch")
+			}
+			if _, err := signer.EthereumAddress(); err != nil {
+				t.Error(err)
+			}
+			if _, err := signer.CompressedPublicKey(); err != nil {
+				t.Error(err)
+			}
+			if _, err := signer.UncompressedPublicKey(); err != nil {
+				t.Error(err)
+			}
+		}()
+	}
+	wg.Wait()
+
+	if got := atomic.LoadInt32(&inner.publicKeyCalls); got != 0 {
+		t.Fatalf("got %d public key calls to the inner signer, want 0", got)
+	}
+	if got := atomic.LoadInt32(&inner.ethereumAddressCalls); got != 0 {
+		t.Fatalf("got %d ethereum address calls to the inner signer, want 0", got)
+	}
+
+	if _, err := signer.Sign([]byte("foo")); err != nil {
+		t.Fatal(err)
+	}
+	if got := atomic.LoadInt32(&inner.signCalls); got != 1 {
+		t.Fatalf("got %d sign calls to the inner signer, want 1", got)
+	}
+}
@@ -5,10 +5,15 @@
 package encryption
 
 import (
+	"errors"
+
 	"github.com/ethersphere/bee/pkg/swarm"
 	"golang.org/x/crypto/sha3"
 )
 
+// ErrShortChunkData is returned if the chunk data is shorter than the span.
+var ErrShortChunkData = errors.New("encryption: chunk data shorter than span")
+
 // ChunkEncrypter encrypts chunk data.
 type ChunkEncrypter interface {
 	EncryptChunk([]byte) (key Key, encryptedSpan, encryptedData []byte, err error)
@@ -20,15 +25,46 @@ func NewChunkEncrypter() ChunkEncrypter { return &chunkEncrypter{} }
 
 func (c *chunkEncrypter) EncryptChunk(chunkData []byte) (Key, []byte, []byte, error) {
 	key := GenerateRandomKey(KeyLength)
-	encryptedSpan, err := newSpanEncryption(key).Encrypt(chunkData[:8])
+	encrypted, err := EncryptChunkData(chunkData, key)
 	if err != nil {
 		return nil, nil, nil, err
 	}
-	encryptedData, err := newDataEncryption(key).Encrypt(chunkData[8:])
+	return key, encrypted[:swarm.SpanSize], encrypted[swarm.SpanSize:], nil
+}
+
+// EncryptChunkData encrypts the span and the payload of the chunk data with
+// the key. The span and the payload are encrypted separately in counter mode,
+// with the payload padded to the chunk size.
+func EncryptChunkData(chunkData []byte, key Key) ([]byte, error) {
+	if len(chunkData) < swarm.SpanSize {
+		return nil, ErrShortChunkData
+	}
+	encryptedSpan, err := newSpanEncryption(key).Encrypt(chunkData[:swarm.SpanSize])
 	if err != nil {
-		return nil, nil, nil, err
+		return nil, err
+	}
+	encryptedData, err := newDataEncryption(key).Encrypt(chunkData[swarm.SpanSize:])
+	if err != nil {
+		return nil, err
+	}
+	return append(encryptedSpan, encryptedData...), nil
+}
+
+// DecryptChunkData decrypts the chunk data encrypted by EncryptChunkData with
+// the key. The returned payload includes the padding.
+func DecryptChunkData(chunkData []byte, key Key) ([]byte, error) {
+	if len(chunkData) < swarm.SpanSize {
+		return nil, ErrShortChunkData
+	}
+	decryptedSpan, err := newSpanEncryption(key).Decrypt(chunkData[:swarm.SpanSize])
+	if err != nil {
+		return nil, err
+	}
+	decryptedData, err := newDataEncryption(key).Decrypt(chunkData[swarm.SpanSize:])
+	if err != nil {
+		return nil, err
 	}
-	return key, encryptedSpan, encryptedData, nil
+	return append(decryptedSpan, decryptedData...), nil
 }
 
 func newSpanEncryption(key Key) Interface {
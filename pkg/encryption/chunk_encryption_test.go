@@ -0,0 +1,83 @@
+// Copyright 2021 The Swarm Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package encryption_test
+
+import (
+	"bytes"
+	"encoding/binary"
+	"encoding/hex"
+	"errors"
+	"testing"
+
+	"github.com/ethersphere/bee/pkg/encryption"
+	"github.com/ethersphere/bee/pkg/swarm"
+)
+
+func TestEncryptChunkData(t *testing.T) {
+	data := make([]byte, swarm.SpanSize+swarm.ChunkSize)
+	binary.LittleEndian.PutUint64(data, swarm.ChunkSize)
+
+	encrypted, err := encryption.EncryptChunkData(data, testKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	expectedSpan, _ := hex.DecodeString("d898af592a01fb02")
+	if !bytes.Equal(encrypted[:swarm.SpanSize], expectedSpan) {
+		t.Fatalf("got encrypted span %x, want %x", encrypted[:swarm.SpanSize], expectedSpan)
+	}
+	// the payload is encrypted with the same parameters as in
+	// TestEncryptDataLengthEqualsPadding
+	expectedData, _ := hex.DecodeString(expectedTransformedHex)
+	if !bytes.Equal(encrypted[swarm.SpanSize:], expectedData) {
+		t.Fatalf("got encrypted data %x, want %x", encrypted[swarm.SpanSize:], expectedData)
+	}
+}
+
+func TestEncryptDecryptChunkData(t *testing.T) {
+	payload := []byte("foo")
+	data := make([]byte, swarm.SpanSize+len(payload))
+	binary.LittleEndian.PutUint64(data, uint64(len(payload)))
+	copy(data[swarm.SpanSize:], payload)
+
+	key := encryption.GenerateRandomKey(encryption.KeyLength)
+	encrypted, err := encryption.EncryptChunkData(data, key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(encrypted) != swarm.SpanSize+swarm.ChunkSize {
+		t.Fatalf("got encrypted length %d, want %d", len(encrypted), swarm.SpanSize+swarm.ChunkSize)
+	}
+
+	t.Run("correct key", func(t *testing.T) {
+		decrypted, err := encryption.DecryptChunkData(encrypted, key)
+		if err != nil {
+			t.Fatal(err)
+		}
+		// the padding is not removed
+		if got := decrypted[:len(data)]; !bytes.Equal(got, data) {
+			t.Fatalf("got decrypted %x, want %x", got, data)
+		}
+	})
+
+	t.Run("wrong key", func(t *testing.T) {
+		decrypted, err := encryption.DecryptChunkData(encrypted, encryption.GenerateRandomKey(encryption.KeyLength))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got := decrypted[:len(data)]; bytes.Equal(got, data) {
+			t.Fatal("decrypted with a wrong key to the plaintext")
+		}
+	})
+
+	t.Run("short data", func(t *testing.T) {
+		if _, err := encryption.EncryptChunkData(data[:swarm.SpanSize-1], key); !errors.Is(err, encryption.ErrShortChunkData) {
+			t.Fatalf("got error %v, want %v", err, encryption.ErrShortChunkData)
+		}
+		if _, err := encryption.DecryptChunkData(encrypted[:swarm.SpanSize-1], key); !errors.Is(err, encryption.ErrShortChunkData) {
+			t.Fatalf("got error %v, want %v", err, encryption.ErrShortChunkData)
+		}
+	})
+}
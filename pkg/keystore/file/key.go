@@ -61,7 +61,9 @@ type kdfParams struct {
 	Salt  string `json:"salt"`
 }
 
-func encryptKey(k *ecdsa.PrivateKey, password string) ([]byte, error) {
+// EncryptKey encrypts the private key with the password using scrypt and
+// AES-CTR and returns it in the Ethereum JSON v3 key file format.
+func EncryptKey(k *ecdsa.PrivateKey, password string) ([]byte, error) {
 	data := crypto.EncodeSecp256k1PrivateKey(k)
 	kc, err := encryptData(data, []byte(password))
 	if err != nil {
@@ -78,7 +80,9 @@ func encryptKey(k *ecdsa.PrivateKey, password string) ([]byte, error) {
 	})
 }
 
-func decryptKey(data []byte, password string) (*ecdsa.PrivateKey, error) {
+// DecryptKey decrypts the private key from the Ethereum JSON v3 key file
+// format. It returns keystore.ErrInvalidPassword if the password is wrong.
+func DecryptKey(data []byte, password string) (*ecdsa.PrivateKey, error) {
 	var k encryptedKey
 	if err := json.Unmarshal(data, &k); err != nil {
 		return nil, err
@@ -0,0 +1,38 @@
+// Copyright 2021 The Swarm Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package file_test
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/ethersphere/bee/pkg/crypto"
+	"github.com/ethersphere/bee/pkg/keystore"
+	"github.com/ethersphere/bee/pkg/keystore/file"
+)
+
+func TestEncryptDecryptKey(t *testing.T) {
+	k, err := crypto.GenerateSecp256k1Key()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	data, err := file.EncryptKey(k, "pass123456")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	got, err := file.DecryptKey(data, "pass123456")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !got.Equal(k) {
+		t.Fatal("decrypted key does not match the original one")
+	}
+
+	if _, err := file.DecryptKey(data, "invalid password"); !errors.Is(err, keystore.ErrInvalidPassword) {
+		t.Fatalf("got error %v, want %v", err, keystore.ErrInvalidPassword)
+	}
+}
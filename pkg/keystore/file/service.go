@@ -55,7 +55,7 @@ func (s *Service) Key(name, password string) (pk *ecdsa.PrivateKey, created bool
 			return nil, false, fmt.Errorf("generate secp256k1 key: %w", err)
 		}
 
-		d, err := encryptKey(pk, password)
+		d, err := EncryptKey(pk, password)
 		if err != nil {
 			return nil, false, err
 		}
@@ -69,7 +69,7 @@ func (s *Service) Key(name, password string) (pk *ecdsa.PrivateKey, created bool
 		return pk, true, nil
 	}
 
-	pk, err = decryptKey(data, password)
+	pk, err = DecryptKey(data, password)
 	if err != nil {
 		return nil, false, err
 	}
@@ -0,0 +1,41 @@
+// Copyright 2021 The Swarm Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package logging
+
+import (
+	"context"
+
+	"github.com/sirupsen/logrus"
+)
+
+// TraceIDField is the key in log message fields that holds the trace ID set
+// with NewContext.
+const TraceIDField = "traceid"
+
+// traceIDContextKey is used to reference a trace ID as context value.
+type traceIDContextKey struct{}
+
+// NewContext returns a new context with the trace ID which is added to log
+// entries created with WithContext.
+func NewContext(ctx context.Context, id string) context.Context {
+	return context.WithValue(ctx, traceIDContextKey{}, id)
+}
+
+// TraceIDFromContext returns the trace ID set with NewContext. If it is not
+// present in the context, an empty string is returned.
+func TraceIDFromContext(ctx context.Context) string {
+	id, _ := ctx.Value(traceIDContextKey{}).(string)
+	return id
+}
+
+// WithContext creates a new log entry with the TraceIDField field added if the
+// trace ID is present in the context.
+func WithContext(ctx context.Context, l Logger) *logrus.Entry {
+	id := TraceIDFromContext(ctx)
+	if id == "" {
+		return l.NewEntry()
+	}
+	return l.WithField(TraceIDField, id)
+}
@@ -27,20 +27,38 @@ type Logger interface {
 	WithFields(fields logrus.Fields) *logrus.Entry
 	WriterLevel(logrus.Level) *io.PipeWriter
 	NewEntry() *logrus.Entry
+	SetLevel(level logrus.Level)
+	Level() logrus.Level
+	// Sampled returns a logger which logs only the first and then every
+	// n-th message logged with the key, to avoid flooding the log with
+	// repeated messages. See Sampler.Sampled.
+	Sampled(key string, every int) Logger
 }
 
 type logger struct {
 	*logrus.Logger
 	metrics metrics
+	sampler Sampler
 }
 
 func New(w io.Writer, level logrus.Level) Logger {
+	return newLogger(w, level, &logrus.TextFormatter{
+		FullTimestamp: true,
+	})
+}
+
+// NewJSON returns a logger that writes one JSON object per line, with the
+// time, level, msg and structured fields as keys, suitable for ingestion by
+// log aggregators.
+func NewJSON(w io.Writer, level logrus.Level) Logger {
+	return newLogger(w, level, &logrus.JSONFormatter{})
+}
+
+func newLogger(w io.Writer, level logrus.Level, formatter logrus.Formatter) Logger {
 	l := logrus.New()
 	l.SetOutput(w)
 	l.SetLevel(level)
-	l.Formatter = &logrus.TextFormatter{
-		FullTimestamp: true,
-	}
+	l.Formatter = formatter
 	metrics := newMetrics()
 	l.AddHook(metrics)
 	return &logger{
@@ -52,3 +70,15 @@ func New(w io.Writer, level logrus.Level) Logger {
 func (l *logger) NewEntry() *logrus.Entry {
 	return logrus.NewEntry(l.Logger)
 }
+
+// Sampled returns a logger which logs only the first and then every n-th
+// message logged with the key.
+func (l *logger) Sampled(key string, every int) Logger {
+	return l.sampler.Sampled(l, key, every)
+}
+
+// Level returns the current logging level. The level can be changed at
+// runtime with SetLevel.
+func (l *logger) Level() logrus.Level {
+	return l.GetLevel()
+}
@@ -0,0 +1,223 @@
+// Copyright 2021 The Swarm Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package logging_test
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/ethersphere/bee/pkg/logging"
+	"github.com/sirupsen/logrus"
+)
+
+func TestWithFields(t *testing.T) {
+	var buf bytes.Buffer
+	logger := logging.New(&buf, logrus.InfoLevel)
+
+	logger.WithFields(logrus.Fields{
+		"peer":       "ca1e9f39",
+		"network_id": 1,
+		"error":      "network ID mismatch",
+	}).Info("handshake failed")
+
+	got := buf.String()
+	for _, want := range []string{
+		`msg="handshake failed"`,
+		"peer=ca1e9f39",
+		"network_id=1",
+		`error="network ID mismatch"`,
+	} {
+		if !strings.Contains(got, want) {
+			t.Errorf("log output %q does not contain %q", got, want)
+		}
+	}
+}
+
+func TestNewJSON(t *testing.T) {
+	var buf bytes.Buffer
+	logger := logging.NewJSON(&buf, logrus.InfoLevel)
+
+	logger.WithFields(logrus.Fields{
+		"peer":       "ca1e9f39",
+		"network_id": 1,
+	}).Info("handshake failed")
+	logger.Warning("second line")
+
+	lines := strings.Split(strings.TrimSuffix(buf.String(), "\n"), "\n")
+	if len(lines) != 2 {
+		t.Fatalf("got %d lines, want 2: %q", len(lines), buf.String())
+	}
+
+	var entry map[string]interface{}
+	if err := json.Unmarshal([]byte(lines[0]), &entry); err != nil {
+		t.Fatal(err)
+	}
+	for key, want := range map[string]interface{}{
+		"level":      "info",
+		"msg":        "handshake failed",
+		"peer":       "ca1e9f39",
+		"network_id": float64(1),
+	} {
+		if got := entry[key]; got != want {
+			t.Errorf("got %s %v, want %v", key, got, want)
+		}
+	}
+	ts, ok := entry["time"].(string)
+	if !ok {
+		t.Fatalf("got time %v, want string", entry["time"])
+	}
+	if _, err := time.Parse(time.RFC3339, ts); err != nil {
+		t.Errorf("parse time: %v", err)
+	}
+}
+
+func TestWithContext(t *testing.T) {
+	t.Run("with trace id", func(t *testing.T) {
+		var buf bytes.Buffer
+		logger := logging.New(&buf, logrus.InfoLevel)
+
+		ctx := logging.NewContext(context.Background(), "1f2e3d")
+		logging.WithContext(ctx, logger).Info("chunk validated")
+
+		if got, want := buf.String(), logging.TraceIDField+"=1f2e3d"; !strings.Contains(got, want) {
+			t.Errorf("log output %q does not contain %q", got, want)
+		}
+	})
+
+	t.Run("without trace id", func(t *testing.T) {
+		var buf bytes.Buffer
+		logger := logging.New(&buf, logrus.InfoLevel)
+
+		logging.WithContext(context.Background(), logger).Info("chunk validated")
+
+		if got := buf.String(); strings.Contains(got, logging.TraceIDField) {
+			t.Errorf("log output %q contains %q", got, logging.TraceIDField)
+		}
+	})
+}
+
+func TestSetLevel(t *testing.T) {
+	var buf bytes.Buffer
+	logger := logging.New(&buf, logrus.InfoLevel)
+
+	logger.Debug("before")
+	if strings.Contains(buf.String(), "before") {
+		t.Fatalf("debug message logged at %v level", logrus.InfoLevel)
+	}
+
+	logger.SetLevel(logrus.DebugLevel)
+	if got := logger.Level(); got != logrus.DebugLevel {
+		t.Fatalf("got level %v, want %v", got, logrus.DebugLevel)
+	}
+
+	logger.Debug("after")
+	if !strings.Contains(buf.String(), "after") {
+		t.Fatalf("debug message not logged at %v level", logrus.DebugLevel)
+	}
+
+	t.Run("concurrent", func(t *testing.T) {
+		logger := logging.New(ioutil.Discard, logrus.InfoLevel)
+
+		var wg sync.WaitGroup
+		for i := 0; i < 10; i++ {
+			wg.Add(2)
+			go func(level logrus.Level) {
+				defer wg.Done()
+				logger.SetLevel(level)
+			}(logrus.Level(i % 7))
+			go func() {
+				defer wg.Done()
+				_ = logger.Level()
+				logger.Debug("message")
+			}()
+		}
+		wg.Wait()
+	})
+}
+
+func TestSampled(t *testing.T) {
+	var buf bytes.Buffer
+	logger := logging.New(&buf, logrus.InfoLevel)
+
+	for i := 0; i < 100; i++ {
+		logger.Sampled("handshake", 10).Warningf("handshake with peer %d failed", i)
+	}
+
+	lines := strings.Split(strings.TrimSpace(buf.String()), "\n")
+	if len(lines) != 10 {
+		t.Fatalf("got %d lines, want 10: %q", len(lines), lines)
+	}
+	for i, line := range lines {
+		want := fmt.Sprintf(`msg="handshake with peer %d failed (seen %d times)"`, i*10, i*10+1)
+		if !strings.Contains(line, want) {
+			t.Errorf("log line %q does not contain %q", line, want)
+		}
+	}
+
+	t.Run("keys", func(t *testing.T) {
+		var buf bytes.Buffer
+		logger := logging.New(&buf, logrus.InfoLevel)
+
+		for i := 0; i < 3; i++ {
+			logger.Sampled("first", 10).Warning("first")
+			logger.Sampled("second", 10).Error("second")
+		}
+
+		got := buf.String()
+		for _, want := range []string{
+			`msg="first (seen 1 times)"`,
+			`msg="second (seen 1 times)"`,
+		} {
+			if strings.Count(got, want) != 1 {
+				t.Errorf("log output %q does not contain %q once", got, want)
+			}
+		}
+		if n := strings.Count(got, "\n"); n != 2 {
+			t.Errorf("got %d lines, want 2", n)
+		}
+	})
+}
+
+func TestNoop(t *testing.T) {
+	logger := logging.Noop()
+
+	logger.Info("message")
+	logger.WithField("peer", "ca1e9f39").Error("message")
+
+	// Calls are made without arguments as the variadic arguments slice of
+	// an interface method call is allocated by the caller regardless of the
+	// logger implementation.
+	if allocs := testing.AllocsPerRun(100, func() {
+		logger.Debugf("message")
+		logger.Error()
+	}); allocs != 0 {
+		t.Fatalf("got %v allocations, want 0", allocs)
+	}
+}
+
+func BenchmarkNoop(b *testing.B) {
+	logger := logging.Noop()
+
+	b.ReportAllocs()
+	for n := 0; n < b.N; n++ {
+		logger.Debugf("message")
+	}
+}
+
+func BenchmarkDiscard(b *testing.B) {
+	logger := logging.New(ioutil.Discard, logrus.DebugLevel)
+
+	b.ReportAllocs()
+	for n := 0; n < b.N; n++ {
+		logger.Debugf("message")
+	}
+}
@@ -0,0 +1,65 @@
+// Copyright 2021 The Swarm Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package logging
+
+import (
+	"io"
+	"io/ioutil"
+
+	"github.com/sirupsen/logrus"
+)
+
+// noopLogger is a Logger that drops all messages without formatting them.
+// Entries and writers are created on a logrus logger that writes to
+// ioutil.Discard at the panic level, so that they do not produce output
+// either.
+type noopLogger struct {
+	discard *logrus.Logger
+}
+
+// Noop returns a Logger that drops all messages. It is intended for tests and
+// code paths where logging is disabled. Setting the level has no effect.
+func Noop() Logger {
+	l := logrus.New()
+	l.SetOutput(ioutil.Discard)
+	l.SetLevel(logrus.PanicLevel)
+	return &noopLogger{discard: l}
+}
+
+func (*noopLogger) Tracef(format string, args ...interface{})   {}
+func (*noopLogger) Trace(args ...interface{})                   {}
+func (*noopLogger) Debugf(format string, args ...interface{})   {}
+func (*noopLogger) Debug(args ...interface{})                   {}
+func (*noopLogger) Infof(format string, args ...interface{})    {}
+func (*noopLogger) Info(args ...interface{})                    {}
+func (*noopLogger) Warningf(format string, args ...interface{}) {}
+func (*noopLogger) Warning(args ...interface{})                 {}
+func (*noopLogger) Errorf(format string, args ...interface{})   {}
+func (*noopLogger) Error(args ...interface{})                   {}
+func (*noopLogger) SetLevel(level logrus.Level)                 {}
+
+func (l *noopLogger) WithField(key string, value interface{}) *logrus.Entry {
+	return l.discard.WithField(key, value)
+}
+
+func (l *noopLogger) WithFields(fields logrus.Fields) *logrus.Entry {
+	return l.discard.WithFields(fields)
+}
+
+func (l *noopLogger) WriterLevel(level logrus.Level) *io.PipeWriter {
+	return l.discard.WriterLevel(level)
+}
+
+func (l *noopLogger) NewEntry() *logrus.Entry {
+	return logrus.NewEntry(l.discard)
+}
+
+func (l *noopLogger) Sampled(key string, every int) Logger {
+	return l
+}
+
+func (l *noopLogger) Level() logrus.Level {
+	return l.discard.GetLevel()
+}
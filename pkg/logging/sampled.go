@@ -0,0 +1,113 @@
+// Copyright 2021 The Swarm Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package logging
+
+import (
+	"fmt"
+	"sync"
+)
+
+// Sampler counts the messages logged by sampled loggers per key, so that a
+// message which is logged repeatedly, for example on every failed connection,
+// is written only once in a while. The zero value is ready to use.
+type Sampler struct {
+	counts map[string]uint64
+	mu     sync.Mutex
+}
+
+// Sampled returns a logger which writes to l only the first and then every
+// n-th message logged under the key, with the number of messages logged under
+// the key so far appended. The counters of all loggers returned for the same
+// key are shared. They are never removed, so the key should identify the call
+// site and not contain variable data. Entries and writers created from the
+// returned logger are not sampled.
+func (s *Sampler) Sampled(l Logger, key string, every int) Logger {
+	if every < 1 {
+		every = 1
+	}
+	return &sampledLogger{Logger: l, sampler: s, key: key, every: uint64(every)}
+}
+
+// sample increments the counter of the key and returns it together with
+// whether the message should be logged.
+func (s *Sampler) sample(key string, every uint64) (count uint64, ok bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.counts == nil {
+		s.counts = make(map[string]uint64)
+	}
+	s.counts[key]++
+	count = s.counts[key]
+	return count, (count-1)%every == 0
+}
+
+// sampledLogger is the Logger returned by Sampler.Sampled. Methods which do
+// not log a message are passed to the wrapped logger.
+type sampledLogger struct {
+	Logger
+	sampler *Sampler
+	key     string
+	every   uint64
+}
+
+func (l *sampledLogger) Tracef(format string, args ...interface{}) {
+	l.logf(l.Logger.Tracef, format, args)
+}
+
+func (l *sampledLogger) Trace(args ...interface{}) {
+	l.log(l.Logger.Trace, args)
+}
+
+func (l *sampledLogger) Debugf(format string, args ...interface{}) {
+	l.logf(l.Logger.Debugf, format, args)
+}
+
+func (l *sampledLogger) Debug(args ...interface{}) {
+	l.log(l.Logger.Debug, args)
+}
+
+func (l *sampledLogger) Infof(format string, args ...interface{}) {
+	l.logf(l.Logger.Infof, format, args)
+}
+
+func (l *sampledLogger) Info(args ...interface{}) {
+	l.log(l.Logger.Info, args)
+}
+
+func (l *sampledLogger) Warningf(format string, args ...interface{}) {
+	l.logf(l.Logger.Warningf, format, args)
+}
+
+func (l *sampledLogger) Warning(args ...interface{}) {
+	l.log(l.Logger.Warning, args)
+}
+
+func (l *sampledLogger) Errorf(format string, args ...interface{}) {
+	l.logf(l.Logger.Errorf, format, args)
+}
+
+func (l *sampledLogger) Error(args ...interface{}) {
+	l.log(l.Logger.Error, args)
+}
+
+// Sampled returns a sampled logger of the wrapped logger, so that samplers
+// are not nested.
+func (l *sampledLogger) Sampled(key string, every int) Logger {
+	return l.Logger.Sampled(key, every)
+}
+
+func (l *sampledLogger) logf(f func(string, ...interface{}), format string, args []interface{}) {
+	if count, ok := l.sampler.sample(l.key, l.every); ok {
+		// the full slice expression makes append copy the arguments
+		f(format+" (seen %d times)", append(args[:len(args):len(args)], count)...)
+	}
+}
+
+func (l *sampledLogger) log(f func(...interface{}), args []interface{}) {
+	if count, ok := l.sampler.sample(l.key, l.every); ok {
+		f(append(args[:len(args):len(args)], fmt.Sprintf(" (seen %d times)", count))...)
+	}
+}
@@ -138,6 +138,9 @@ type Options struct {
 	PriceOracleAddress         string
 	BlockTime                  uint64
 	DeployGasPrice             string
+	LightNodeLimit             int
+	HandshakeCapabilities      []string
+	HandshakeProtocolIDs       []string
 }
 
 const (
@@ -298,14 +301,17 @@ func NewBee(addr string, swarmAddress swarm.Address, publicKey ecdsa.PublicKey,
 	senderMatcher := transaction.NewMatcher(swapBackend, types.NewEIP155Signer(big.NewInt(chainID)))
 
 	p2ps, err := libp2p.New(p2pCtx, signer, networkID, swarmAddress, addr, addressbook, stateStore, lightNodes, senderMatcher, logger, tracer, libp2p.Options{
-		PrivateKey:     libp2pPrivateKey,
-		NATAddr:        o.NATAddr,
-		EnableWS:       o.EnableWS,
-		EnableQUIC:     o.EnableQUIC,
-		Standalone:     o.Standalone,
-		WelcomeMessage: o.WelcomeMessage,
-		FullNode:       o.FullNodeMode,
-		Transaction:    txHash,
+		PrivateKey:           libp2pPrivateKey,
+		NATAddr:              o.NATAddr,
+		EnableWS:             o.EnableWS,
+		EnableQUIC:           o.EnableQUIC,
+		Standalone:           o.Standalone,
+		WelcomeMessage:       o.WelcomeMessage,
+		FullNode:             o.FullNodeMode,
+		Transaction:          txHash,
+		Capabilities:         o.HandshakeCapabilities,
+		LightNodeLimit:       o.LightNodeLimit,
+		HandshakeProtocolIDs: o.HandshakeProtocolIDs,
 	})
 	if err != nil {
 		return nil, fmt.Errorf("p2p service: %w", err)
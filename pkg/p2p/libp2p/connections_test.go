@@ -274,6 +274,71 @@ func TestDifferentNetworkIDs(t *testing.T) {
 	expectPeers(t, s2)
 }
 
+func TestConnectWithHandshakeProtocolIDs(t *testing.T) {
+	oldID := p2p.NewSwarmStreamName(handshake.ProtocolName, handshake.ProtocolVersion, handshake.StreamName)
+	newID := p2p.NewSwarmStreamName("bzz-handshake", "1.0.0", handshake.StreamName)
+
+	for _, tc := range []struct {
+		name    string
+		dialer  []string
+		dialed  []string
+		wantErr bool
+	}{
+		{
+			name:   "old to both",
+			dialer: []string{oldID},
+			dialed: []string{newID, oldID},
+		},
+		{
+			name:   "both to old",
+			dialer: []string{newID, oldID},
+			dialed: []string{oldID},
+		},
+		{
+			name:   "both to both",
+			dialer: []string{newID, oldID},
+			dialed: []string{newID, oldID},
+		},
+		{
+			name:    "new to old",
+			dialer:  []string{newID},
+			dialed:  []string{oldID},
+			wantErr: true,
+		},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			ctx, cancel := context.WithCancel(context.Background())
+			defer cancel()
+
+			s1, overlay1 := newService(t, 1, libp2pServiceOpts{libp2pOpts: libp2p.Options{
+				FullNode:             true,
+				HandshakeProtocolIDs: tc.dialed,
+			}})
+			s2, overlay2 := newService(t, 1, libp2pServiceOpts{libp2pOpts: libp2p.Options{
+				HandshakeProtocolIDs: tc.dialer,
+			}})
+
+			addr := serviceUnderlayAddress(t, s1)
+
+			_, err := s2.Connect(ctx, addr)
+			if tc.wantErr {
+				if err == nil {
+					t.Fatal("connect attempt should result with an error")
+				}
+				expectPeers(t, s2)
+				expectPeersEventually(t, s1)
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			expectPeers(t, s2, overlay1)
+			expectPeersEventually(t, s1, overlay2)
+		})
+	}
+}
+
 func TestConnectWithEnabledQUICAndWSTransports(t *testing.T) {
 	ctx, cancel := context.WithCancel(context.Background())
 	defer cancel()
@@ -0,0 +1,41 @@
+// Copyright 2021 The Swarm Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package handshake
+
+import (
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+var SignData = signData
+
+func SetChallengeFunc(f func([]byte) (int, error)) {
+	challengeFn = f
+}
+
+func SetTimeNow(f func() time.Time) {
+	timeNow = f
+}
+
+func (s *Service) RateLimitedAddresses() int {
+	s.rateLimiter.mu.Lock()
+	defer s.rateLimiter.mu.Unlock()
+	return len(s.rateLimiter.limiters)
+}
+
+func (s *Service) SetMaxSeenNonces(n int) {
+	s.maxSeenNonces = n
+}
+
+func (s *Service) SeenNonces() int {
+	s.seenNoncesMu.Lock()
+	defer s.seenNoncesMu.Unlock()
+	return len(s.seenNonces)
+}
+
+func (s *Service) DeprecatedVersionCounter() prometheus.Counter {
+	return s.metrics.DeprecatedVersionCount
+}
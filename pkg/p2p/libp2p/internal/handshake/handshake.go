@@ -6,6 +6,8 @@ package handshake
 
 import (
 	"context"
+	"crypto/rand"
+	"encoding/binary"
 	"errors"
 	"fmt"
 	"sync"
@@ -23,6 +25,8 @@ import (
 	"github.com/libp2p/go-libp2p-core/network"
 	libp2ppeer "github.com/libp2p/go-libp2p-core/peer"
 	ma "github.com/multiformats/go-multiaddr"
+	"github.com/sirupsen/logrus"
+	"golang.org/x/time/rate"
 )
 
 const (
@@ -35,11 +39,60 @@ const (
 	// MaxWelcomeMessageLength is maximum number of characters allowed in the welcome message.
 	MaxWelcomeMessageLength = 140
 	handshakeTimeout        = 15 * time.Second
+	retryBackoff            = 100 * time.Millisecond
+	nonceSize               = 32
+	nonceReplayWindow       = 10 * time.Minute
+	// defaultMaxSeenNonces bounds the memory used for the replay protection
+	// if handshakes are flooded within the replay window.
+	defaultMaxSeenNonces = 1 << 16
+	// defaultMaxClockSkew is generous to tolerate badly synchronized clocks,
+	// while it stays within the nonce replay window.
+	defaultMaxClockSkew = 5 * time.Minute
 )
 
+const (
+	// LegacyVersion is the handshake wire version of the peers which do not
+	// advertise a version, as they predate the version negotiation. The ack
+	// of these peers is not signed, so only the signature of the bzz
+	// address is verified. Legacy peers are rejected unless they are
+	// allowed with WithLegacyPeers.
+	LegacyVersion uint32 = 1
+	// MinSupportedVersion is the lowest handshake wire version this node
+	// is able to negotiate with a peer.
+	MinSupportedVersion = LegacyVersion
+	// MaxSupportedVersion is the highest handshake wire version this node
+	// is able to negotiate with a peer. Since version 2 the ack is signed
+	// over the challenge of the responder.
+	MaxSupportedVersion uint32 = 2
+)
+
+// Compression is a codec which compresses the streams of a connection.
+type Compression int32
+
+const (
+	// CompressionNone means that the streams are not compressed. It is
+	// supported by all peers and it is used if no other codec is supported
+	// by both sides.
+	CompressionNone = Compression(pb.Compression_NONE)
+	// CompressionGzip is the gzip codec.
+	CompressionGzip = Compression(pb.Compression_GZIP)
+	// CompressionSnappy is the snappy codec.
+	CompressionSnappy = Compression(pb.Compression_SNAPPY)
+)
+
+func (c Compression) String() string {
+	return pb.Compression(c).String()
+}
+
 var (
-	// ErrNetworkIDIncompatible is returned if response from the other peer does not have valid networkID.
-	ErrNetworkIDIncompatible = errors.New("incompatible network ID")
+	// ErrNetworkIDMismatch is returned if the other peer is on a different network.
+	ErrNetworkIDMismatch = errors.New("network ID mismatch")
+
+	// ErrSelfConnection is returned if the other peer advertises the overlay address of this node.
+	ErrSelfConnection = errors.New("self connection")
+
+	// ErrInvalidHandshakeSignature is returned if the ack is not signed by the owner of the advertised overlay address.
+	ErrInvalidHandshakeSignature = errors.New("invalid handshake signature")
 
 	// ErrHandshakeDuplicate is returned  if the handshake response has been received by an already processed peer.
 	ErrHandshakeDuplicate = errors.New("duplicate handshake")
@@ -47,16 +100,178 @@ var (
 	// ErrInvalidAck is returned if data in received in ack is not valid (invalid signature for example).
 	ErrInvalidAck = errors.New("invalid ack")
 
-	// ErrInvalidSyn is returned if observable address in ack is not a valid..
-	ErrInvalidSyn = errors.New("invalid syn")
+	// ErrInvalidRemoteAddress is returned if the address advertised by the peer is empty or its overlay address has an invalid length.
+	ErrInvalidRemoteAddress = errors.New("invalid remote address")
+
+	// ErrInvalidObservedUnderlay is returned if the underlay observed by the peer is not a valid multiaddress.
+	ErrInvalidObservedUnderlay = errors.New("invalid observed underlay")
 
 	// ErrAddressNotFound is returned if observable address in ack is not a valid..
 	ErrAddressNotFound = errors.New("address not found")
 
 	// ErrWelcomeMessageLength is returned if the welcome message is longer than the maximum length
 	ErrWelcomeMessageLength = fmt.Errorf("handshake welcome message longer than maximum of %d characters", MaxWelcomeMessageLength)
+
+	// ErrVersionMismatch is returned if the peers do not share a supported protocol version.
+	ErrVersionMismatch = errors.New("protocol version mismatch")
+
+	// ErrInvalidVersionRange is returned if the minimal supported version is greater than the maximal one.
+	ErrInvalidVersionRange = errors.New("invalid protocol version range")
+
+	// ErrLightNodeRejected is returned if the light node limit is reached and the peer is a light node.
+	ErrLightNodeRejected = errors.New("light node rejected")
+
+	// ErrReplayedHandshake is returned if the nonce of the initiator was already used recently.
+	ErrReplayedHandshake = errors.New("replayed handshake")
+
+	// ErrHandshakeRateLimited is returned if the remote address exceeded the handshake rate limit.
+	ErrHandshakeRateLimited = errors.New("handshake rate limited")
+
+	// ErrInvalidRateLimit is returned if the handshake rate limit or its burst is not positive.
+	ErrInvalidRateLimit = errors.New("invalid handshake rate limit")
+
+	// ErrNoProtocolIDs is returned if the service is configured without protocol ids.
+	ErrNoProtocolIDs = errors.New("no handshake protocol ids")
+
+	// ErrPeerRejected is returned if the peer is rejected by the admission function.
+	ErrPeerRejected = errors.New("peer rejected")
+
+	// ErrHandshakeDowngrade is returned if the protocol versions signed by the initiator differ from the ones seen by the responder.
+	ErrHandshakeDowngrade = errors.New("handshake downgrade")
+
+	// ErrHandshakeExpired is returned if the timestamp of the ack differs from the local time by more than the maximal clock skew.
+	ErrHandshakeExpired = errors.New("handshake expired")
+
+	// ErrTryAgainLater is returned if the peer can not accept more peers at the moment.
+	ErrTryAgainLater = errors.New("try again later")
+
+	// ErrPeerIDMismatch is returned if the underlay of the connection and the advertised underlay belong to different peers.
+	ErrPeerIDMismatch = errors.New("peer id mismatch")
 )
 
+// challengeFn generates the nonce the responder sends to the initiator
+// to be signed, so it can be made deterministic in tests.
+var challengeFn = rand.Read
+
+// timeNow is used to deterministically mock time.Now() in tests.
+var timeNow = time.Now
+
+// VersionMismatchError is returned if no protocol version could be negotiated
+// with the peer. It carries the highest local version and the version
+// received from the peer and it wraps ErrVersionMismatch.
+type VersionMismatchError struct {
+	Local  uint32
+	Remote uint32
+}
+
+// Unwrap returns an underlying error.
+func (e *VersionMismatchError) Unwrap() error { return ErrVersionMismatch }
+
+// Error implements function of the standard go error interface.
+func (e *VersionMismatchError) Error() string {
+	return fmt.Sprintf("%v: local %d, remote %d", ErrVersionMismatch, e.Local, e.Remote)
+}
+
+// NetworkIDMismatchError is returned if the network ID received from the peer
+// is different from the local one. It wraps ErrNetworkIDMismatch.
+type NetworkIDMismatchError struct {
+	Local  uint64
+	Remote uint64
+}
+
+// Unwrap returns an underlying error.
+func (e *NetworkIDMismatchError) Unwrap() error { return ErrNetworkIDMismatch }
+
+// Error implements function of the standard go error interface.
+func (e *NetworkIDMismatchError) Error() string {
+	return fmt.Sprintf("%v: local %d, remote %d", ErrNetworkIDMismatch, e.Local, e.Remote)
+}
+
+// TryAgainLaterError is returned by Handle if this node is at its capacity
+// and by Handshake if the peer is. RetryAfter is the time after which the
+// handshake may be attempted again. It wraps ErrTryAgainLater.
+type TryAgainLaterError struct {
+	RetryAfter time.Duration
+}
+
+// Unwrap returns an underlying error.
+func (e *TryAgainLaterError) Unwrap() error { return ErrTryAgainLater }
+
+// Error implements function of the standard go error interface.
+func (e *TryAgainLaterError) Error() string {
+	return fmt.Sprintf("%v: retry after %s", ErrTryAgainLater, e.RetryAfter)
+}
+
+// Phases of the handshake, named after the message which is exchanged.
+const (
+	PhaseSyn    = "syn"
+	PhaseSynAck = "synack"
+	PhaseAck    = "ack"
+)
+
+// HandshakeError is returned if a handshake message could not be read from
+// or written to the peer. It carries the peer and the phase of the handshake
+// and it wraps the cause.
+type HandshakeError struct {
+	Op    string // "read" or "write"
+	Phase string
+	Peer  libp2ppeer.ID
+	Err   error
+}
+
+// Unwrap returns an underlying error.
+func (e *HandshakeError) Unwrap() error { return e.Err }
+
+// Error implements function of the standard go error interface.
+func (e *HandshakeError) Error() string {
+	if e.Peer == "" {
+		return fmt.Sprintf("%s %s message: %v", e.Op, e.Phase, e.Err)
+	}
+	return fmt.Sprintf("%s %s message: peer %s: %v", e.Op, e.Phase, e.Peer, e.Err)
+}
+
+// HandshakeEventType is the stage of the handshake reported by a
+// HandshakeEvent.
+type HandshakeEventType int
+
+// Stages of the handshake reported to the observer.
+const (
+	HandshakeStarted HandshakeEventType = iota
+	HandshakeSucceeded
+	HandshakeFailed
+)
+
+func (t HandshakeEventType) String() string {
+	switch t {
+	case HandshakeStarted:
+		return "started"
+	case HandshakeSucceeded:
+		return "succeeded"
+	case HandshakeFailed:
+		return "failed"
+	}
+	return fmt.Sprintf("HandshakeEventType(%d)", int(t))
+}
+
+// HandshakeEvent describes a stage of a handshake with a peer.
+type HandshakeEvent struct {
+	Type HandshakeEventType
+	// Inbound is true for the handshakes handled by Handle and false for
+	// those initiated by Handshake.
+	Inbound bool
+	Peer    libp2ppeer.ID
+	// Multiaddr is the underlay of the peer the stream was opened with.
+	Multiaddr ma.Multiaddr
+	// BzzAddress is the verified address of the peer, set only when the
+	// handshake succeeded.
+	BzzAddress *bzz.Address
+	// Phase is the phase of the handshake in which it failed, if the error
+	// is a HandshakeError.
+	Phase string
+	// Err is the reason of the failure.
+	Err error
+}
+
 // AdvertisableAddressResolver can Resolve a Multiaddress.
 type AdvertisableAddressResolver interface {
 	Resolve(observedAdddress ma.Multiaddr) (ma.Multiaddr, error)
@@ -67,6 +282,10 @@ type SenderMatcher interface {
 }
 
 // Service can perform initiate or handle a handshake between peers.
+// It is safe for concurrent use by multiple goroutines, so handshakes with
+// different peers may run in parallel. The mutable state shared between
+// handshakes is either atomic or guarded by a mutex. All other fields are
+// set by New and its options and are read only afterwards.
 type Service struct {
 	signer                crypto.Signer
 	advertisableAddresser AdvertisableAddressResolver
@@ -74,19 +293,59 @@ type Service struct {
 	overlay               swarm.Address
 	fullNode              bool
 	transaction           []byte
+	capabilities          []string
 	networkID             uint64
+	minVersion            uint32
+	maxVersion            uint32
 	welcomeMessage        atomic.Value
+	blockHeight           atomic.Value
 	receivedHandshakes    map[libp2ppeer.ID]struct{}
-	receivedHandshakesMu  sync.Mutex
+	lightNodes            map[libp2ppeer.ID]struct{}
+	receivedHandshakesMu  sync.Mutex // guards receivedHandshakes and lightNodes
+	lightNodeLimit        int
+	lightNodeRejected     func(swarm.Address)
+	seenNonces            map[string]struct{}
+	seenNoncesQueue       []seenNonce // in the order the nonces were seen
+	seenNoncesMu          sync.Mutex  // guards seenNonces and seenNoncesQueue
+	maxSeenNonces         int
+	rateLimiter           *rateLimiter
+	maxClockSkew          time.Duration
+	maxMessageSize        uint32
+	compressions          []pb.Compression
+	underlays             [][]byte
+	deprecatedVersions    map[uint32]struct{}
+	legacyPeers           bool
+	capacityFunc          func() time.Duration
+	admissionFunc         func(Info) error
+	protocolIDs           []string
+	observer              func(HandshakeEvent)
 	logger                logging.Logger
+	metrics               metrics
 
 	network.Notifiee // handshake service can be the receiver for network.Notify
 }
 
 // Info contains the information received from the handshake.
 type Info struct {
-	BzzAddress *bzz.Address
-	FullNode   bool
+	BzzAddress       *bzz.Address
+	FullNode         bool
+	ProtocolVersion  uint32
+	Capabilities     []string
+	ObservedUnderlay ma.Multiaddr
+	WelcomeMessage   string
+	BlockHeight      uint64
+	// MaxMessageSize is the maximal size of a protobuf message on the
+	// connection, the lower of the limits of this node and the peer.
+	MaxMessageSize uint32
+	// Compression is the codec negotiated for the streams of the connection.
+	Compression Compression
+	// Underlays are the additional underlays advertised by the peer, for
+	// example on other transports. Unlike the underlay of the BzzAddress,
+	// they are not signed by the peer. Malformed underlays are skipped.
+	Underlays []ma.Multiaddr
+	// RTT is the time between sending the syn and receiving the synack
+	// message. It is measured only by the initiator of the handshake.
+	RTT time.Duration
 }
 
 func (i *Info) LightString() string {
@@ -97,35 +356,233 @@ func (i *Info) LightString() string {
 	return ""
 }
 
-// New creates a new handshake Service.
-func New(signer crypto.Signer, advertisableAddresser AdvertisableAddressResolver, isSender SenderMatcher, overlay swarm.Address, networkID uint64, fullNode bool, transaction []byte, welcomeMessage string, logger logging.Logger) (*Service, error) {
+// Option is a function that configures optional parameters of the Service.
+type Option func(*Service)
+
+// WithLightNodeLimit sets the maximal number of light nodes that are accepted
+// by Handle at the same time. Zero means that there is no limit.
+func WithLightNodeLimit(limit int) Option {
+	return func(s *Service) {
+		s.lightNodeLimit = limit
+	}
+}
+
+// WithLightNodeRejectedFunc sets the function which is called with the overlay
+// address of the light node rejected because the limit is reached. It may be
+// called concurrently by parallel handshakes.
+func WithLightNodeRejectedFunc(f func(swarm.Address)) Option {
+	return func(s *Service) {
+		s.lightNodeRejected = f
+	}
+}
+
+// WithHandshakeRateLimit limits the rate of handshakes handled from the same
+// remote IP address to rps per second with bursts of up to burst handshakes.
+// Both have to be positive, otherwise New returns ErrInvalidRateLimit.
+func WithHandshakeRateLimit(rps float64, burst int) Option {
+	return func(s *Service) {
+		s.rateLimiter = newRateLimiter(rate.Limit(rps), burst)
+	}
+}
+
+// WithAdmissionFunc sets the function which is called by Handle with the
+// information received from the peer, after its ack is verified. If the
+// function returns an error, the handshake is aborted with the error wrapped
+// as ErrPeerRejected. It may be called concurrently by parallel handshakes.
+func WithAdmissionFunc(f func(info Info) error) Option {
+	return func(s *Service) {
+		s.admissionFunc = f
+	}
+}
+
+// WithProtocolIDs sets the libp2p protocol ids under which the handshake
+// stream is served, in the order of preference. The initiator of a handshake
+// uses the first id supported by the peer, so the ids of a renamed protocol
+// can be served together with the old ones during a migration. The default is
+// the single id built from ProtocolName, ProtocolVersion and StreamName.
+func WithProtocolIDs(ids ...string) Option {
+	return func(s *Service) {
+		s.protocolIDs = append([]string(nil), ids...)
+	}
+}
+
+// WithMaxClockSkew sets the maximal difference between the signed timestamp of
+// the ack and the local time for which the ack is accepted by Handle. Acks
+// outside of this window are rejected with ErrHandshakeExpired. The default
+// is 5 minutes.
+func WithMaxClockSkew(d time.Duration) Option {
+	return func(s *Service) {
+		s.maxClockSkew = d
+	}
+}
+
+// WithMaxMessageSize sets the maximal size of a protobuf message that this
+// node accepts, which is advertised to the peers in the handshake. The
+// default is protobuf.DefaultMaxMessageSize.
+func WithMaxMessageSize(size uint32) Option {
+	return func(s *Service) {
+		s.maxMessageSize = size
+	}
+}
+
+// WithCompressions sets the codecs supported by this node in the order of
+// preference, which are advertised to the peers in the handshake. The codec
+// of the connection is the first one of the codecs of the node that handles
+// the handshake which is supported by the initiator as well, or
+// CompressionNone if there is none. By default only CompressionNone is
+// supported.
+func WithCompressions(codecs ...Compression) Option {
+	return func(s *Service) {
+		s.compressions = make([]pb.Compression, 0, len(codecs))
+		for _, c := range codecs {
+			s.compressions = append(s.compressions, pb.Compression(c))
+		}
+	}
+}
+
+// WithUnderlays sets the additional underlays of this node, for example on
+// other transports, which are advertised to the peers in the handshake next
+// to the advertisable underlay.
+func WithUnderlays(underlays ...ma.Multiaddr) Option {
+	return func(s *Service) {
+		s.underlays = make([][]byte, 0, len(underlays))
+		for _, u := range underlays {
+			s.underlays = append(s.underlays, u.Bytes())
+		}
+	}
+}
+
+// WithDeprecatedVersions sets the protocol versions which are going to be
+// removed. Handshakes which negotiate one of them succeed, but Handle logs a
+// warning, so that operators can plan the upgrade.
+func WithDeprecatedVersions(versions ...uint32) Option {
+	return func(s *Service) {
+		s.deprecatedVersions = make(map[uint32]struct{}, len(versions))
+		for _, v := range versions {
+			s.deprecatedVersions[v] = struct{}{}
+		}
+	}
+}
+
+// WithLegacyPeers sets whether the peers which predate the version negotiation
+// are accepted. Their handshake messages advertise no version and their ack is
+// not signed, so they can not prove the ownership of the overlay address
+// beyond the signature of the bzz address. An ack with a signature is always
+// verified, so the signed handshake of other peers can not be downgraded to
+// the legacy one. Legacy peers are rejected by default.
+func WithLegacyPeers(allow bool) Option {
+	return func(s *Service) {
+		s.legacyPeers = allow
+	}
+}
+
+// WithCapacityFunc sets the function which is called by Handle before the
+// handshake with a peer is made. A positive duration means that this node can
+// not accept more peers, so the peer is told to try again after it, rounded
+// up to seconds, and the handshake fails with TryAgainLaterError on both
+// sides.
+func WithCapacityFunc(f func() time.Duration) Option {
+	return func(s *Service) {
+		s.capacityFunc = f
+	}
+}
+
+// WithObserver sets the function which is called when a handshake starts and
+// when it succeeds or fails, so that metrics and tracing can be collected
+// outside of the service. It is called synchronously and concurrently for
+// handshakes with different peers, so it should return quickly.
+func WithObserver(f func(ev HandshakeEvent)) Option {
+	return func(s *Service) {
+		s.observer = f
+	}
+}
+
+// WithBlockHeight sets the initial block height advertised to the peers.
+func WithBlockHeight(height uint64) Option {
+	return func(s *Service) {
+		s.blockHeight.Store(height)
+	}
+}
+
+// New creates a new handshake Service. The minVersion and maxVersion define
+// the range of handshake protocol versions that the service is able to negotiate.
+// The capabilities are advertised to the peers as optional features supported
+// by this node.
+func New(signer crypto.Signer, advertisableAddresser AdvertisableAddressResolver, isSender SenderMatcher, overlay swarm.Address, networkID uint64, minVersion, maxVersion uint32, fullNode bool, transaction []byte, capabilities []string, welcomeMessage string, logger logging.Logger, opts ...Option) (*Service, error) {
 	if len(welcomeMessage) > MaxWelcomeMessageLength {
 		return nil, ErrWelcomeMessageLength
 	}
 
+	if minVersion > maxVersion {
+		return nil, ErrInvalidVersionRange
+	}
+
 	svc := &Service{
 		signer:                signer,
 		advertisableAddresser: advertisableAddresser,
 		overlay:               overlay,
 		networkID:             networkID,
+		minVersion:            minVersion,
+		maxVersion:            maxVersion,
 		fullNode:              fullNode,
 		transaction:           transaction,
+		capabilities:          append([]string(nil), capabilities...),
 		senderMatcher:         isSender,
 		receivedHandshakes:    make(map[libp2ppeer.ID]struct{}),
+		lightNodes:            make(map[libp2ppeer.ID]struct{}),
+		seenNonces:            make(map[string]struct{}),
+		maxSeenNonces:         defaultMaxSeenNonces,
+		maxClockSkew:          defaultMaxClockSkew,
+		maxMessageSize:        protobuf.DefaultMaxMessageSize,
+		protocolIDs:           []string{p2p.NewSwarmStreamName(ProtocolName, ProtocolVersion, StreamName)},
 		logger:                logger,
+		metrics:               newMetrics(),
 		Notifiee:              new(network.NoopNotifiee),
 	}
 	svc.welcomeMessage.Store(welcomeMessage)
+	svc.blockHeight.Store(uint64(0))
+
+	for _, o := range opts {
+		o(svc)
+	}
+
+	if len(svc.protocolIDs) == 0 {
+		return nil, ErrNoProtocolIDs
+	}
+
+	if svc.rateLimiter != nil && (svc.rateLimiter.limit <= 0 || svc.rateLimiter.burst <= 0) {
+		return nil, ErrInvalidRateLimit
+	}
 
 	return svc, nil
 }
 
+// ProtocolIDs returns the libp2p protocol ids of the handshake stream in the
+// order of preference.
+func (s *Service) ProtocolIDs() []string {
+	return append([]string(nil), s.protocolIDs...)
+}
+
 // Handshake initiates a handshake with a peer.
 func (s *Service) Handshake(ctx context.Context, stream p2p.Stream, peerMultiaddr ma.Multiaddr, peerID libp2ppeer.ID) (i *Info, err error) {
 	ctx, cancel := context.WithTimeout(ctx, handshakeTimeout)
 	defer cancel()
 
-	w, r := protobuf.NewWriterAndReader(stream)
+	start := time.Now()
+	s.observe(HandshakeEvent{Type: HandshakeStarted, Inbound: false, Peer: peerID, Multiaddr: peerMultiaddr})
+	defer func() {
+		if err != nil {
+			// the stream is left in an unknown state
+			_ = stream.Reset()
+			s.observeFailure(false, peerID, peerMultiaddr, err)
+			return
+		}
+		s.metrics.SuccessCount.Inc()
+		s.metrics.Duration.Observe(time.Since(start).Seconds())
+		s.observe(HandshakeEvent{Type: HandshakeSucceeded, Inbound: false, Peer: peerID, Multiaddr: peerMultiaddr, BzzAddress: i.BzzAddress})
+	}()
+
+	w, r := protobuf.NewWriterAndReader(stream, protobuf.WithValidator(validateMessage))
 	fullRemoteMA, err := buildFullMA(peerMultiaddr, peerID)
 	if err != nil {
 		return nil, err
@@ -136,15 +593,26 @@ func (s *Service) Handshake(ctx context.Context, stream p2p.Stream, peerMultiadd
 		return nil, err
 	}
 
+	// time.Now carries a monotonic clock reading used by time.Since
+	synSent := time.Now()
 	if err := w.WriteMsgWithContext(ctx, &pb.Syn{
 		ObservedUnderlay: fullRemoteMABytes,
+		ProtocolVersion:  s.maxVersion,
+		NetworkID:        s.networkID,
 	}); err != nil {
-		return nil, fmt.Errorf("write syn message: %w", err)
+		s.metrics.WriteErrorCount.Inc()
+		return nil, &HandshakeError{Op: "write", Phase: PhaseSyn, Peer: peerID, Err: err}
 	}
 
 	var resp pb.SynAck
 	if err := r.ReadMsgWithContext(ctx, &resp); err != nil {
-		return nil, fmt.Errorf("read synack message: %w", err)
+		s.metrics.ReadErrorCount.Inc()
+		return nil, &HandshakeError{Op: "read", Phase: PhaseSynAck, Peer: peerID, Err: err}
+	}
+	rtt := time.Since(synSent)
+
+	if resp.Ack != nil && resp.Ack.RetryAfterSeconds > 0 {
+		return nil, &TryAgainLaterError{RetryAfter: time.Duration(resp.Ack.RetryAfterSeconds) * time.Second}
 	}
 
 	remoteBzzAddress, err := s.parseCheckAck(resp.Ack)
@@ -152,9 +620,26 @@ func (s *Service) Handshake(ctx context.Context, stream p2p.Stream, peerMultiadd
 		return nil, err
 	}
 
-	observedUnderlay, err := ma.NewMultiaddrBytes(resp.Syn.ObservedUnderlay)
+	// the responder picks the version, it only needs to be supported locally
+	version, err := s.remoteVersion(resp.Ack.ProtocolVersion)
 	if err != nil {
-		return nil, ErrInvalidSyn
+		return nil, err
+	}
+	if version < s.minVersion || version > s.maxVersion {
+		return nil, &VersionMismatchError{Local: s.maxVersion, Remote: version}
+	}
+
+	// the responder advertises its highest version, so a lower version
+	// supported by both sides means that the synack was altered in transit,
+	// which the responder detects from the signed ack if the advertised
+	// version is removed as well
+	if resp.Ack.MaxProtocolVersion > version && s.maxVersion > version {
+		return nil, ErrHandshakeDowngrade
+	}
+
+	observedUnderlay, err := parseObservedUnderlay(resp.Syn.ObservedUnderlay)
+	if err != nil {
+		return nil, err
 	}
 
 	advertisableUnderlay, err := s.advertisableAddresser.Resolve(observedUnderlay)
@@ -172,6 +657,17 @@ func (s *Service) Handshake(ctx context.Context, stream p2p.Stream, peerMultiadd
 		return nil, err
 	}
 
+	nonce := make([]byte, nonceSize)
+	if _, err := rand.Read(nonce); err != nil {
+		return nil, err
+	}
+
+	timestamp := timeNow().Unix()
+	signature, err := s.signer.Sign(signData(s.networkID, bzzAddress.Overlay, nonce, resp.Ack.Nonce, s.maxVersion, version, timestamp, s.capabilities))
+	if err != nil {
+		return nil, err
+	}
+
 	// Synced read:
 	welcomeMessage := s.GetWelcomeMessage()
 	if err := w.WriteMsgWithContext(ctx, &pb.Ack{
@@ -180,30 +676,138 @@ func (s *Service) Handshake(ctx context.Context, stream p2p.Stream, peerMultiadd
 			Overlay:   bzzAddress.Overlay.Bytes(),
 			Signature: bzzAddress.Signature,
 		},
-		NetworkID:      s.networkID,
-		FullNode:       s.fullNode,
-		Transaction:    s.transaction,
-		WelcomeMessage: welcomeMessage,
+		NetworkID:          s.networkID,
+		FullNode:           s.fullNode,
+		Transaction:        s.transaction,
+		ProtocolVersion:    version,
+		MaxProtocolVersion: s.maxVersion,
+		Timestamp:          timestamp,
+		MaxMessageSize:     s.maxMessageSize,
+		Compressions:       s.compressions,
+		Underlays:          s.underlays,
+		Nonce:              nonce,
+		Signature:          signature,
+		Capabilities:       s.capabilities,
+		WelcomeMessage:     welcomeMessage,
+		BlockHeight:        s.GetBlockHeight(),
 	}); err != nil {
-		return nil, fmt.Errorf("write ack message: %w", err)
+		s.metrics.WriteErrorCount.Inc()
+		return nil, &HandshakeError{Op: "write", Phase: PhaseAck, Peer: peerID, Err: err}
 	}
 
-	s.logger.Tracef("handshake finished for peer (outbound) %s", remoteBzzAddress.Overlay.String())
+	s.logger.WithFields(logrus.Fields{
+		"peer":       remoteBzzAddress.Overlay.String(),
+		"network_id": s.networkID,
+		"direction":  "outbound",
+	}).Trace("handshake finished")
 	if len(resp.Ack.WelcomeMessage) > 0 {
 		s.logger.Infof("greeting \"%s\" from peer: %s", resp.Ack.WelcomeMessage, remoteBzzAddress.Overlay.String())
 	}
 
 	return &Info{
-		BzzAddress: remoteBzzAddress,
-		FullNode:   resp.Ack.FullNode,
+		BzzAddress:       remoteBzzAddress,
+		FullNode:         resp.Ack.FullNode,
+		ProtocolVersion:  version,
+		Capabilities:     resp.Ack.Capabilities,
+		ObservedUnderlay: observedUnderlay,
+		WelcomeMessage:   resp.Ack.WelcomeMessage,
+		BlockHeight:      resp.Ack.BlockHeight,
+		MaxMessageSize:   s.negotiateMessageSize(resp.Ack.MaxMessageSize),
+		Compression:      negotiateCompression(resp.Ack.Compressions, s.compressions),
+		Underlays:        s.parseUnderlays(peerID, resp.Ack.Underlays),
+		RTT:              rtt,
 	}, nil
 }
 
+// HandshakeWithRetry initiates a handshake with a peer, retrying it up to
+// maxAttempts times with an exponential backoff as long as the error is
+// retryable. As a failed handshake leaves the stream in an unknown state,
+// every attempt is made on a new stream returned by newStream.
+func (s *Service) HandshakeWithRetry(ctx context.Context, newStream func(context.Context) (p2p.Stream, error), peerMultiaddr ma.Multiaddr, peerID libp2ppeer.ID, maxAttempts int) (i *Info, err error) {
+	backoff := retryBackoff
+	for attempt := 1; ; attempt++ {
+		var stream p2p.Stream
+		stream, err = newStream(ctx)
+		if err != nil {
+			return nil, err
+		}
+
+		i, err = s.Handshake(ctx, stream, peerMultiaddr, peerID)
+		if err == nil {
+			return i, nil
+		}
+
+		if attempt >= maxAttempts || !IsRetryable(err) {
+			return nil, err
+		}
+
+		s.logger.Tracef("handshake: attempt %d with peer %s failed, retrying in %s: %v", attempt, peerID, backoff, err)
+
+		select {
+		case <-time.After(backoff):
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		}
+		backoff *= 2
+	}
+}
+
+// IsRetryable returns true if the handshake failed because of an error which
+// may be transient, like a stream read or write error. Errors caused by an
+// incompatible or misbehaving peer are not retryable. Neither is
+// ErrTryAgainLater, as the peer asks to wait longer than the retry backoff.
+func IsRetryable(err error) bool {
+	if err == nil {
+		return false
+	}
+	for _, e := range []error{
+		context.Canceled,
+		ErrNetworkIDMismatch,
+		ErrSelfConnection,
+		ErrInvalidHandshakeSignature,
+		ErrHandshakeDuplicate,
+		ErrInvalidAck,
+		ErrInvalidRemoteAddress,
+		ErrInvalidObservedUnderlay,
+		ErrAddressNotFound,
+		ErrVersionMismatch,
+		ErrLightNodeRejected,
+		ErrReplayedHandshake,
+		ErrPeerRejected,
+		ErrHandshakeDowngrade,
+		ErrHandshakeExpired,
+		ErrTryAgainLater,
+	} {
+		if errors.Is(err, e) {
+			return false
+		}
+	}
+	return true
+}
+
 // Handle handles an incoming handshake from a peer.
 func (s *Service) Handle(ctx context.Context, stream p2p.Stream, remoteMultiaddr ma.Multiaddr, remotePeerID libp2ppeer.ID) (i *Info, err error) {
 	ctx, cancel := context.WithTimeout(ctx, handshakeTimeout)
 	defer cancel()
 
+	start := time.Now()
+	s.observe(HandshakeEvent{Type: HandshakeStarted, Inbound: true, Peer: remotePeerID, Multiaddr: remoteMultiaddr})
+	defer func() {
+		if err != nil {
+			// the stream is left in an unknown state
+			_ = stream.Reset()
+			s.observeFailure(true, remotePeerID, remoteMultiaddr, err)
+			return
+		}
+		s.metrics.SuccessCount.Inc()
+		s.metrics.Duration.Observe(time.Since(start).Seconds())
+		s.observe(HandshakeEvent{Type: HandshakeSucceeded, Inbound: true, Peer: remotePeerID, Multiaddr: remoteMultiaddr, BzzAddress: i.BzzAddress})
+	}()
+
+	if s.rateLimiter != nil && !s.rateLimiter.allow(rateLimitKey(remoteMultiaddr, remotePeerID)) {
+		return nil, ErrHandshakeRateLimited
+	}
+
 	s.receivedHandshakesMu.Lock()
 	if _, exists := s.receivedHandshakes[remotePeerID]; exists {
 		s.receivedHandshakesMu.Unlock()
@@ -212,7 +816,7 @@ func (s *Service) Handle(ctx context.Context, stream p2p.Stream, remoteMultiaddr
 
 	s.receivedHandshakes[remotePeerID] = struct{}{}
 	s.receivedHandshakesMu.Unlock()
-	w, r := protobuf.NewWriterAndReader(stream)
+	w, r := protobuf.NewWriterAndReader(stream, protobuf.WithValidator(validateMessage))
 	fullRemoteMA, err := buildFullMA(remoteMultiaddr, remotePeerID)
 	if err != nil {
 		return nil, err
@@ -225,12 +829,48 @@ func (s *Service) Handle(ctx context.Context, stream p2p.Stream, remoteMultiaddr
 
 	var syn pb.Syn
 	if err := r.ReadMsgWithContext(ctx, &syn); err != nil {
-		return nil, fmt.Errorf("read syn message: %w", err)
+		s.metrics.ReadErrorCount.Inc()
+		return nil, &HandshakeError{Op: "read", Phase: PhaseSyn, Peer: remotePeerID, Err: err}
+	}
+
+	// the syn of legacy peers, which do not advertise a version, has no
+	// network id, so if they are allowed it is checked only in their ack
+	legacySyn := s.legacyPeers && syn.ProtocolVersion == 0
+	if !legacySyn && syn.NetworkID != s.networkID {
+		s.metrics.NetworkIDMismatchCount.Inc()
+		return nil, &NetworkIDMismatchError{Local: s.networkID, Remote: syn.NetworkID}
+	}
+
+	// the peer is told when to try again instead of being dropped
+	if s.capacityFunc != nil {
+		if retryAfter := s.capacityFunc(); retryAfter > 0 {
+			seconds := uint32((retryAfter + time.Second - 1) / time.Second)
+			if err := w.WriteMsgWithContext(ctx, &pb.SynAck{
+				Syn: &pb.Syn{
+					ObservedUnderlay: fullRemoteMABytes,
+				},
+				Ack: &pb.Ack{
+					NetworkID:         s.networkID,
+					RetryAfterSeconds: seconds,
+				},
+			}); err != nil {
+				s.metrics.WriteErrorCount.Inc()
+				return nil, &HandshakeError{Op: "write", Phase: PhaseSynAck, Peer: remotePeerID, Err: err}
+			}
+			// the synack is delivered before the stream is reset
+			_ = stream.FullClose()
+			return nil, &TryAgainLaterError{RetryAfter: time.Duration(seconds) * time.Second}
+		}
+	}
+
+	observedUnderlay, err := parseObservedUnderlay(syn.ObservedUnderlay)
+	if err != nil {
+		return nil, err
 	}
 
-	observedUnderlay, err := ma.NewMultiaddrBytes(syn.ObservedUnderlay)
+	version, err := s.negotiateVersion(syn.ProtocolVersion)
 	if err != nil {
-		return nil, ErrInvalidSyn
+		return nil, err
 	}
 
 	advertisableUnderlay, err := s.advertisableAddresser.Resolve(observedUnderlay)
@@ -248,6 +888,11 @@ func (s *Service) Handle(ctx context.Context, stream p2p.Stream, remoteMultiaddr
 		return nil, err
 	}
 
+	challenge := make([]byte, nonceSize)
+	if _, err := challengeFn(challenge); err != nil {
+		return nil, err
+	}
+
 	welcomeMessage := s.GetWelcomeMessage()
 
 	if err := w.WriteMsgWithContext(ctx, &pb.SynAck{
@@ -260,18 +905,28 @@ func (s *Service) Handle(ctx context.Context, stream p2p.Stream, remoteMultiaddr
 				Overlay:   bzzAddress.Overlay.Bytes(),
 				Signature: bzzAddress.Signature,
 			},
-			NetworkID:      s.networkID,
-			FullNode:       s.fullNode,
-			Transaction:    s.transaction,
-			WelcomeMessage: welcomeMessage,
+			NetworkID:          s.networkID,
+			FullNode:           s.fullNode,
+			Transaction:        s.transaction,
+			ProtocolVersion:    version,
+			MaxProtocolVersion: s.maxVersion,
+			MaxMessageSize:     s.maxMessageSize,
+			Compressions:       s.compressions,
+			Underlays:          s.underlays,
+			Nonce:              challenge,
+			Capabilities:       s.capabilities,
+			WelcomeMessage:     welcomeMessage,
+			BlockHeight:        s.GetBlockHeight(),
 		},
 	}); err != nil {
-		return nil, fmt.Errorf("write synack message: %w", err)
+		s.metrics.WriteErrorCount.Inc()
+		return nil, &HandshakeError{Op: "write", Phase: PhaseSynAck, Peer: remotePeerID, Err: err}
 	}
 
 	var ack pb.Ack
 	if err := r.ReadMsgWithContext(ctx, &ack); err != nil {
-		return nil, fmt.Errorf("read ack message: %w", err)
+		s.metrics.ReadErrorCount.Inc()
+		return nil, &HandshakeError{Op: "read", Phase: PhaseAck, Peer: remotePeerID, Err: err}
 	}
 
 	remoteBzzAddress, err := s.parseCheckAck(&ack)
@@ -279,7 +934,40 @@ func (s *Service) Handle(ctx context.Context, stream p2p.Stream, remoteMultiaddr
 		return nil, err
 	}
 
-	s.logger.Tracef("handshake finished for peer (inbound) %s", remoteBzzAddress.Overlay.String())
+	// only the ack of legacy peers has neither the signature nor the fields
+	// it covers, any other ack is verified so that it can not be passed off
+	// as a legacy one
+	legacyAck := len(ack.Signature) == 0 && ack.MaxProtocolVersion == 0
+	if !s.legacyPeers || version > LegacyVersion || !legacyAck {
+		if err := s.verifyAck(remoteBzzAddress.Overlay, &ack, &syn, version, challenge); err != nil {
+			return nil, err
+		}
+	}
+
+	info := &Info{
+		BzzAddress:       remoteBzzAddress,
+		FullNode:         ack.FullNode,
+		ProtocolVersion:  version,
+		Capabilities:     ack.Capabilities,
+		ObservedUnderlay: observedUnderlay,
+		WelcomeMessage:   ack.WelcomeMessage,
+		BlockHeight:      ack.BlockHeight,
+		MaxMessageSize:   s.negotiateMessageSize(ack.MaxMessageSize),
+		Compression:      negotiateCompression(s.compressions, ack.Compressions),
+		Underlays:        s.parseUnderlays(remotePeerID, ack.Underlays),
+	}
+
+	if s.admissionFunc != nil {
+		if err := s.admissionFunc(*info); err != nil {
+			return nil, fmt.Errorf("%w: %v", ErrPeerRejected, err)
+		}
+	}
+
+	s.logger.WithFields(logrus.Fields{
+		"peer":       remoteBzzAddress.Overlay.String(),
+		"network_id": s.networkID,
+		"direction":  "inbound",
+	}).Trace("handshake finished")
 	if len(ack.WelcomeMessage) > 0 {
 		s.logger.Infof("greeting \"%s\" from peer: %s", ack.WelcomeMessage, remoteBzzAddress.Overlay.String())
 	}
@@ -293,10 +981,65 @@ func (s *Service) Handle(ctx context.Context, stream p2p.Stream, remoteMultiaddr
 		return nil, fmt.Errorf("given address is not registered on Ethereum: %v: %w", remoteBzzAddress.Overlay, ErrAddressNotFound)
 	}
 
-	return &Info{
-		BzzAddress: remoteBzzAddress,
-		FullNode:   ack.FullNode,
-	}, nil
+	if !ack.FullNode && !s.acceptLightNode(remotePeerID) {
+		if s.lightNodeRejected != nil {
+			s.lightNodeRejected(remoteBzzAddress.Overlay)
+		}
+		return nil, ErrLightNodeRejected
+	}
+
+	if _, ok := s.deprecatedVersions[version]; ok {
+		s.metrics.DeprecatedVersionCount.Inc()
+		s.logger.WithFields(logrus.Fields{
+			"peer":             remoteBzzAddress.Overlay.String(),
+			"protocol_version": version,
+			"max_version":      s.maxVersion,
+		}).Warning("handshake: peer uses a deprecated protocol version")
+	}
+
+	return info, nil
+}
+
+// NotifyMode sends the current mode of this node to an already connected
+// peer, so that it can update its view without a new handshake.
+func (s *Service) NotifyMode(ctx context.Context, stream p2p.Stream, light bool) error {
+	ctx, cancel := context.WithTimeout(ctx, handshakeTimeout)
+	defer cancel()
+
+	w := protobuf.NewWriter(stream)
+	if err := w.WriteMsgWithContext(ctx, &pb.ModeUpdate{FullNode: !light}); err != nil {
+		s.metrics.WriteErrorCount.Inc()
+		return fmt.Errorf("write mode update message: %w", err)
+	}
+	return nil
+}
+
+// HandleModeUpdate reads the mode update sent with NotifyMode by the peer and
+// returns whether it is a full node. A peer switching to the light mode is
+// subject to the light node limit and ErrLightNodeRejected is returned if it
+// is reached.
+func (s *Service) HandleModeUpdate(ctx context.Context, stream p2p.Stream, peerID libp2ppeer.ID) (fullNode bool, err error) {
+	ctx, cancel := context.WithTimeout(ctx, handshakeTimeout)
+	defer cancel()
+
+	r := protobuf.NewReader(stream)
+	var update pb.ModeUpdate
+	if err := r.ReadMsgWithContext(ctx, &update); err != nil {
+		s.metrics.ReadErrorCount.Inc()
+		return false, fmt.Errorf("read mode update message: %w", err)
+	}
+
+	if update.FullNode {
+		s.receivedHandshakesMu.Lock()
+		delete(s.lightNodes, peerID)
+		s.receivedHandshakesMu.Unlock()
+		return true, nil
+	}
+
+	if !s.acceptLightNode(peerID) {
+		return false, ErrLightNodeRejected
+	}
+	return false, nil
 }
 
 // Disconnected is called when the peer disconnects.
@@ -304,6 +1047,7 @@ func (s *Service) Disconnected(_ network.Network, c network.Conn) {
 	s.receivedHandshakesMu.Lock()
 	defer s.receivedHandshakesMu.Unlock()
 	delete(s.receivedHandshakes, c.RemotePeer())
+	delete(s.lightNodes, c.RemotePeer())
 }
 
 // SetWelcomeMessage sets the new handshake welcome message.
@@ -320,13 +1064,219 @@ func (s *Service) GetWelcomeMessage() string {
 	return s.welcomeMessage.Load().(string)
 }
 
+// SetBlockHeight sets the block height advertised to the peers.
+func (s *Service) SetBlockHeight(height uint64) {
+	s.blockHeight.Store(height)
+}
+
+// GetBlockHeight returns the block height advertised to the peers.
+func (s *Service) GetBlockHeight() uint64 {
+	return s.blockHeight.Load().(uint64)
+}
+
+// acceptLightNode reserves a light node slot for the peer. It returns false
+// if the light node limit is reached and the peer does not hold a slot yet.
+func (s *Service) acceptLightNode(peerID libp2ppeer.ID) bool {
+	s.receivedHandshakesMu.Lock()
+	defer s.receivedHandshakesMu.Unlock()
+	if _, ok := s.lightNodes[peerID]; ok {
+		return true
+	}
+	if s.lightNodeLimit > 0 && len(s.lightNodes) >= s.lightNodeLimit {
+		return false
+	}
+	s.lightNodes[peerID] = struct{}{}
+	return true
+}
+
+// verifyAck verifies the signature of the ack over the challenge and checks
+// that neither the negotiated version was downgraded nor the ack is expired
+// or replayed.
+func (s *Service) verifyAck(overlay swarm.Address, ack *pb.Ack, syn *pb.Syn, version uint32, challenge []byte) error {
+	if err := s.verifySignature(overlay, ack, challenge); err != nil {
+		return err
+	}
+
+	// the versions are signed, so a mismatch means that the syn or the
+	// synack was altered in transit to negotiate a lower version
+	if ack.MaxProtocolVersion != syn.ProtocolVersion || ack.ProtocolVersion != version {
+		return ErrHandshakeDowngrade
+	}
+
+	// the negotiated version is the highest one supported by both sides
+	if ack.MaxProtocolVersion > version && s.maxVersion > version {
+		return ErrHandshakeDowngrade
+	}
+
+	if skew := timeNow().Sub(time.Unix(ack.Timestamp, 0)); skew > s.maxClockSkew || skew < -s.maxClockSkew {
+		return ErrHandshakeExpired
+	}
+
+	if !s.recordNonce(ack.Nonce) {
+		return ErrReplayedHandshake
+	}
+	return nil
+}
+
+// remoteVersion returns the version advertised by the peer. The peers that do
+// not advertise any are LegacyVersion peers, which are rejected with
+// VersionMismatchError unless legacy peers are allowed.
+func (s *Service) remoteVersion(version uint32) (uint32, error) {
+	if version != 0 {
+		return version, nil
+	}
+	if !s.legacyPeers {
+		return 0, &VersionMismatchError{Local: s.maxVersion, Remote: version}
+	}
+	return LegacyVersion, nil
+}
+
+// negotiateVersion returns the highest protocol version supported by both
+// this node and the peer that advertised remoteMaxVersion.
+func (s *Service) negotiateVersion(remoteMaxVersion uint32) (uint32, error) {
+	remoteMaxVersion, err := s.remoteVersion(remoteMaxVersion)
+	if err != nil {
+		return 0, err
+	}
+	version := s.maxVersion
+	if remoteMaxVersion < version {
+		version = remoteMaxVersion
+	}
+	if version < s.minVersion {
+		return 0, &VersionMismatchError{Local: s.maxVersion, Remote: remoteMaxVersion}
+	}
+	return version, nil
+}
+
+// observe passes the event to the observer, if there is one.
+func (s *Service) observe(ev HandshakeEvent) {
+	if s.observer != nil {
+		s.observer(ev)
+	}
+}
+
+// observeFailure passes the failure of the handshake to the observer, with
+// the phase taken from the error.
+func (s *Service) observeFailure(inbound bool, peerID libp2ppeer.ID, peerMultiaddr ma.Multiaddr, err error) {
+	if s.observer == nil {
+		return
+	}
+	ev := HandshakeEvent{Type: HandshakeFailed, Inbound: inbound, Peer: peerID, Multiaddr: peerMultiaddr, Err: err}
+	var handshakeErr *HandshakeError
+	if errors.As(err, &handshakeErr) {
+		ev.Phase = handshakeErr.Phase
+	}
+	s.observer(ev)
+}
+
+// parseUnderlays parses the additional underlays advertised by the peer.
+// Malformed underlays are logged and skipped, so that they do not fail the
+// handshake.
+func (s *Service) parseUnderlays(peerID libp2ppeer.ID, data [][]byte) []ma.Multiaddr {
+	var underlays []ma.Multiaddr
+	for _, d := range data {
+		u, err := ma.NewMultiaddrBytes(d)
+		if err != nil {
+			s.logger.Debugf("handshake: skipping malformed underlay from peer %s: %v", peerID, err)
+			continue
+		}
+		underlays = append(underlays, u)
+	}
+	return underlays
+}
+
+// negotiateMessageSize returns the lower of the maximal message sizes of this
+// node and the peer. Peers which do not advertise the size send zero and the
+// local size is used for them.
+func (s *Service) negotiateMessageSize(remoteMaxMessageSize uint32) uint32 {
+	if remoteMaxMessageSize == 0 || remoteMaxMessageSize > s.maxMessageSize {
+		return s.maxMessageSize
+	}
+	return remoteMaxMessageSize
+}
+
+// negotiateCompression returns the first codec of the node that handles the
+// handshake which is supported by the initiator as well, so that both sides
+// choose the same one. If there is no such codec, which is the case for peers
+// that do not advertise any, CompressionNone is returned instead of failing
+// the handshake.
+func negotiateCompression(handler, initiator []pb.Compression) Compression {
+	for _, h := range handler {
+		for _, i := range initiator {
+			if h == i {
+				return Compression(h)
+			}
+		}
+	}
+	return CompressionNone
+}
+
+// parseObservedUnderlay parses the underlay of this node as observed by the
+// peer. It has to start with an IPv4, IPv6 or DNS address, as otherwise it
+// can not be advertised. The zone of a link-local IPv6 address, as in
+// /ip6zone/eth0/ip6/fe80::1, is kept. ErrInvalidObservedUnderlay is returned
+// for malformed underlays.
+func parseObservedUnderlay(data []byte) (ma.Multiaddr, error) {
+	addr, err := ma.NewMultiaddrBytes(data)
+	if err != nil {
+		return nil, ErrInvalidObservedUnderlay
+	}
+
+	protocols := addr.Protocols()
+	if len(protocols) > 1 && protocols[0].Code == ma.P_IP6ZONE {
+		protocols = protocols[1:]
+		if protocols[0].Code != ma.P_IP6 {
+			return nil, ErrInvalidObservedUnderlay
+		}
+	}
+	if len(protocols) == 0 {
+		return nil, ErrInvalidObservedUnderlay
+	}
+	switch protocols[0].Code {
+	case ma.P_IP4, ma.P_IP6, ma.P_DNS, ma.P_DNS4, ma.P_DNS6, ma.P_DNSADDR:
+		return addr, nil
+	}
+	return nil, ErrInvalidObservedUnderlay
+}
+
+// validateMessage rejects the handshake messages which lack the nested
+// messages that are accessed when they are handled, so that malformed
+// messages are not dereferenced.
+func validateMessage(m protobuf.Message) error {
+	switch m := m.(type) {
+	case *pb.SynAck:
+		if m.Syn == nil || m.Ack == nil {
+			return ErrInvalidAck
+		}
+		// only the ack of a synack may tell to try again later, without an
+		// address
+		if m.Ack.Address == nil && m.Ack.RetryAfterSeconds == 0 {
+			return ErrInvalidRemoteAddress
+		}
+	case *pb.Ack:
+		if m.Address == nil {
+			return ErrInvalidRemoteAddress
+		}
+	}
+	return nil
+}
+
 func buildFullMA(addr ma.Multiaddr, peerID libp2ppeer.ID) (ma.Multiaddr, error) {
 	return ma.NewMultiaddr(fmt.Sprintf("%s/p2p/%s", addr.String(), peerID.Pretty()))
 }
 
 func (s *Service) parseCheckAck(ack *pb.Ack) (*bzz.Address, error) {
+	if ack.Address == nil {
+		return nil, ErrInvalidRemoteAddress
+	}
+
 	if ack.NetworkID != s.networkID {
-		return nil, ErrNetworkIDIncompatible
+		s.metrics.NetworkIDMismatchCount.Inc()
+		return nil, &NetworkIDMismatchError{Local: s.networkID, Remote: ack.NetworkID}
+	}
+
+	if len(ack.Address.Underlay) == 0 || len(ack.Address.Overlay) != swarm.HashSize {
+		return nil, ErrInvalidRemoteAddress
 	}
 
 	bzzAddress, err := bzz.ParseAddress(ack.Address.Underlay, ack.Address.Overlay, ack.Address.Signature, s.networkID)
@@ -334,5 +1284,109 @@ func (s *Service) parseCheckAck(ack *pb.Ack) (*bzz.Address, error) {
 		return nil, ErrInvalidAck
 	}
 
+	if bzzAddress.Overlay.Equal(s.overlay) {
+		return nil, ErrSelfConnection
+	}
+
 	return bzzAddress, nil
 }
+
+// verifySignature checks if the ack signature is created by the owner of the
+// overlay address advertised by the peer over its nonce, the challenge sent
+// to it and the protocol versions, timestamp and capabilities in the ack.
+func (s *Service) verifySignature(overlay swarm.Address, ack *pb.Ack, challenge []byte) error {
+	if len(ack.Nonce) != nonceSize {
+		return ErrInvalidHandshakeSignature
+	}
+
+	recoveredPK, err := crypto.Recover(ack.Signature, signData(s.networkID, overlay, ack.Nonce, challenge, ack.MaxProtocolVersion, ack.ProtocolVersion, ack.Timestamp, ack.Capabilities))
+	if err != nil {
+		return ErrInvalidHandshakeSignature
+	}
+
+	recoveredOverlay, err := crypto.NewOverlayAddress(*recoveredPK, s.networkID)
+	if err != nil {
+		return ErrInvalidHandshakeSignature
+	}
+
+	if !recoveredOverlay.Equal(overlay) {
+		return ErrInvalidHandshakeSignature
+	}
+
+	return nil
+}
+
+// seenNonce is a nonce of an initiator and the time it was seen.
+type seenNonce struct {
+	nonce string
+	seen  time.Time
+}
+
+// recordNonce records the nonce of the initiator and returns false if it was
+// already used within the replay window. The nonces are kept in the order
+// they were seen, so only the expired ones at the front are visited. If there
+// are more than the maximal number of nonces, the oldest ones are forgotten
+// early. The signature over the challenge still prevents their replay.
+func (s *Service) recordNonce(nonce []byte) bool {
+	s.seenNoncesMu.Lock()
+	defer s.seenNoncesMu.Unlock()
+
+	now := timeNow()
+	for len(s.seenNoncesQueue) > 0 && now.Sub(s.seenNoncesQueue[0].seen) > nonceReplayWindow {
+		s.forgetOldestNonce()
+	}
+
+	if _, ok := s.seenNonces[string(nonce)]; ok {
+		return false
+	}
+	for len(s.seenNoncesQueue) > 0 && len(s.seenNoncesQueue) >= s.maxSeenNonces {
+		s.forgetOldestNonce()
+	}
+	s.seenNonces[string(nonce)] = struct{}{}
+	s.seenNoncesQueue = append(s.seenNoncesQueue, seenNonce{nonce: string(nonce), seen: now})
+	return true
+}
+
+// forgetOldestNonce removes the nonce which was seen first. It must be called
+// with the lock held.
+func (s *Service) forgetOldestNonce() {
+	delete(s.seenNonces, s.seenNoncesQueue[0].nonce)
+	s.seenNoncesQueue = s.seenNoncesQueue[1:]
+}
+
+// signData returns the data signed by the initiator of the handshake
+// to prove the ownership of its overlay address. The challenge is the
+// nonce received from the responder, so the signature can not be replayed.
+// The highest version advertised in the syn, the negotiated version and the
+// capabilities of the initiator are signed as well, so that they can not be
+// altered to downgrade the protocol. The timestamp, in unix seconds, limits
+// the time for which the signature is accepted.
+func signData(networkID uint64, overlay swarm.Address, nonce, challenge []byte, maxVersion, version uint32, timestamp int64, capabilities []string) []byte {
+	networkIDBytes := make([]byte, 8)
+	binary.BigEndian.PutUint64(networkIDBytes, networkID)
+	data := append([]byte("bee-handshake-ack-"), networkIDBytes...)
+	data = append(data, overlay.Bytes()...)
+	data = append(data, nonce...)
+	data = append(data, challenge...)
+
+	versionBytes := make([]byte, 4)
+	binary.BigEndian.PutUint32(versionBytes, maxVersion)
+	data = append(data, versionBytes...)
+	binary.BigEndian.PutUint32(versionBytes, version)
+	data = append(data, versionBytes...)
+
+	timestampBytes := make([]byte, 8)
+	binary.BigEndian.PutUint64(timestampBytes, uint64(timestamp))
+	data = append(data, timestampBytes...)
+
+	// capabilities are length prefixed to keep the encoding unambiguous
+	lengthBytes := make([]byte, 4)
+	binary.BigEndian.PutUint32(lengthBytes, uint32(len(capabilities)))
+	data = append(data, lengthBytes...)
+	for _, c := range capabilities {
+		binary.BigEndian.PutUint32(lengthBytes, uint32(len(c)))
+		data = append(data, lengthBytes...)
+		data = append(data, c...)
+	}
+	return data
+}
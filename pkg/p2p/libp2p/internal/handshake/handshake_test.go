@@ -7,22 +7,33 @@ package handshake_test
 import (
 	"bytes"
 	"context"
+	"crypto/rand"
 	"errors"
 	"fmt"
+	"io"
 	"io/ioutil"
+	"reflect"
+	"strings"
+	"sync"
 	"testing"
+	"time"
 
 	"github.com/ethersphere/bee/pkg/bzz"
 	"github.com/ethersphere/bee/pkg/crypto"
 	"github.com/ethersphere/bee/pkg/logging"
+	"github.com/ethersphere/bee/pkg/p2p"
 	"github.com/ethersphere/bee/pkg/p2p/libp2p/internal/handshake"
-	"github.com/ethersphere/bee/pkg/p2p/libp2p/internal/handshake/mock"
+	"github.com/ethersphere/bee/pkg/p2p/libp2p/internal/handshake/handshaketest"
 	"github.com/ethersphere/bee/pkg/p2p/libp2p/internal/handshake/pb"
+	"github.com/ethersphere/bee/pkg/p2p/p2ptest"
 	"github.com/ethersphere/bee/pkg/p2p/protobuf"
 	"github.com/ethersphere/bee/pkg/swarm"
 
+	libp2pcrypto "github.com/libp2p/go-libp2p-core/crypto"
 	libp2ppeer "github.com/libp2p/go-libp2p-core/peer"
 	ma "github.com/multiformats/go-multiaddr"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/sirupsen/logrus"
 )
 
 func TestHandshake(t *testing.T) {
@@ -82,19 +93,34 @@ func TestHandshake(t *testing.T) {
 		t.Fatal(err)
 	}
 
+	nonce := make([]byte, 32)
+	challenge := bytes.Repeat([]byte{1}, 32)
+	timestamp := time.Now().Unix()
+	handshake.SetChallengeFunc(func(b []byte) (int, error) {
+		return copy(b, challenge), nil
+	})
+	defer handshake.SetChallengeFunc(rand.Read)
+
+	node2AckSignature, err := signer2.Sign(handshake.SignData(networkID, node2BzzAddress.Overlay, nonce, challenge, handshake.MaxSupportedVersion, handshake.MaxSupportedVersion, timestamp, nil))
+	if err != nil {
+		t.Fatal(err)
+	}
+
 	node1Info := handshake.Info{
-		BzzAddress: node1BzzAddress,
-		FullNode:   true,
+		BzzAddress:      node1BzzAddress,
+		FullNode:        true,
+		ProtocolVersion: handshake.MaxSupportedVersion,
 	}
 	node2Info := handshake.Info{
-		BzzAddress: node2BzzAddress,
-		FullNode:   true,
+		BzzAddress:      node2BzzAddress,
+		FullNode:        true,
+		ProtocolVersion: handshake.MaxSupportedVersion,
 	}
 
 	aaddresser := &AdvertisableAddresserMock{}
 	senderMatcher := &MockSenderMatcher{v: true}
 
-	handshakeService, err := handshake.New(signer1, aaddresser, senderMatcher, node1Info.BzzAddress.Overlay, networkID, true, nil, testWelcomeMessage, logger)
+	handshakeService, err := handshake.New(signer1, aaddresser, senderMatcher, node1Info.BzzAddress.Overlay, networkID, handshake.MinSupportedVersion, handshake.MaxSupportedVersion, true, nil, nil, testWelcomeMessage, logger)
 	if err != nil {
 		t.Fatal(err)
 	}
@@ -102,8 +128,8 @@ func TestHandshake(t *testing.T) {
 	t.Run("Handshake - OK", func(t *testing.T) {
 		var buffer1 bytes.Buffer
 		var buffer2 bytes.Buffer
-		stream1 := mock.NewStream(&buffer1, &buffer2)
-		stream2 := mock.NewStream(&buffer2, &buffer1)
+		stream1 := p2ptest.NewStream(&buffer1, &buffer2)
+		stream2 := p2ptest.NewStream(&buffer2, &buffer1)
 
 		w, r := protobuf.NewWriterAndReader(stream2)
 		if err := w.WriteMsg(&pb.SynAck{
@@ -116,9 +142,11 @@ func TestHandshake(t *testing.T) {
 					Overlay:   node2BzzAddress.Overlay.Bytes(),
 					Signature: node2BzzAddress.Signature,
 				},
-				NetworkID:      networkID,
-				FullNode:       true,
-				WelcomeMessage: testWelcomeMessage,
+				NetworkID:       networkID,
+				FullNode:        true,
+				ProtocolVersion: handshake.MaxSupportedVersion,
+				Nonce:           challenge,
+				WelcomeMessage:  testWelcomeMessage,
 			},
 		}); err != nil {
 			t.Fatal(err)
@@ -131,6 +159,10 @@ func TestHandshake(t *testing.T) {
 
 		testInfo(t, *res, node2Info)
 
+		if !res.ObservedUnderlay.Equal(node1ma) {
+			t.Fatalf("got observed underlay %s, want %s", res.ObservedUnderlay, node1ma)
+		}
+
 		var syn pb.Syn
 		if err := r.ReadMsg(&syn); err != nil {
 			t.Fatal(err)
@@ -156,81 +188,267 @@ func TestHandshake(t *testing.T) {
 		if ack.WelcomeMessage != testWelcomeMessage {
 			t.Fatalf("Bad ack welcome message: want %s, got %s", testWelcomeMessage, ack.WelcomeMessage)
 		}
-	})
 
-	t.Run("Handshake - welcome message too long", func(t *testing.T) {
-		const LongMessage = "Lorem ipsum dolor sit amet, consectetur adipiscing elit. Morbi consectetur urna ut lorem sollicitudin posuere. Donec sagittis laoreet sapien."
+		recoveredPK, err := crypto.Recover(ack.Signature, handshake.SignData(networkID, node1BzzAddress.Overlay, ack.Nonce, challenge, handshake.MaxSupportedVersion, handshake.MaxSupportedVersion, ack.Timestamp, nil))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !recoveredPK.Equal(&privateKey1.PublicKey) {
+			t.Fatal("bad ack signature")
+		}
 
-		expectedErr := handshake.ErrWelcomeMessageLength
-		_, err := handshake.New(signer1, aaddresser, senderMatcher, node1Info.BzzAddress.Overlay, networkID, true, nil, LongMessage, logger)
-		if err == nil || err.Error() != expectedErr.Error() {
-			t.Fatal("expected:", expectedErr, "got:", err)
+		if stream1.IsReset() {
+			t.Fatal("stream is reset after a successful handshake")
 		}
 	})
 
-	t.Run("Handshake - dynamic welcome message too long", func(t *testing.T) {
-		const LongMessage = "Lorem ipsum dolor sit amet, consectetur adipiscing elit. Morbi consectetur urna ut lorem sollicitudin posuere. Donec sagittis laoreet sapien."
+	t.Run("Handshake - RTT", func(t *testing.T) {
+		var buffer1 bytes.Buffer
+		var buffer2 bytes.Buffer
+		delay := 50 * time.Millisecond
+		stream1 := &delayedStream{Stream: p2ptest.NewStream(&buffer1, &buffer2), delay: delay}
+		stream2 := p2ptest.NewStream(&buffer2, &buffer1)
 
-		expectedErr := handshake.ErrWelcomeMessageLength
-		err := handshakeService.SetWelcomeMessage(LongMessage)
-		if err == nil || err.Error() != expectedErr.Error() {
-			t.Fatal("expected:", expectedErr, "got:", err)
+		w := protobuf.NewWriter(stream2)
+		if err := w.WriteMsg(&pb.SynAck{
+			Syn: &pb.Syn{
+				ObservedUnderlay: node1maBinary,
+			},
+			Ack: &pb.Ack{
+				Address: &pb.BzzAddress{
+					Underlay:  node2maBinary,
+					Overlay:   node2BzzAddress.Overlay.Bytes(),
+					Signature: node2BzzAddress.Signature,
+				},
+				NetworkID:       networkID,
+				FullNode:        true,
+				ProtocolVersion: handshake.MaxSupportedVersion,
+				Nonce:           challenge,
+			},
+		}); err != nil {
+			t.Fatal(err)
+		}
+
+		start := time.Now()
+		res, err := handshakeService.Handshake(context.Background(), stream1, node2AddrInfo.Addrs[0], node2AddrInfo.ID)
+		if err != nil {
+			t.Fatal(err)
+		}
+		elapsed := time.Since(start)
+
+		if res.RTT < delay || res.RTT > elapsed {
+			t.Fatalf("got rtt %s, want between %s and %s", res.RTT, delay, elapsed)
 		}
 	})
 
-	t.Run("Handshake - set welcome message", func(t *testing.T) {
-		const TestMessage = "Hi im the new test message"
+	t.Run("Handshake and Handle - OK over pipe", func(t *testing.T) {
+		node1AddrInfo, err := libp2ppeer.AddrInfoFromP2pAddr(node1ma)
+		if err != nil {
+			t.Fatal(err)
+		}
+		handshakeService2, err := handshake.New(signer2, aaddresser, senderMatcher, node2Info.BzzAddress.Overlay, networkID, handshake.MinSupportedVersion, handshake.MaxSupportedVersion, true, nil, nil, "", logger)
+		if err != nil {
+			t.Fatal(err)
+		}
 
-		err := handshakeService.SetWelcomeMessage(TestMessage)
+		stream1, stream2 := handshaketest.NewPipe()
+		defer stream1.Close()
+		defer stream2.Close()
+
+		type result struct {
+			info *handshake.Info
+			err  error
+		}
+		handled := make(chan result, 1)
+		go func() {
+			info, err := handshakeService2.Handle(context.Background(), stream2, node1AddrInfo.Addrs[0], node1AddrInfo.ID)
+			handled <- result{info: info, err: err}
+		}()
+
+		res, err := handshakeService.Handshake(context.Background(), stream1, node2AddrInfo.Addrs[0], node2AddrInfo.ID)
 		if err != nil {
-			t.Fatal("Got error:", err)
+			t.Fatal(err)
 		}
-		got := handshakeService.GetWelcomeMessage()
-		if got != TestMessage {
-			t.Fatal("expected:", TestMessage, ", got:", got)
+		testInfo(t, *res, node2Info)
+
+		r := <-handled
+		if r.err != nil {
+			t.Fatal(r.err)
+		}
+		testInfo(t, *r.info, node1Info)
+		if r.info.WelcomeMessage != testWelcomeMessage {
+			t.Fatalf("got welcome message %q, want %q", r.info.WelcomeMessage, testWelcomeMessage)
 		}
 	})
 
-	t.Run("Handshake - Syn write error", func(t *testing.T) {
-		testErr := errors.New("test error")
-		expectedErr := fmt.Errorf("write syn message: %w", testErr)
-		stream := &mock.Stream{}
-		stream.SetWriteErr(testErr, 0)
-		res, err := handshakeService.Handshake(context.Background(), stream, node2AddrInfo.Addrs[0], node2AddrInfo.ID)
-		if err == nil || err.Error() != expectedErr.Error() {
-			t.Fatal("expected:", expectedErr, "got:", err)
+	t.Run("Handshake and Handle - max message size", func(t *testing.T) {
+		node1AddrInfo, err := libp2ppeer.AddrInfoFromP2pAddr(node1ma)
+		if err != nil {
+			t.Fatal(err)
 		}
 
-		if res != nil {
-			t.Fatal("handshake returned non-nil res")
+		for _, tc := range []struct {
+			name      string
+			initiator []handshake.Option
+			responder []handshake.Option
+			want      uint32
+		}{
+			{
+				name: "default",
+				want: protobuf.DefaultMaxMessageSize,
+			},
+			{
+				name:      "lower initiator",
+				initiator: []handshake.Option{handshake.WithMaxMessageSize(1024)},
+				responder: []handshake.Option{handshake.WithMaxMessageSize(2048)},
+				want:      1024,
+			},
+			{
+				name:      "lower responder",
+				initiator: []handshake.Option{handshake.WithMaxMessageSize(2048)},
+				responder: []handshake.Option{handshake.WithMaxMessageSize(1024)},
+				want:      1024,
+			},
+		} {
+			t.Run(tc.name, func(t *testing.T) {
+				initiator, err := handshake.New(signer1, aaddresser, senderMatcher, node1Info.BzzAddress.Overlay, networkID, handshake.MinSupportedVersion, handshake.MaxSupportedVersion, true, nil, nil, "", logger, tc.initiator...)
+				if err != nil {
+					t.Fatal(err)
+				}
+				responder, err := handshake.New(signer2, aaddresser, senderMatcher, node2Info.BzzAddress.Overlay, networkID, handshake.MinSupportedVersion, handshake.MaxSupportedVersion, true, nil, nil, "", logger, tc.responder...)
+				if err != nil {
+					t.Fatal(err)
+				}
+
+				stream1, stream2 := handshaketest.NewPipe()
+				defer stream1.Close()
+				defer stream2.Close()
+
+				type result struct {
+					info *handshake.Info
+					err  error
+				}
+				handled := make(chan result, 1)
+				go func() {
+					info, err := responder.Handle(context.Background(), stream2, node1AddrInfo.Addrs[0], node1AddrInfo.ID)
+					handled <- result{info: info, err: err}
+				}()
+
+				res, err := initiator.Handshake(context.Background(), stream1, node2AddrInfo.Addrs[0], node2AddrInfo.ID)
+				if err != nil {
+					t.Fatal(err)
+				}
+				r := <-handled
+				if r.err != nil {
+					t.Fatal(r.err)
+				}
+
+				if res.MaxMessageSize != tc.want {
+					t.Errorf("got initiator max message size %d, want %d", res.MaxMessageSize, tc.want)
+				}
+				if r.info.MaxMessageSize != tc.want {
+					t.Errorf("got responder max message size %d, want %d", r.info.MaxMessageSize, tc.want)
+				}
+			})
 		}
 	})
 
-	t.Run("Handshake - Syn read error", func(t *testing.T) {
-		testErr := errors.New("test error")
-		expectedErr := fmt.Errorf("read synack message: %w", testErr)
-		stream := mock.NewStream(nil, &bytes.Buffer{})
-		stream.SetReadErr(testErr, 0)
-		res, err := handshakeService.Handshake(context.Background(), stream, node2AddrInfo.Addrs[0], node2AddrInfo.ID)
-		if err == nil || err.Error() != expectedErr.Error() {
-			t.Fatal("expected:", expectedErr, "got:", err)
+	t.Run("Handshake and Handle - compression", func(t *testing.T) {
+		node1AddrInfo, err := libp2ppeer.AddrInfoFromP2pAddr(node1ma)
+		if err != nil {
+			t.Fatal(err)
 		}
 
-		if res != nil {
-			t.Fatal("handshake returned non-nil res")
+		for _, tc := range []struct {
+			name      string
+			initiator []handshake.Option
+			responder []handshake.Option
+			want      handshake.Compression
+		}{
+			{
+				name: "default",
+				want: handshake.CompressionNone,
+			},
+			{
+				name:      "initiator supports only none",
+				initiator: []handshake.Option{handshake.WithCompressions(handshake.CompressionNone)},
+				responder: []handshake.Option{handshake.WithCompressions(handshake.CompressionSnappy, handshake.CompressionGzip)},
+				want:      handshake.CompressionNone,
+			},
+			{
+				name:      "responder supports only none",
+				initiator: []handshake.Option{handshake.WithCompressions(handshake.CompressionSnappy, handshake.CompressionGzip)},
+				responder: []handshake.Option{handshake.WithCompressions(handshake.CompressionNone)},
+				want:      handshake.CompressionNone,
+			},
+			{
+				name:      "common codec",
+				initiator: []handshake.Option{handshake.WithCompressions(handshake.CompressionGzip)},
+				responder: []handshake.Option{handshake.WithCompressions(handshake.CompressionSnappy, handshake.CompressionGzip)},
+				want:      handshake.CompressionGzip,
+			},
+			{
+				name:      "responder preference",
+				initiator: []handshake.Option{handshake.WithCompressions(handshake.CompressionGzip, handshake.CompressionSnappy)},
+				responder: []handshake.Option{handshake.WithCompressions(handshake.CompressionSnappy, handshake.CompressionGzip)},
+				want:      handshake.CompressionSnappy,
+			},
+		} {
+			t.Run(tc.name, func(t *testing.T) {
+				initiator, err := handshake.New(signer1, aaddresser, senderMatcher, node1Info.BzzAddress.Overlay, networkID, handshake.MinSupportedVersion, handshake.MaxSupportedVersion, true, nil, nil, "", logger, tc.initiator...)
+				if err != nil {
+					t.Fatal(err)
+				}
+				responder, err := handshake.New(signer2, aaddresser, senderMatcher, node2Info.BzzAddress.Overlay, networkID, handshake.MinSupportedVersion, handshake.MaxSupportedVersion, true, nil, nil, "", logger, tc.responder...)
+				if err != nil {
+					t.Fatal(err)
+				}
+
+				stream1, stream2 := handshaketest.NewPipe()
+				defer stream1.Close()
+				defer stream2.Close()
+
+				type result struct {
+					info *handshake.Info
+					err  error
+				}
+				handled := make(chan result, 1)
+				go func() {
+					info, err := responder.Handle(context.Background(), stream2, node1AddrInfo.Addrs[0], node1AddrInfo.ID)
+					handled <- result{info: info, err: err}
+				}()
+
+				res, err := initiator.Handshake(context.Background(), stream1, node2AddrInfo.Addrs[0], node2AddrInfo.ID)
+				if err != nil {
+					t.Fatal(err)
+				}
+				r := <-handled
+				if r.err != nil {
+					t.Fatal(r.err)
+				}
+
+				if res.Compression != tc.want {
+					t.Errorf("got initiator compression %v, want %v", res.Compression, tc.want)
+				}
+				if r.info.Compression != tc.want {
+					t.Errorf("got responder compression %v, want %v", r.info.Compression, tc.want)
+				}
+			})
 		}
 	})
 
-	t.Run("Handshake - ack write error", func(t *testing.T) {
-		testErr := errors.New("test error")
-		expectedErr := fmt.Errorf("write ack message: %w", testErr)
+	t.Run("Handshake - capabilities", func(t *testing.T) {
+		capabilities := []string{"pricing", "pushsync/2"}
+		handshakeService, err := handshake.New(signer1, aaddresser, senderMatcher, node1Info.BzzAddress.Overlay, networkID, handshake.MinSupportedVersion, handshake.MaxSupportedVersion, true, nil, capabilities, "", logger)
+		if err != nil {
+			t.Fatal(err)
+		}
 		var buffer1 bytes.Buffer
 		var buffer2 bytes.Buffer
-		stream1 := mock.NewStream(&buffer1, &buffer2)
-		stream1.SetWriteErr(testErr, 1)
-		stream2 := mock.NewStream(&buffer2, &buffer1)
+		stream1 := p2ptest.NewStream(&buffer1, &buffer2)
+		stream2 := p2ptest.NewStream(&buffer2, &buffer1)
 
-		w := protobuf.NewWriter(stream2)
+		w, r := protobuf.NewWriterAndReader(stream2)
 		if err := w.WriteMsg(&pb.SynAck{
 			Syn: &pb.Syn{
 				ObservedUnderlay: node1maBinary,
@@ -241,31 +459,50 @@ func TestHandshake(t *testing.T) {
 					Overlay:   node2BzzAddress.Overlay.Bytes(),
 					Signature: node2BzzAddress.Signature,
 				},
-				NetworkID: networkID,
-				FullNode:  true,
+				NetworkID:       networkID,
+				FullNode:        true,
+				ProtocolVersion: handshake.MaxSupportedVersion,
+				Capabilities:    []string{"pricing"},
 			},
-		},
-		); err != nil {
+		}); err != nil {
 			t.Fatal(err)
 		}
 
 		res, err := handshakeService.Handshake(context.Background(), stream1, node2AddrInfo.Addrs[0], node2AddrInfo.ID)
-		if err == nil || err.Error() != expectedErr.Error() {
-			t.Fatal("expected:", expectedErr, "got:", err)
+		if err != nil {
+			t.Fatal(err)
 		}
 
-		if res != nil {
-			t.Fatal("handshake returned non-nil res")
+		if !reflect.DeepEqual(res.Capabilities, []string{"pricing"}) {
+			t.Fatalf("got capabilities %v, want %v", res.Capabilities, []string{"pricing"})
+		}
+
+		var syn pb.Syn
+		if err := r.ReadMsg(&syn); err != nil {
+			t.Fatal(err)
+		}
+
+		var ack pb.Ack
+		if err := r.ReadMsg(&ack); err != nil {
+			t.Fatal(err)
+		}
+
+		if !reflect.DeepEqual(ack.Capabilities, capabilities) {
+			t.Fatalf("got ack capabilities %v, want %v", ack.Capabilities, capabilities)
 		}
 	})
 
-	t.Run("Handshake - networkID mismatch", func(t *testing.T) {
+	t.Run("Handshake - welcome message and block height", func(t *testing.T) {
+		handshakeService, err := handshake.New(signer1, aaddresser, senderMatcher, node1Info.BzzAddress.Overlay, networkID, handshake.MinSupportedVersion, handshake.MaxSupportedVersion, true, nil, nil, testWelcomeMessage, logger, handshake.WithBlockHeight(42))
+		if err != nil {
+			t.Fatal(err)
+		}
 		var buffer1 bytes.Buffer
 		var buffer2 bytes.Buffer
-		stream1 := mock.NewStream(&buffer1, &buffer2)
-		stream2 := mock.NewStream(&buffer2, &buffer1)
+		stream1 := p2ptest.NewStream(&buffer1, &buffer2)
+		stream2 := p2ptest.NewStream(&buffer2, &buffer1)
 
-		w := protobuf.NewWriter(stream2)
+		w, r := protobuf.NewWriterAndReader(stream2)
 		if err := w.WriteMsg(&pb.SynAck{
 			Syn: &pb.Syn{
 				ObservedUnderlay: node1maBinary,
@@ -276,73 +513,70 @@ func TestHandshake(t *testing.T) {
 					Overlay:   node2BzzAddress.Overlay.Bytes(),
 					Signature: node2BzzAddress.Signature,
 				},
-				NetworkID: 5,
-				FullNode:  true,
+				NetworkID:       networkID,
+				FullNode:        true,
+				ProtocolVersion: handshake.MaxSupportedVersion,
+				WelcomeMessage:  "hello from node2",
+				BlockHeight:     100,
 			},
 		}); err != nil {
 			t.Fatal(err)
 		}
 
 		res, err := handshakeService.Handshake(context.Background(), stream1, node2AddrInfo.Addrs[0], node2AddrInfo.ID)
-		if res != nil {
-			t.Fatal("res should be nil")
+		if err != nil {
+			t.Fatal(err)
 		}
 
-		if err != handshake.ErrNetworkIDIncompatible {
-			t.Fatalf("expected %s, got %s", handshake.ErrNetworkIDIncompatible, err)
+		if res.WelcomeMessage != "hello from node2" {
+			t.Fatalf("got welcome message %q, want %q", res.WelcomeMessage, "hello from node2")
+		}
+		if res.BlockHeight != 100 {
+			t.Fatalf("got block height %d, want %d", res.BlockHeight, 100)
 		}
-	})
 
-	t.Run("Handshake - invalid ack", func(t *testing.T) {
-		var buffer1 bytes.Buffer
-		var buffer2 bytes.Buffer
-		stream1 := mock.NewStream(&buffer1, &buffer2)
-		stream2 := mock.NewStream(&buffer2, &buffer1)
+		var syn pb.Syn
+		if err := r.ReadMsg(&syn); err != nil {
+			t.Fatal(err)
+		}
 
-		w := protobuf.NewWriter(stream2)
-		if err := w.WriteMsg(&pb.SynAck{
-			Syn: &pb.Syn{
-				ObservedUnderlay: node1maBinary,
-			},
-			Ack: &pb.Ack{
-				Address: &pb.BzzAddress{
-					Underlay:  node2maBinary,
-					Overlay:   node2BzzAddress.Overlay.Bytes(),
-					Signature: node1BzzAddress.Signature,
-				},
-				NetworkID: networkID,
-				FullNode:  true,
-			},
-		}); err != nil {
+		var ack pb.Ack
+		if err := r.ReadMsg(&ack); err != nil {
 			t.Fatal(err)
 		}
 
-		res, err := handshakeService.Handshake(context.Background(), stream1, node2AddrInfo.Addrs[0], node2AddrInfo.ID)
-		if res != nil {
-			t.Fatal("res should be nil")
+		if ack.WelcomeMessage != testWelcomeMessage {
+			t.Fatalf("got ack welcome message %q, want %q", ack.WelcomeMessage, testWelcomeMessage)
+		}
+		if ack.BlockHeight != 42 {
+			t.Fatalf("got ack block height %d, want %d", ack.BlockHeight, 42)
 		}
+	})
 
-		if err != handshake.ErrInvalidAck {
-			t.Fatalf("expected %s, got %s", handshake.ErrInvalidAck, err)
+	t.Run("Handshake - set block height", func(t *testing.T) {
+		handshakeService, err := handshake.New(signer1, aaddresser, senderMatcher, node1Info.BzzAddress.Overlay, networkID, handshake.MinSupportedVersion, handshake.MaxSupportedVersion, true, nil, nil, "", logger)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got := handshakeService.GetBlockHeight(); got != 0 {
+			t.Fatalf("got block height %d, want 0", got)
+		}
+		handshakeService.SetBlockHeight(7)
+		if got := handshakeService.GetBlockHeight(); got != 7 {
+			t.Fatalf("got block height %d, want 7", got)
 		}
 	})
 
-	t.Run("Handshake - error advertisable address", func(t *testing.T) {
+	t.Run("Handshake - invalid observed underlay", func(t *testing.T) {
 		var buffer1 bytes.Buffer
 		var buffer2 bytes.Buffer
-		stream1 := mock.NewStream(&buffer1, &buffer2)
-		stream2 := mock.NewStream(&buffer2, &buffer1)
-
-		testError := errors.New("test error")
-		aaddresser.err = testError
-		defer func() {
-			aaddresser.err = nil
-		}()
+		stream1 := p2ptest.NewStream(&buffer1, &buffer2)
+		stream2 := p2ptest.NewStream(&buffer2, &buffer1)
 
-		w, _ := protobuf.NewWriterAndReader(stream2)
+		w := protobuf.NewWriter(stream2)
 		if err := w.WriteMsg(&pb.SynAck{
 			Syn: &pb.Syn{
-				ObservedUnderlay: node1maBinary,
+				ObservedUnderlay: []byte("invalid"),
 			},
 			Ack: &pb.Ack{
 				Address: &pb.BzzAddress{
@@ -350,182 +584,2178 @@ func TestHandshake(t *testing.T) {
 					Overlay:   node2BzzAddress.Overlay.Bytes(),
 					Signature: node2BzzAddress.Signature,
 				},
-				NetworkID: networkID,
-				FullNode:  true,
+				NetworkID:       networkID,
+				FullNode:        true,
+				ProtocolVersion: handshake.MaxSupportedVersion,
 			},
 		}); err != nil {
 			t.Fatal(err)
 		}
 
 		res, err := handshakeService.Handshake(context.Background(), stream1, node2AddrInfo.Addrs[0], node2AddrInfo.ID)
-		if err != testError {
-			t.Fatalf("expected error %v got %v", testError, err)
-
+		if res != nil {
+			t.Fatal("res should be nil")
 		}
 
-		if res != nil {
-			t.Fatal("expected nil res")
+		if err != handshake.ErrInvalidObservedUnderlay {
+			t.Fatalf("expected %s, got %s", handshake.ErrInvalidObservedUnderlay, err)
 		}
 
+		if !stream1.IsReset() {
+			t.Fatal("stream is not reset")
+		}
 	})
 
-	t.Run("Handle - OK", func(t *testing.T) {
-		handshakeService, err := handshake.New(signer1, aaddresser, senderMatcher, node1Info.BzzAddress.Overlay, networkID, true, nil, "", logger)
+	t.Run("Handshake and Handle - observed underlay", func(t *testing.T) {
+		node1AddrInfo, err := libp2ppeer.AddrInfoFromP2pAddr(node1ma)
 		if err != nil {
 			t.Fatal(err)
 		}
-		var buffer1 bytes.Buffer
-		var buffer2 bytes.Buffer
-		stream1 := mock.NewStream(&buffer1, &buffer2)
-		stream2 := mock.NewStream(&buffer2, &buffer1)
-
-		w := protobuf.NewWriter(stream2)
-		if err := w.WriteMsg(&pb.Syn{
-			ObservedUnderlay: node1maBinary,
-		}); err != nil {
-			t.Fatal(err)
+		mustMultiaddrBytes := func(t *testing.T, s string) []byte {
+			t.Helper()
+			addr, err := ma.NewMultiaddr(s)
+			if err != nil {
+				t.Fatal(err)
+			}
+			return addr.Bytes()
+		}
+
+		for _, tc := range []struct {
+			name    string
+			addr    string
+			invalid []byte
+		}{
+			{
+				name: "ipv4",
+				addr: "/ip4/127.0.0.1/tcp/1634",
+			},
+			{
+				name: "ipv6",
+				addr: "/ip6/2001:db8::1/tcp/1634",
+			},
+			{
+				name: "ipv6 with zone",
+				addr: "/ip6zone/eth0/ip6/fe80::1/tcp/1634",
+			},
+			{
+				name: "dns",
+				addr: "/dns/example.com/tcp/1634",
+			},
+			{
+				name: "dns4",
+				addr: "/dns4/example.com/tcp/1634",
+			},
+			{
+				name:    "garbage",
+				invalid: []byte("invalid"),
+			},
+			{
+				name:    "empty",
+				invalid: []byte{},
+			},
+			{
+				name:    "no address",
+				invalid: mustMultiaddrBytes(t, "/tcp/1634"),
+			},
+			{
+				name:    "zone without ipv6",
+				invalid: mustMultiaddrBytes(t, "/ip6zone/eth0/ip4/127.0.0.1/tcp/1634"),
+			},
+		} {
+			t.Run(tc.name, func(t *testing.T) {
+				responder, err := handshake.New(signer2, aaddresser, senderMatcher, node2Info.BzzAddress.Overlay, networkID, handshake.MinSupportedVersion, handshake.MaxSupportedVersion, true, nil, nil, "", logger)
+				if err != nil {
+					t.Fatal(err)
+				}
+
+				if tc.invalid != nil {
+					var buffer1 bytes.Buffer
+					var buffer2 bytes.Buffer
+					stream1 := p2ptest.NewStream(&buffer1, &buffer2)
+					stream2 := p2ptest.NewStream(&buffer2, &buffer1)
+
+					w := protobuf.NewWriter(stream2)
+					if err := w.WriteMsg(&pb.Syn{
+						ObservedUnderlay: tc.invalid,
+						ProtocolVersion:  handshake.MaxSupportedVersion,
+						NetworkID:        networkID,
+					}); err != nil {
+						t.Fatal(err)
+					}
+
+					if _, err := responder.Handle(context.Background(), stream1, node1AddrInfo.Addrs[0], node1AddrInfo.ID); !errors.Is(err, handshake.ErrInvalidObservedUnderlay) {
+						t.Fatalf("got error %v, want %v", err, handshake.ErrInvalidObservedUnderlay)
+					}
+					return
+				}
+
+				addr, err := ma.NewMultiaddr(tc.addr)
+				if err != nil {
+					t.Fatal(err)
+				}
+				initiator, err := handshake.New(signer1, aaddresser, senderMatcher, node1Info.BzzAddress.Overlay, networkID, handshake.MinSupportedVersion, handshake.MaxSupportedVersion, true, nil, nil, "", logger)
+				if err != nil {
+					t.Fatal(err)
+				}
+
+				stream1, stream2 := handshaketest.NewPipe()
+				defer stream1.Close()
+				defer stream2.Close()
+
+				type result struct {
+					info *handshake.Info
+					err  error
+				}
+				handled := make(chan result, 1)
+				go func() {
+					info, err := responder.Handle(context.Background(), stream2, addr, node1AddrInfo.ID)
+					handled <- result{info: info, err: err}
+				}()
+
+				res, err := initiator.Handshake(context.Background(), stream1, addr, node2AddrInfo.ID)
+				if err != nil {
+					t.Fatal(err)
+				}
+				r := <-handled
+				if r.err != nil {
+					t.Fatal(r.err)
+				}
+
+				// both sides observe the other one at addr
+				for _, c := range []struct {
+					got    ma.Multiaddr
+					peerID libp2ppeer.ID
+				}{
+					{got: res.ObservedUnderlay, peerID: node1AddrInfo.ID},
+					{got: r.info.ObservedUnderlay, peerID: node2AddrInfo.ID},
+				} {
+					want, err := ma.NewMultiaddr(tc.addr + "/p2p/" + c.peerID.Pretty())
+					if err != nil {
+						t.Fatal(err)
+					}
+					if !c.got.Equal(want) {
+						t.Fatalf("got observed underlay %s, want %s", c.got, want)
+					}
+				}
+			})
 		}
+	})
 
-		if err := w.WriteMsg(&pb.Ack{
-			Address: &pb.BzzAddress{
-				Underlay:  node2maBinary,
-				Overlay:   node2BzzAddress.Overlay.Bytes(),
-				Signature: node2BzzAddress.Signature,
-			},
-			NetworkID: networkID,
-			FullNode:  true,
-		}); err != nil {
-			t.Fatal(err)
+	t.Run("Handshake with retry - transient error", func(t *testing.T) {
+		testErr := errors.New("test error")
+		attempts := 0
+		newStream := func(context.Context) (p2p.Stream, error) {
+			attempts++
+			var buffer1 bytes.Buffer
+			var buffer2 bytes.Buffer
+			stream1 := p2ptest.NewStream(&buffer1, &buffer2)
+			stream2 := p2ptest.NewStream(&buffer2, &buffer1)
+			if attempts == 1 {
+				stream1.SetReadError(testErr, 0)
+				return stream1, nil
+			}
+
+			w := protobuf.NewWriter(stream2)
+			if err := w.WriteMsg(&pb.SynAck{
+				Syn: &pb.Syn{
+					ObservedUnderlay: node1maBinary,
+				},
+				Ack: &pb.Ack{
+					Address: &pb.BzzAddress{
+						Underlay:  node2maBinary,
+						Overlay:   node2BzzAddress.Overlay.Bytes(),
+						Signature: node2BzzAddress.Signature,
+					},
+					NetworkID:       networkID,
+					FullNode:        true,
+					ProtocolVersion: handshake.MaxSupportedVersion,
+				},
+			}); err != nil {
+				return nil, err
+			}
+			return stream1, nil
 		}
 
-		res, err := handshakeService.Handle(context.Background(), stream1, node2AddrInfo.Addrs[0], node2AddrInfo.ID)
+		res, err := handshakeService.HandshakeWithRetry(context.Background(), newStream, node2AddrInfo.Addrs[0], node2AddrInfo.ID, 3)
 		if err != nil {
 			t.Fatal(err)
 		}
 
 		testInfo(t, *res, node2Info)
 
-		_, r := protobuf.NewWriterAndReader(stream2)
-		var got pb.SynAck
-		if err := r.ReadMsg(&got); err != nil {
-			t.Fatal(err)
+		if attempts != 2 {
+			t.Fatalf("got %d attempts, want %d", attempts, 2)
 		}
+	})
 
-		if !bytes.Equal(got.Syn.ObservedUnderlay, node2maBinary) {
-			t.Fatalf("got bad syn")
+	t.Run("Handshake with retry - permanent error", func(t *testing.T) {
+		attempts := 0
+		newStream := func(context.Context) (p2p.Stream, error) {
+			attempts++
+			var buffer1 bytes.Buffer
+			var buffer2 bytes.Buffer
+			stream1 := p2ptest.NewStream(&buffer1, &buffer2)
+			stream2 := p2ptest.NewStream(&buffer2, &buffer1)
+
+			w := protobuf.NewWriter(stream2)
+			if err := w.WriteMsg(&pb.SynAck{
+				Syn: &pb.Syn{
+					ObservedUnderlay: node1maBinary,
+				},
+				Ack: &pb.Ack{
+					Address: &pb.BzzAddress{
+						Underlay:  node2maBinary,
+						Overlay:   node2BzzAddress.Overlay.Bytes(),
+						Signature: node2BzzAddress.Signature,
+					},
+					NetworkID:       5,
+					FullNode:        true,
+					ProtocolVersion: handshake.MaxSupportedVersion,
+				},
+			}); err != nil {
+				return nil, err
+			}
+			return stream1, nil
 		}
 
-		bzzAddress, err := bzz.ParseAddress(got.Ack.Address.Underlay, got.Ack.Address.Overlay, got.Ack.Address.Signature, got.Ack.NetworkID)
-		if err != nil {
-			t.Fatal(err)
+		res, err := handshakeService.HandshakeWithRetry(context.Background(), newStream, node2AddrInfo.Addrs[0], node2AddrInfo.ID, 3)
+		if res != nil {
+			t.Fatal("res should be nil")
 		}
 
-		testInfo(t, node1Info, handshake.Info{
-			BzzAddress: bzzAddress,
-			FullNode:   got.Ack.FullNode,
-		})
-	})
+		if !errors.Is(err, handshake.ErrNetworkIDMismatch) {
+			t.Fatalf("expected %s, got %s", handshake.ErrNetworkIDMismatch, err)
+		}
 
-	t.Run("Handle - read error ", func(t *testing.T) {
-		handshakeService, err := handshake.New(signer1, aaddresser, senderMatcher, node1Info.BzzAddress.Overlay, networkID, true, nil, "", logger)
-		if err != nil {
-			t.Fatal(err)
+		if attempts != 1 {
+			t.Fatalf("got %d attempts, want %d", attempts, 1)
 		}
+	})
+
+	t.Run("Handshake with retry - max attempts", func(t *testing.T) {
 		testErr := errors.New("test error")
-		expectedErr := fmt.Errorf("read syn message: %w", testErr)
-		stream := &mock.Stream{}
-		stream.SetReadErr(testErr, 0)
-		res, err := handshakeService.Handle(context.Background(), stream, node2AddrInfo.Addrs[0], node2AddrInfo.ID)
-		if err == nil || err.Error() != expectedErr.Error() {
-			t.Fatal("expected:", expectedErr, "got:", err)
+		attempts := 0
+		newStream := func(context.Context) (p2p.Stream, error) {
+			attempts++
+			stream := &p2ptest.Stream{}
+			stream.SetWriteError(testErr, 0)
+			return stream, nil
 		}
 
-		if res != nil {
-			t.Fatal("handle returned non-nil res")
+		_, err := handshakeService.HandshakeWithRetry(context.Background(), newStream, node2AddrInfo.Addrs[0], node2AddrInfo.ID, 2)
+		if !errors.Is(err, testErr) {
+			t.Fatalf("expected %s, got %s", testErr, err)
 		}
-	})
 
-	t.Run("Handle - write error ", func(t *testing.T) {
-		handshakeService, err := handshake.New(signer1, aaddresser, senderMatcher, node1Info.BzzAddress.Overlay, networkID, true, nil, "", logger)
-		if err != nil {
-			t.Fatal(err)
+		if attempts != 2 {
+			t.Fatalf("got %d attempts, want %d", attempts, 2)
 		}
-		testErr := errors.New("test error")
-		expectedErr := fmt.Errorf("write synack message: %w", testErr)
-		var buffer bytes.Buffer
-		stream := mock.NewStream(&buffer, &buffer)
-		stream.SetWriteErr(testErr, 1)
-		w := protobuf.NewWriter(stream)
-		if err := w.WriteMsg(&pb.Syn{
+	})
+
+	t.Run("Handshake - welcome message too long", func(t *testing.T) {
+		const LongMessage = "Lorem ipsum dolor sit amet, consectetur adipiscing elit. Morbi consectetur urna ut lorem sollicitudin posuere. Donec sagittis laoreet sapien."
+
+		expectedErr := handshake.ErrWelcomeMessageLength
+		_, err := handshake.New(signer1, aaddresser, senderMatcher, node1Info.BzzAddress.Overlay, networkID, handshake.MinSupportedVersion, handshake.MaxSupportedVersion, true, nil, nil, LongMessage, logger)
+		if err == nil || err.Error() != expectedErr.Error() {
+			t.Fatal("expected:", expectedErr, "got:", err)
+		}
+	})
+
+	t.Run("Handshake - dynamic welcome message too long", func(t *testing.T) {
+		const LongMessage = "Lorem ipsum dolor sit amet, consectetur adipiscing elit. Morbi consectetur urna ut lorem sollicitudin posuere. Donec sagittis laoreet sapien."
+
+		expectedErr := handshake.ErrWelcomeMessageLength
+		err := handshakeService.SetWelcomeMessage(LongMessage)
+		if err == nil || err.Error() != expectedErr.Error() {
+			t.Fatal("expected:", expectedErr, "got:", err)
+		}
+	})
+
+	t.Run("Handshake - set welcome message", func(t *testing.T) {
+		const TestMessage = "Hi im the new test message"
+
+		err := handshakeService.SetWelcomeMessage(TestMessage)
+		if err != nil {
+			t.Fatal("Got error:", err)
+		}
+		got := handshakeService.GetWelcomeMessage()
+		if got != TestMessage {
+			t.Fatal("expected:", TestMessage, ", got:", got)
+		}
+	})
+
+	t.Run("Handshake - concurrent welcome message update", func(t *testing.T) {
+		messages := []string{"first message", "second message", "third message"}
+		handshakeService, err := handshake.New(signer1, aaddresser, senderMatcher, node1Info.BzzAddress.Overlay, networkID, handshake.MinSupportedVersion, handshake.MaxSupportedVersion, true, nil, nil, messages[0], logger)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		const handshakes = 10
+		done := make(chan struct{})
+		var setErr error
+		go func() {
+			defer close(done)
+			for i := 0; i < 100; i++ {
+				if err := handshakeService.SetWelcomeMessage(messages[i%len(messages)]); err != nil {
+					setErr = err
+					return
+				}
+			}
+		}()
+
+		var wg sync.WaitGroup
+		errs := make(chan error, handshakes)
+		for i := 0; i < handshakes; i++ {
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+
+				var buffer1 bytes.Buffer
+				var buffer2 bytes.Buffer
+				stream1 := p2ptest.NewStream(&buffer1, &buffer2)
+				stream2 := p2ptest.NewStream(&buffer2, &buffer1)
+
+				w, r := protobuf.NewWriterAndReader(stream2)
+				if err := w.WriteMsg(&pb.SynAck{
+					Syn: &pb.Syn{
+						ObservedUnderlay: node1maBinary,
+					},
+					Ack: &pb.Ack{
+						Address: &pb.BzzAddress{
+							Underlay:  node2maBinary,
+							Overlay:   node2BzzAddress.Overlay.Bytes(),
+							Signature: node2BzzAddress.Signature,
+						},
+						NetworkID:       networkID,
+						FullNode:        true,
+						ProtocolVersion: handshake.MaxSupportedVersion,
+					},
+				}); err != nil {
+					errs <- err
+					return
+				}
+
+				if _, err := handshakeService.Handshake(context.Background(), stream1, node2AddrInfo.Addrs[0], node2AddrInfo.ID); err != nil {
+					errs <- err
+					return
+				}
+
+				var syn pb.Syn
+				if err := r.ReadMsg(&syn); err != nil {
+					errs <- err
+					return
+				}
+				var ack pb.Ack
+				if err := r.ReadMsg(&ack); err != nil {
+					errs <- err
+					return
+				}
+				for _, m := range messages {
+					if ack.WelcomeMessage == m {
+						return
+					}
+				}
+				errs <- fmt.Errorf("unexpected welcome message %q", ack.WelcomeMessage)
+			}()
+		}
+		wg.Wait()
+		<-done
+		close(errs)
+
+		if setErr != nil {
+			t.Fatal(setErr)
+		}
+		for err := range errs {
+			t.Fatal(err)
+		}
+	})
+
+	t.Run("Handshake and Handle - concurrent", func(t *testing.T) {
+		initiator, err := handshake.New(signer1, aaddresser, senderMatcher, node1Info.BzzAddress.Overlay, networkID, handshake.MinSupportedVersion, handshake.MaxSupportedVersion, true, nil, nil, "", logger)
+		if err != nil {
+			t.Fatal(err)
+		}
+		responder, err := handshake.New(signer2, aaddresser, senderMatcher, node2Info.BzzAddress.Overlay, networkID, handshake.MinSupportedVersion, handshake.MaxSupportedVersion, true, nil, nil, "", logger, handshake.WithHandshakeRateLimit(1000, 1000))
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		const handshakes = 50
+
+		// every handshake is handled as if it came from another peer, as the
+		// responder accepts only one handshake per peer
+		peerIDs := make([]libp2ppeer.ID, handshakes)
+		for i := range peerIDs {
+			_, pub, err := libp2pcrypto.GenerateEd25519Key(rand.Reader)
+			if err != nil {
+				t.Fatal(err)
+			}
+			peerIDs[i], err = libp2ppeer.IDFromPublicKey(pub)
+			if err != nil {
+				t.Fatal(err)
+			}
+		}
+
+		var wg sync.WaitGroup
+		errs := make(chan error, 2*handshakes)
+		for i := 0; i < handshakes; i++ {
+			stream1, stream2 := handshaketest.NewPipe()
+			wg.Add(2)
+			go func(peerID libp2ppeer.ID) {
+				defer wg.Done()
+				defer stream2.Close()
+				if _, err := responder.Handle(context.Background(), stream2, node1ma, peerID); err != nil {
+					errs <- fmt.Errorf("handle: %w", err)
+				}
+			}(peerIDs[i])
+			go func(i int) {
+				defer wg.Done()
+				defer stream1.Close()
+				// shared state is updated while the handshakes are running
+				responder.SetBlockHeight(uint64(i))
+				if err := responder.SetWelcomeMessage(fmt.Sprintf("welcome %d", i)); err != nil {
+					errs <- err
+					return
+				}
+				if _, err := initiator.Handshake(context.Background(), stream1, node2AddrInfo.Addrs[0], node2AddrInfo.ID); err != nil {
+					errs <- fmt.Errorf("handshake: %w", err)
+				}
+			}(i)
+		}
+		wg.Wait()
+		close(errs)
+
+		for err := range errs {
+			t.Fatal(err)
+		}
+	})
+
+	t.Run("Handshake - Syn write error", func(t *testing.T) {
+		testErr := errors.New("test error")
+		expectedErr := &handshake.HandshakeError{Op: "write", Phase: handshake.PhaseSyn, Peer: node2AddrInfo.ID, Err: testErr}
+		stream := &p2ptest.Stream{}
+		stream.SetWriteError(testErr, 0)
+		res, err := handshakeService.Handshake(context.Background(), stream, node2AddrInfo.Addrs[0], node2AddrInfo.ID)
+		if err == nil || err.Error() != expectedErr.Error() {
+			t.Fatal("expected:", expectedErr, "got:", err)
+		}
+		var handshakeErr *handshake.HandshakeError
+		if !errors.As(err, &handshakeErr) || handshakeErr.Phase != handshake.PhaseSyn || !errors.Is(err, testErr) {
+			t.Fatalf("got error %v, want phase %s wrapping %v", err, handshake.PhaseSyn, testErr)
+		}
+		if !strings.HasPrefix(err.Error(), "write syn message: ") {
+			t.Fatalf("error %q does not have the message prefix", err)
+		}
+
+		if res != nil {
+			t.Fatal("handshake returned non-nil res")
+		}
+
+		if !stream.IsReset() {
+			t.Fatal("stream is not reset")
+		}
+	})
+
+	t.Run("Handshake - underlays", func(t *testing.T) {
+		wsUnderlay, err := ma.NewMultiaddr("/ip4/127.0.0.1/tcp/1635/ws")
+		if err != nil {
+			t.Fatal(err)
+		}
+		quicUnderlay, err := ma.NewMultiaddr("/ip4/127.0.0.1/udp/1634/quic")
+		if err != nil {
+			t.Fatal(err)
+		}
+		handshakeService, err := handshake.New(signer1, aaddresser, senderMatcher, node1Info.BzzAddress.Overlay, networkID, handshake.MinSupportedVersion, handshake.MaxSupportedVersion, true, nil, nil, "", logger, handshake.WithUnderlays(quicUnderlay))
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		var buffer1 bytes.Buffer
+		var buffer2 bytes.Buffer
+		stream1 := p2ptest.NewStream(&buffer1, &buffer2)
+		stream2 := p2ptest.NewStream(&buffer2, &buffer1)
+
+		w, r := protobuf.NewWriterAndReader(stream2)
+		if err := w.WriteMsg(&pb.SynAck{
+			Syn: &pb.Syn{
+				ObservedUnderlay: node1maBinary,
+			},
+			Ack: &pb.Ack{
+				Address: &pb.BzzAddress{
+					Underlay:  node2maBinary,
+					Overlay:   node2BzzAddress.Overlay.Bytes(),
+					Signature: node2BzzAddress.Signature,
+				},
+				NetworkID:       networkID,
+				FullNode:        true,
+				ProtocolVersion: handshake.MaxSupportedVersion,
+				Nonce:           challenge,
+				Underlays: [][]byte{
+					wsUnderlay.Bytes(),
+					[]byte("invalid"),
+					nil,
+					quicUnderlay.Bytes(),
+				},
+			},
+		}); err != nil {
+			t.Fatal(err)
+		}
+
+		res, err := handshakeService.Handshake(context.Background(), stream1, node2AddrInfo.Addrs[0], node2AddrInfo.ID)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		want := []ma.Multiaddr{wsUnderlay, quicUnderlay}
+		if len(res.Underlays) != len(want) {
+			t.Fatalf("got underlays %v, want %v", res.Underlays, want)
+		}
+		for i, u := range res.Underlays {
+			if !u.Equal(want[i]) {
+				t.Fatalf("got underlays %v, want %v", res.Underlays, want)
+			}
+		}
+
+		var syn pb.Syn
+		if err := r.ReadMsg(&syn); err != nil {
+			t.Fatal(err)
+		}
+		var ack pb.Ack
+		if err := r.ReadMsg(&ack); err != nil {
+			t.Fatal(err)
+		}
+		if len(ack.Underlays) != 1 || !bytes.Equal(ack.Underlays[0], quicUnderlay.Bytes()) {
+			t.Fatalf("got advertised underlays %x, want %x", ack.Underlays, quicUnderlay.Bytes())
+		}
+	})
+
+	t.Run("Handshake - observer", func(t *testing.T) {
+		var events []handshake.HandshakeEvent
+		observer := handshake.WithObserver(func(ev handshake.HandshakeEvent) {
+			events = append(events, ev)
+		})
+		handshakeService, err := handshake.New(signer1, aaddresser, senderMatcher, node1Info.BzzAddress.Overlay, networkID, handshake.MinSupportedVersion, handshake.MaxSupportedVersion, true, nil, nil, "", logger, observer)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		var buffer1 bytes.Buffer
+		var buffer2 bytes.Buffer
+		stream1 := p2ptest.NewStream(&buffer1, &buffer2)
+		stream2 := p2ptest.NewStream(&buffer2, &buffer1)
+
+		w := protobuf.NewWriter(stream2)
+		if err := w.WriteMsg(&pb.SynAck{
+			Syn: &pb.Syn{
+				ObservedUnderlay: node1maBinary,
+			},
+			Ack: &pb.Ack{
+				Address: &pb.BzzAddress{
+					Underlay:  node2maBinary,
+					Overlay:   node2BzzAddress.Overlay.Bytes(),
+					Signature: node2BzzAddress.Signature,
+				},
+				NetworkID:       networkID,
+				FullNode:        true,
+				ProtocolVersion: handshake.MaxSupportedVersion,
+				Nonce:           challenge,
+			},
+		}); err != nil {
+			t.Fatal(err)
+		}
+
+		if _, err := handshakeService.Handshake(context.Background(), stream1, node2AddrInfo.Addrs[0], node2AddrInfo.ID); err != nil {
+			t.Fatal(err)
+		}
+
+		testErr := errors.New("test error")
+		stream := &p2ptest.Stream{}
+		stream.SetWriteError(testErr, 0)
+		if _, err := handshakeService.Handshake(context.Background(), stream, node2AddrInfo.Addrs[0], node2AddrInfo.ID); !errors.Is(err, testErr) {
+			t.Fatalf("got error %v, want %v", err, testErr)
+		}
+
+		want := []handshake.HandshakeEventType{
+			handshake.HandshakeStarted,
+			handshake.HandshakeSucceeded,
+			handshake.HandshakeStarted,
+			handshake.HandshakeFailed,
+		}
+		if len(events) != len(want) {
+			t.Fatalf("got %d events, want %d", len(events), len(want))
+		}
+		for i, ev := range events {
+			if ev.Type != want[i] {
+				t.Fatalf("event %d: got type %s, want %s", i, ev.Type, want[i])
+			}
+			if ev.Inbound || ev.Peer != node2AddrInfo.ID || !ev.Multiaddr.Equal(node2AddrInfo.Addrs[0]) {
+				t.Fatalf("event %d: got inbound %v, peer %s, multiaddr %s", i, ev.Inbound, ev.Peer, ev.Multiaddr)
+			}
+		}
+		if succeeded := events[1]; succeeded.BzzAddress == nil || !succeeded.BzzAddress.Equal(node2BzzAddress) || succeeded.Err != nil {
+			t.Fatalf("got succeeded event %+v", succeeded)
+		}
+		if failed := events[3]; failed.Phase != handshake.PhaseSyn || !errors.Is(failed.Err, testErr) || failed.BzzAddress != nil {
+			t.Fatalf("got failed event %+v", failed)
+		}
+	})
+
+	t.Run("Handshake - Syn read error", func(t *testing.T) {
+		testErr := errors.New("test error")
+		expectedErr := &handshake.HandshakeError{Op: "read", Phase: handshake.PhaseSynAck, Peer: node2AddrInfo.ID, Err: testErr}
+		stream := p2ptest.NewStream(nil, &bytes.Buffer{})
+		stream.SetReadError(testErr, 0)
+		res, err := handshakeService.Handshake(context.Background(), stream, node2AddrInfo.Addrs[0], node2AddrInfo.ID)
+		if err == nil || err.Error() != expectedErr.Error() {
+			t.Fatal("expected:", expectedErr, "got:", err)
+		}
+		var handshakeErr *handshake.HandshakeError
+		if !errors.As(err, &handshakeErr) || handshakeErr.Phase != handshake.PhaseSynAck || !errors.Is(err, testErr) {
+			t.Fatalf("got error %v, want phase %s wrapping %v", err, handshake.PhaseSynAck, testErr)
+		}
+
+		if res != nil {
+			t.Fatal("handshake returned non-nil res")
+		}
+
+		if !stream.IsReset() {
+			t.Fatal("stream is not reset")
+		}
+	})
+
+	t.Run("Handshake - context canceled", func(t *testing.T) {
+		stream := newBlockingStream(p2ptest.NewStream(nil, &bytes.Buffer{}))
+		defer stream.release()
+
+		ctx, cancel := context.WithCancel(context.Background())
+		go func() {
+			<-stream.reading
+			cancel()
+		}()
+
+		res, err := handshakeService.Handshake(ctx, stream, node2AddrInfo.Addrs[0], node2AddrInfo.ID)
+		if !errors.Is(err, context.Canceled) {
+			t.Fatalf("expected %v, got %v", context.Canceled, err)
+		}
+
+		if res != nil {
+			t.Fatal("handshake returned non-nil res")
+		}
+
+		if !stream.IsReset() {
+			t.Fatal("stream is not reset")
+		}
+	})
+
+	t.Run("Handshake - ack write error", func(t *testing.T) {
+		testErr := errors.New("test error")
+		expectedErr := &handshake.HandshakeError{Op: "write", Phase: handshake.PhaseAck, Peer: node2AddrInfo.ID, Err: testErr}
+		var buffer1 bytes.Buffer
+		var buffer2 bytes.Buffer
+		stream1 := p2ptest.NewStream(&buffer1, &buffer2)
+		stream1.SetWriteError(testErr, 1)
+		stream2 := p2ptest.NewStream(&buffer2, &buffer1)
+
+		w := protobuf.NewWriter(stream2)
+		if err := w.WriteMsg(&pb.SynAck{
+			Syn: &pb.Syn{
+				ObservedUnderlay: node1maBinary,
+			},
+			Ack: &pb.Ack{
+				Address: &pb.BzzAddress{
+					Underlay:  node2maBinary,
+					Overlay:   node2BzzAddress.Overlay.Bytes(),
+					Signature: node2BzzAddress.Signature,
+				},
+				NetworkID:       networkID,
+				FullNode:        true,
+				ProtocolVersion: handshake.MaxSupportedVersion,
+			},
+		},
+		); err != nil {
+			t.Fatal(err)
+		}
+
+		res, err := handshakeService.Handshake(context.Background(), stream1, node2AddrInfo.Addrs[0], node2AddrInfo.ID)
+		if err == nil || err.Error() != expectedErr.Error() {
+			t.Fatal("expected:", expectedErr, "got:", err)
+		}
+		var handshakeErr *handshake.HandshakeError
+		if !errors.As(err, &handshakeErr) || handshakeErr.Phase != handshake.PhaseAck || !errors.Is(err, testErr) {
+			t.Fatalf("got error %v, want phase %s wrapping %v", err, handshake.PhaseAck, testErr)
+		}
+
+		if res != nil {
+			t.Fatal("handshake returned non-nil res")
+		}
+
+		if !stream1.IsReset() {
+			t.Fatal("stream is not reset")
+		}
+	})
+
+	t.Run("Handshake - networkID mismatch", func(t *testing.T) {
+		var buffer1 bytes.Buffer
+		var buffer2 bytes.Buffer
+		stream1 := p2ptest.NewStream(&buffer1, &buffer2)
+		stream2 := p2ptest.NewStream(&buffer2, &buffer1)
+
+		w := protobuf.NewWriter(stream2)
+		if err := w.WriteMsg(&pb.SynAck{
+			Syn: &pb.Syn{
+				ObservedUnderlay: node1maBinary,
+			},
+			Ack: &pb.Ack{
+				Address: &pb.BzzAddress{
+					Underlay:  node2maBinary,
+					Overlay:   node2BzzAddress.Overlay.Bytes(),
+					Signature: node2BzzAddress.Signature,
+				},
+				NetworkID:       5,
+				FullNode:        true,
+				ProtocolVersion: handshake.MaxSupportedVersion,
+			},
+		}); err != nil {
+			t.Fatal(err)
+		}
+
+		res, err := handshakeService.Handshake(context.Background(), stream1, node2AddrInfo.Addrs[0], node2AddrInfo.ID)
+		if res != nil {
+			t.Fatal("res should be nil")
+		}
+
+		if !errors.Is(err, handshake.ErrNetworkIDMismatch) {
+			t.Fatalf("expected %v, got %v", handshake.ErrNetworkIDMismatch, err)
+		}
+
+		if !stream1.IsReset() {
+			t.Fatal("stream is not reset")
+		}
+	})
+
+	t.Run("Handshake - invalid ack", func(t *testing.T) {
+		var buffer1 bytes.Buffer
+		var buffer2 bytes.Buffer
+		stream1 := p2ptest.NewStream(&buffer1, &buffer2)
+		stream2 := p2ptest.NewStream(&buffer2, &buffer1)
+
+		w := protobuf.NewWriter(stream2)
+		if err := w.WriteMsg(&pb.SynAck{
+			Syn: &pb.Syn{
+				ObservedUnderlay: node1maBinary,
+			},
+			Ack: &pb.Ack{
+				Address: &pb.BzzAddress{
+					Underlay:  node2maBinary,
+					Overlay:   node2BzzAddress.Overlay.Bytes(),
+					Signature: node1BzzAddress.Signature,
+				},
+				NetworkID:       networkID,
+				FullNode:        true,
+				ProtocolVersion: handshake.MaxSupportedVersion,
+			},
+		}); err != nil {
+			t.Fatal(err)
+		}
+
+		res, err := handshakeService.Handshake(context.Background(), stream1, node2AddrInfo.Addrs[0], node2AddrInfo.ID)
+		if res != nil {
+			t.Fatal("res should be nil")
+		}
+
+		if err != handshake.ErrInvalidAck {
+			t.Fatalf("expected %s, got %s", handshake.ErrInvalidAck, err)
+		}
+
+		if !stream1.IsReset() {
+			t.Fatal("stream is not reset")
+		}
+	})
+
+	t.Run("Handshake - self connection", func(t *testing.T) {
+		var buffer1 bytes.Buffer
+		var buffer2 bytes.Buffer
+		stream1 := p2ptest.NewStream(&buffer1, &buffer2)
+		stream2 := p2ptest.NewStream(&buffer2, &buffer1)
+
+		w := protobuf.NewWriter(stream2)
+		if err := w.WriteMsg(&pb.SynAck{
+			Syn: &pb.Syn{
+				ObservedUnderlay: node1maBinary,
+			},
+			Ack: &pb.Ack{
+				Address: &pb.BzzAddress{
+					Underlay:  node1maBinary,
+					Overlay:   node1BzzAddress.Overlay.Bytes(),
+					Signature: node1BzzAddress.Signature,
+				},
+				NetworkID:       networkID,
+				FullNode:        true,
+				ProtocolVersion: handshake.MaxSupportedVersion,
+			},
+		}); err != nil {
+			t.Fatal(err)
+		}
+
+		res, err := handshakeService.Handshake(context.Background(), stream1, node2AddrInfo.Addrs[0], node2AddrInfo.ID)
+		if res != nil {
+			t.Fatal("res should be nil")
+		}
+
+		if !errors.Is(err, handshake.ErrSelfConnection) {
+			t.Fatalf("expected %v, got %v", handshake.ErrSelfConnection, err)
+		}
+
+		if !stream1.IsReset() {
+			t.Fatal("stream is not reset")
+		}
+	})
+
+	t.Run("Handshake - error advertisable address", func(t *testing.T) {
+		var buffer1 bytes.Buffer
+		var buffer2 bytes.Buffer
+		stream1 := p2ptest.NewStream(&buffer1, &buffer2)
+		stream2 := p2ptest.NewStream(&buffer2, &buffer1)
+
+		testError := errors.New("test error")
+		aaddresser.err = testError
+		defer func() {
+			aaddresser.err = nil
+		}()
+
+		w, _ := protobuf.NewWriterAndReader(stream2)
+		if err := w.WriteMsg(&pb.SynAck{
+			Syn: &pb.Syn{
+				ObservedUnderlay: node1maBinary,
+			},
+			Ack: &pb.Ack{
+				Address: &pb.BzzAddress{
+					Underlay:  node2maBinary,
+					Overlay:   node2BzzAddress.Overlay.Bytes(),
+					Signature: node2BzzAddress.Signature,
+				},
+				NetworkID:       networkID,
+				FullNode:        true,
+				ProtocolVersion: handshake.MaxSupportedVersion,
+			},
+		}); err != nil {
+			t.Fatal(err)
+		}
+
+		res, err := handshakeService.Handshake(context.Background(), stream1, node2AddrInfo.Addrs[0], node2AddrInfo.ID)
+		if err != testError {
+			t.Fatalf("expected error %v got %v", testError, err)
+
+		}
+
+		if res != nil {
+			t.Fatal("expected nil res")
+		}
+
+		if !stream1.IsReset() {
+			t.Fatal("stream is not reset")
+		}
+	})
+
+	t.Run("Handle - OK", func(t *testing.T) {
+		handshakeService, err := handshake.New(signer1, aaddresser, senderMatcher, node1Info.BzzAddress.Overlay, networkID, handshake.MinSupportedVersion, handshake.MaxSupportedVersion, true, nil, nil, "", logger)
+		if err != nil {
+			t.Fatal(err)
+		}
+		var buffer1 bytes.Buffer
+		var buffer2 bytes.Buffer
+		stream1 := p2ptest.NewStream(&buffer1, &buffer2)
+		stream2 := p2ptest.NewStream(&buffer2, &buffer1)
+
+		w := protobuf.NewWriter(stream2)
+		if err := w.WriteMsg(&pb.Syn{
+			ObservedUnderlay: node1maBinary,
+			ProtocolVersion:  handshake.MaxSupportedVersion,
+			NetworkID:        networkID,
+		}); err != nil {
+			t.Fatal(err)
+		}
+
+		if err := w.WriteMsg(&pb.Ack{
+			Address: &pb.BzzAddress{
+				Underlay:  node2maBinary,
+				Overlay:   node2BzzAddress.Overlay.Bytes(),
+				Signature: node2BzzAddress.Signature,
+			},
+			NetworkID:          networkID,
+			FullNode:           true,
+			ProtocolVersion:    handshake.MaxSupportedVersion,
+			MaxProtocolVersion: handshake.MaxSupportedVersion,
+			Timestamp:          timestamp,
+			Nonce:              nonce,
+			Signature:          node2AckSignature,
+		}); err != nil {
+			t.Fatal(err)
+		}
+
+		res, err := handshakeService.Handle(context.Background(), stream1, node2AddrInfo.Addrs[0], node2AddrInfo.ID)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		testInfo(t, *res, node2Info)
+
+		peer, err := handshake.NewPeer(*res, node2ma)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !peer.Address.Equal(node2BzzAddress.Overlay) || peer.ID != node2AddrInfo.ID || !peer.FullNode {
+			t.Fatalf("got peer %v %s full node %v, want %v %s full node %v", peer.Address, peer.ID, peer.FullNode, node2BzzAddress.Overlay, node2AddrInfo.ID, true)
+		}
+
+		_, r := protobuf.NewWriterAndReader(stream2)
+		var got pb.SynAck
+		if err := r.ReadMsg(&got); err != nil {
+			t.Fatal(err)
+		}
+
+		if !bytes.Equal(got.Syn.ObservedUnderlay, node2maBinary) {
+			t.Fatalf("got bad syn")
+		}
+
+		bzzAddress, err := bzz.ParseAddress(got.Ack.Address.Underlay, got.Ack.Address.Overlay, got.Ack.Address.Signature, got.Ack.NetworkID)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		testInfo(t, node1Info, handshake.Info{
+			BzzAddress: bzzAddress,
+			FullNode:   got.Ack.FullNode,
+		})
+
+		if stream1.IsReset() {
+			t.Fatal("stream is reset after a successful handshake")
+		}
+	})
+
+	t.Run("Handle - replayed handshake", func(t *testing.T) {
+		handshakeService, err := handshake.New(signer1, aaddresser, senderMatcher, node1Info.BzzAddress.Overlay, networkID, handshake.MinSupportedVersion, handshake.MaxSupportedVersion, true, nil, nil, "", logger)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		// handle writes the initiator messages to a new stream
+		handle := func(peerID libp2ppeer.ID) error {
+			var buffer1 bytes.Buffer
+			var buffer2 bytes.Buffer
+			stream1 := p2ptest.NewStream(&buffer1, &buffer2)
+			stream2 := p2ptest.NewStream(&buffer2, &buffer1)
+
+			w := protobuf.NewWriter(stream2)
+			if err := w.WriteMsg(&pb.Syn{
+				ObservedUnderlay: node1maBinary,
+				ProtocolVersion:  handshake.MaxSupportedVersion,
+				NetworkID:        networkID,
+			}); err != nil {
+				t.Fatal(err)
+			}
+
+			if err := w.WriteMsg(&pb.Ack{
+				Address: &pb.BzzAddress{
+					Underlay:  node2maBinary,
+					Overlay:   node2BzzAddress.Overlay.Bytes(),
+					Signature: node2BzzAddress.Signature,
+				},
+				NetworkID:          networkID,
+				FullNode:           true,
+				ProtocolVersion:    handshake.MaxSupportedVersion,
+				MaxProtocolVersion: handshake.MaxSupportedVersion,
+				Timestamp:          timestamp,
+				Nonce:              nonce,
+				Signature:          node2AckSignature,
+			}); err != nil {
+				t.Fatal(err)
+			}
+
+			_, err := handshakeService.Handle(context.Background(), stream1, node2AddrInfo.Addrs[0], peerID)
+			return err
+		}
+
+		if err := handle(node2AddrInfo.ID); err != nil {
+			t.Fatal(err)
+		}
+
+		// the captured messages are replayed from another peer
+		node1AddrInfo, err := libp2ppeer.AddrInfoFromP2pAddr(node1ma)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err := handle(node1AddrInfo.ID); !errors.Is(err, handshake.ErrReplayedHandshake) {
+			t.Fatalf("expected %v, got %v", handshake.ErrReplayedHandshake, err)
+		}
+	})
+
+	t.Run("Handle - seen nonces", func(t *testing.T) {
+		now := time.Unix(1600000000, 0)
+		handshake.SetTimeNow(func() time.Time { return now })
+		defer handshake.SetTimeNow(time.Now)
+
+		handshakeService, err := handshake.New(signer1, aaddresser, senderMatcher, node1Info.BzzAddress.Overlay, networkID, handshake.MinSupportedVersion, handshake.MaxSupportedVersion, true, nil, nil, "", logger)
+		if err != nil {
+			t.Fatal(err)
+		}
+		handshakeService.SetMaxSeenNonces(2)
+
+		// handle writes the initiator messages with the nonce to a new
+		// stream from a new peer, so that only the nonce can be replayed
+		handle := func(nonce []byte) error {
+			_, pub, err := libp2pcrypto.GenerateEd25519Key(rand.Reader)
+			if err != nil {
+				t.Fatal(err)
+			}
+			peerID, err := libp2ppeer.IDFromPublicKey(pub)
+			if err != nil {
+				t.Fatal(err)
+			}
+			signature, err := signer2.Sign(handshake.SignData(networkID, node2BzzAddress.Overlay, nonce, challenge, handshake.MaxSupportedVersion, handshake.MaxSupportedVersion, now.Unix(), nil))
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			var buffer1 bytes.Buffer
+			var buffer2 bytes.Buffer
+			stream1 := p2ptest.NewStream(&buffer1, &buffer2)
+			stream2 := p2ptest.NewStream(&buffer2, &buffer1)
+
+			w := protobuf.NewWriter(stream2)
+			if err := w.WriteMsg(&pb.Syn{
+				ObservedUnderlay: node1maBinary,
+				ProtocolVersion:  handshake.MaxSupportedVersion,
+				NetworkID:        networkID,
+			}); err != nil {
+				t.Fatal(err)
+			}
+
+			if err := w.WriteMsg(&pb.Ack{
+				Address: &pb.BzzAddress{
+					Underlay:  node2maBinary,
+					Overlay:   node2BzzAddress.Overlay.Bytes(),
+					Signature: node2BzzAddress.Signature,
+				},
+				NetworkID:          networkID,
+				FullNode:           true,
+				ProtocolVersion:    handshake.MaxSupportedVersion,
+				MaxProtocolVersion: handshake.MaxSupportedVersion,
+				Timestamp:          now.Unix(),
+				Nonce:              nonce,
+				Signature:          signature,
+			}); err != nil {
+				t.Fatal(err)
+			}
+
+			_, err = handshakeService.Handle(context.Background(), stream1, node2AddrInfo.Addrs[0], peerID)
+			return err
+		}
+
+		nonce1 := bytes.Repeat([]byte{1}, 32)
+		nonce2 := bytes.Repeat([]byte{2}, 32)
+		nonce3 := bytes.Repeat([]byte{3}, 32)
+
+		if err := handle(nonce1); err != nil {
+			t.Fatal(err)
+		}
+		if err := handle(nonce1); !errors.Is(err, handshake.ErrReplayedHandshake) {
+			t.Fatalf("expected %v, got %v", handshake.ErrReplayedHandshake, err)
+		}
+
+		// the nonce is forgotten after the replay window
+		now = now.Add(10*time.Minute + time.Second)
+		if err := handle(nonce2); err != nil {
+			t.Fatal(err)
+		}
+		if got := handshakeService.SeenNonces(); got != 1 {
+			t.Fatalf("got %d seen nonces, want %d", got, 1)
+		}
+		if err := handle(nonce1); err != nil {
+			t.Fatal(err)
+		}
+
+		// the oldest nonce is forgotten if there are too many
+		if err := handle(nonce3); err != nil {
+			t.Fatal(err)
+		}
+		if got := handshakeService.SeenNonces(); got != 2 {
+			t.Fatalf("got %d seen nonces, want %d", got, 2)
+		}
+		if err := handle(nonce2); err != nil {
+			t.Fatal(err)
+		}
+		if err := handle(nonce3); !errors.Is(err, handshake.ErrReplayedHandshake) {
+			t.Fatalf("expected %v, got %v", handshake.ErrReplayedHandshake, err)
+		}
+	})
+
+	t.Run("Handle - signature over another challenge", func(t *testing.T) {
+		handshake.SetChallengeFunc(rand.Read)
+		defer handshake.SetChallengeFunc(func(b []byte) (int, error) {
+			return copy(b, challenge), nil
+		})
+
+		handshakeService, err := handshake.New(signer1, aaddresser, senderMatcher, node1Info.BzzAddress.Overlay, networkID, handshake.MinSupportedVersion, handshake.MaxSupportedVersion, true, nil, nil, "", logger)
+		if err != nil {
+			t.Fatal(err)
+		}
+		var buffer1 bytes.Buffer
+		var buffer2 bytes.Buffer
+		stream1 := p2ptest.NewStream(&buffer1, &buffer2)
+		stream2 := p2ptest.NewStream(&buffer2, &buffer1)
+
+		w := protobuf.NewWriter(stream2)
+		if err := w.WriteMsg(&pb.Syn{
+			ObservedUnderlay: node1maBinary,
+			ProtocolVersion:  handshake.MaxSupportedVersion,
+			NetworkID:        networkID,
+		}); err != nil {
+			t.Fatal(err)
+		}
+
+		if err := w.WriteMsg(&pb.Ack{
+			Address: &pb.BzzAddress{
+				Underlay:  node2maBinary,
+				Overlay:   node2BzzAddress.Overlay.Bytes(),
+				Signature: node2BzzAddress.Signature,
+			},
+			NetworkID:          networkID,
+			FullNode:           true,
+			ProtocolVersion:    handshake.MaxSupportedVersion,
+			MaxProtocolVersion: handshake.MaxSupportedVersion,
+			Timestamp:          timestamp,
+			Nonce:              nonce,
+			Signature:          node2AckSignature,
+		}); err != nil {
+			t.Fatal(err)
+		}
+
+		_, err = handshakeService.Handle(context.Background(), stream1, node2AddrInfo.Addrs[0], node2AddrInfo.ID)
+		if !errors.Is(err, handshake.ErrInvalidHandshakeSignature) {
+			t.Fatalf("expected %v, got %v", handshake.ErrInvalidHandshakeSignature, err)
+		}
+	})
+
+	t.Run("Handle - read error ", func(t *testing.T) {
+		handshakeService, err := handshake.New(signer1, aaddresser, senderMatcher, node1Info.BzzAddress.Overlay, networkID, handshake.MinSupportedVersion, handshake.MaxSupportedVersion, true, nil, nil, "", logger)
+		if err != nil {
+			t.Fatal(err)
+		}
+		testErr := errors.New("test error")
+		expectedErr := &handshake.HandshakeError{Op: "read", Phase: handshake.PhaseSyn, Peer: node2AddrInfo.ID, Err: testErr}
+		stream := &p2ptest.Stream{}
+		stream.SetReadError(testErr, 0)
+		res, err := handshakeService.Handle(context.Background(), stream, node2AddrInfo.Addrs[0], node2AddrInfo.ID)
+		if err == nil || err.Error() != expectedErr.Error() {
+			t.Fatal("expected:", expectedErr, "got:", err)
+		}
+		var handshakeErr *handshake.HandshakeError
+		if !errors.As(err, &handshakeErr) || handshakeErr.Phase != handshake.PhaseSyn || !errors.Is(err, testErr) {
+			t.Fatalf("got error %v, want phase %s wrapping %v", err, handshake.PhaseSyn, testErr)
+		}
+
+		if res != nil {
+			t.Fatal("handle returned non-nil res")
+		}
+
+		if !stream.IsReset() {
+			t.Fatal("stream is not reset")
+		}
+	})
+
+	t.Run("Handle - context canceled", func(t *testing.T) {
+		handshakeService, err := handshake.New(signer1, aaddresser, senderMatcher, node1Info.BzzAddress.Overlay, networkID, handshake.MinSupportedVersion, handshake.MaxSupportedVersion, true, nil, nil, "", logger)
+		if err != nil {
+			t.Fatal(err)
+		}
+		stream := newBlockingStream(&p2ptest.Stream{})
+		defer stream.release()
+
+		ctx, cancel := context.WithCancel(context.Background())
+		go func() {
+			<-stream.reading
+			cancel()
+		}()
+
+		res, err := handshakeService.Handle(ctx, stream, node2AddrInfo.Addrs[0], node2AddrInfo.ID)
+		if !errors.Is(err, context.Canceled) {
+			t.Fatalf("expected %v, got %v", context.Canceled, err)
+		}
+
+		if res != nil {
+			t.Fatal("handle returned non-nil res")
+		}
+
+		if !stream.IsReset() {
+			t.Fatal("stream is not reset")
+		}
+	})
+
+	t.Run("Handle - write error ", func(t *testing.T) {
+		handshakeService, err := handshake.New(signer1, aaddresser, senderMatcher, node1Info.BzzAddress.Overlay, networkID, handshake.MinSupportedVersion, handshake.MaxSupportedVersion, true, nil, nil, "", logger)
+		if err != nil {
+			t.Fatal(err)
+		}
+		testErr := errors.New("test error")
+		expectedErr := &handshake.HandshakeError{Op: "write", Phase: handshake.PhaseSynAck, Peer: node2AddrInfo.ID, Err: testErr}
+		var buffer bytes.Buffer
+		stream := p2ptest.NewStream(&buffer, &buffer)
+		stream.SetWriteError(testErr, 1)
+		w := protobuf.NewWriter(stream)
+		if err := w.WriteMsg(&pb.Syn{
+			ObservedUnderlay: node1maBinary,
+			ProtocolVersion:  handshake.MaxSupportedVersion,
+			NetworkID:        networkID,
+		}); err != nil {
+			t.Fatal(err)
+		}
+
+		res, err := handshakeService.Handle(context.Background(), stream, node2AddrInfo.Addrs[0], node2AddrInfo.ID)
+		if err == nil || err.Error() != expectedErr.Error() {
+			t.Fatal("expected:", expectedErr, "got:", err)
+		}
+		var handshakeErr *handshake.HandshakeError
+		if !errors.As(err, &handshakeErr) || handshakeErr.Phase != handshake.PhaseSynAck || !errors.Is(err, testErr) {
+			t.Fatalf("got error %v, want phase %s wrapping %v", err, handshake.PhaseSynAck, testErr)
+		}
+
+		if res != nil {
+			t.Fatal("handshake returned non-nil res")
+		}
+
+		if !stream.IsReset() {
+			t.Fatal("stream is not reset")
+		}
+	})
+
+	t.Run("Handle - ack read error ", func(t *testing.T) {
+		handshakeService, err := handshake.New(signer1, aaddresser, senderMatcher, node1Info.BzzAddress.Overlay, networkID, handshake.MinSupportedVersion, handshake.MaxSupportedVersion, true, nil, nil, "", logger)
+		if err != nil {
+			t.Fatal(err)
+		}
+		testErr := errors.New("test error")
+		expectedErr := &handshake.HandshakeError{Op: "read", Phase: handshake.PhaseAck, Peer: node2AddrInfo.ID, Err: testErr}
+		var buffer1 bytes.Buffer
+		var buffer2 bytes.Buffer
+		stream1 := p2ptest.NewStream(&buffer1, &buffer2)
+		stream2 := p2ptest.NewStream(&buffer2, &buffer1)
+		stream1.SetReadError(testErr, 1)
+		w := protobuf.NewWriter(stream2)
+		if err := w.WriteMsg(&pb.Syn{
+			ObservedUnderlay: node1maBinary,
+			ProtocolVersion:  handshake.MaxSupportedVersion,
+			NetworkID:        networkID,
+		}); err != nil {
+			t.Fatal(err)
+		}
+
+		res, err := handshakeService.Handle(context.Background(), stream1, node2AddrInfo.Addrs[0], node2AddrInfo.ID)
+		if err == nil || err.Error() != expectedErr.Error() {
+			t.Fatal("expected:", expectedErr, "got:", err)
+		}
+		var handshakeErr *handshake.HandshakeError
+		if !errors.As(err, &handshakeErr) || handshakeErr.Phase != handshake.PhaseAck || !errors.Is(err, testErr) {
+			t.Fatalf("got error %v, want phase %s wrapping %v", err, handshake.PhaseAck, testErr)
+		}
+
+		if res != nil {
+			t.Fatal("handshake returned non-nil res")
+		}
+
+		if !stream1.IsReset() {
+			t.Fatal("stream is not reset")
+		}
+	})
+
+	t.Run("Handle - networkID mismatch ", func(t *testing.T) {
+		handshakeService, err := handshake.New(signer1, aaddresser, senderMatcher, node1Info.BzzAddress.Overlay, networkID, handshake.MinSupportedVersion, handshake.MaxSupportedVersion, true, nil, nil, "", logger)
+		if err != nil {
+			t.Fatal(err)
+		}
+		var buffer1 bytes.Buffer
+		var buffer2 bytes.Buffer
+		stream1 := p2ptest.NewStream(&buffer1, &buffer2)
+		stream2 := p2ptest.NewStream(&buffer2, &buffer1)
+
+		w := protobuf.NewWriter(stream2)
+		if err := w.WriteMsg(&pb.Syn{
+			ObservedUnderlay: node1maBinary,
+			ProtocolVersion:  handshake.MaxSupportedVersion,
+			NetworkID:        networkID,
+		}); err != nil {
+			t.Fatal(err)
+		}
+
+		if err := w.WriteMsg(&pb.Ack{
+			Address: &pb.BzzAddress{
+				Underlay:  node2maBinary,
+				Overlay:   node2BzzAddress.Overlay.Bytes(),
+				Signature: node2BzzAddress.Signature,
+			},
+			NetworkID:          5,
+			FullNode:           true,
+			ProtocolVersion:    handshake.MaxSupportedVersion,
+			MaxProtocolVersion: handshake.MaxSupportedVersion,
+			Timestamp:          timestamp,
+			Nonce:              nonce,
+			Signature:          node2AckSignature,
+		}); err != nil {
+			t.Fatal(err)
+		}
+
+		res, err := handshakeService.Handle(context.Background(), stream1, node2AddrInfo.Addrs[0], node2AddrInfo.ID)
+		if res != nil {
+			t.Fatal("res should be nil")
+		}
+
+		if !errors.Is(err, handshake.ErrNetworkIDMismatch) {
+			t.Fatalf("expected %v, got %v", handshake.ErrNetworkIDMismatch, err)
+		}
+
+		if !stream1.IsReset() {
+			t.Fatal("stream is not reset")
+		}
+	})
+
+	t.Run("Handle - syn networkID mismatch", func(t *testing.T) {
+		handshakeService, err := handshake.New(signer1, aaddresser, senderMatcher, node1Info.BzzAddress.Overlay, networkID, handshake.MinSupportedVersion, handshake.MaxSupportedVersion, true, nil, nil, "", logger)
+		if err != nil {
+			t.Fatal(err)
+		}
+		var buffer1 bytes.Buffer
+		var buffer2 bytes.Buffer
+		stream1 := p2ptest.NewStream(&buffer1, &buffer2)
+		stream2 := p2ptest.NewStream(&buffer2, &buffer1)
+
+		w := protobuf.NewWriter(stream2)
+		if err := w.WriteMsg(&pb.Syn{
+			ObservedUnderlay: node1maBinary,
+			ProtocolVersion:  handshake.MaxSupportedVersion,
+			NetworkID:        5,
+		}); err != nil {
+			t.Fatal(err)
+		}
+
+		res, err := handshakeService.Handle(context.Background(), stream1, node2AddrInfo.Addrs[0], node2AddrInfo.ID)
+		if res != nil {
+			t.Fatal("res should be nil")
+		}
+
+		var e *handshake.NetworkIDMismatchError
+		if !errors.As(err, &e) {
+			t.Fatalf("expected network ID mismatch error, got %v", err)
+		}
+		if e.Local != networkID || e.Remote != 5 {
+			t.Fatalf("got network IDs local %d remote %d", e.Local, e.Remote)
+		}
+
+		if buffer2.Len() != 0 {
+			t.Fatal("synack should not be written")
+		}
+
+		if !stream1.IsReset() {
+			t.Fatal("stream is not reset")
+		}
+	})
+
+	t.Run("Handle - legacy peer", func(t *testing.T) {
+		for _, tc := range []struct {
+			name         string
+			legacyPeers  bool
+			minVersion   uint32
+			synVersion   uint32
+			synNetworkID uint64
+			networkID    uint64
+			signature    []byte
+			wantErr      error
+		}{
+			{
+				name:        "accepted",
+				legacyPeers: true,
+				minVersion:  handshake.MinSupportedVersion,
+				networkID:   networkID,
+			},
+			{
+				name:        "network id checked in ack",
+				legacyPeers: true,
+				minVersion:  handshake.MinSupportedVersion,
+				networkID:   5,
+				wantErr:     handshake.ErrNetworkIDMismatch,
+			},
+			{
+				name:        "rejected by min version",
+				legacyPeers: true,
+				minVersion:  handshake.LegacyVersion + 1,
+				networkID:   networkID,
+				wantErr:     handshake.ErrVersionMismatch,
+			},
+			{
+				name:        "signed ack verified",
+				legacyPeers: true,
+				minVersion:  handshake.MinSupportedVersion,
+				networkID:   networkID,
+				signature:   []byte("invalid"),
+				wantErr:     handshake.ErrInvalidHandshakeSignature,
+			},
+			{
+				name:         "not allowed",
+				minVersion:   handshake.MinSupportedVersion,
+				synNetworkID: networkID,
+				networkID:    networkID,
+				wantErr:      handshake.ErrVersionMismatch,
+			},
+			{
+				name:       "syn network id checked if not allowed",
+				minVersion: handshake.MinSupportedVersion,
+				networkID:  networkID,
+				wantErr:    handshake.ErrNetworkIDMismatch,
+			},
+			{
+				name:         "unsigned ack with version not allowed",
+				minVersion:   handshake.MinSupportedVersion,
+				synVersion:   handshake.LegacyVersion,
+				synNetworkID: networkID,
+				networkID:    networkID,
+				wantErr:      handshake.ErrInvalidHandshakeSignature,
+			},
+		} {
+			t.Run(tc.name, func(t *testing.T) {
+				handshakeService, err := handshake.New(signer1, aaddresser, senderMatcher, node1Info.BzzAddress.Overlay, networkID, tc.minVersion, handshake.MaxSupportedVersion, true, nil, nil, "", logger, handshake.WithLegacyPeers(tc.legacyPeers))
+				if err != nil {
+					t.Fatal(err)
+				}
+				var buffer1 bytes.Buffer
+				var buffer2 bytes.Buffer
+				stream1 := p2ptest.NewStream(&buffer1, &buffer2)
+				stream2 := p2ptest.NewStream(&buffer2, &buffer1)
+
+				// the syn and the ack of a peer which predates the version
+				// negotiation and the network id in the syn
+				w, r := protobuf.NewWriterAndReader(stream2)
+				if err := w.WriteMsg(&pb.Syn{
+					ObservedUnderlay: node1maBinary,
+					ProtocolVersion:  tc.synVersion,
+					NetworkID:        tc.synNetworkID,
+				}); err != nil {
+					t.Fatal(err)
+				}
+				if err := w.WriteMsg(&pb.Ack{
+					Address: &pb.BzzAddress{
+						Underlay:  node2maBinary,
+						Overlay:   node2BzzAddress.Overlay.Bytes(),
+						Signature: node2BzzAddress.Signature,
+					},
+					NetworkID: tc.networkID,
+					FullNode:  true,
+					Signature: tc.signature,
+				}); err != nil {
+					t.Fatal(err)
+				}
+
+				res, err := handshakeService.Handle(context.Background(), stream1, node2AddrInfo.Addrs[0], node2AddrInfo.ID)
+				if tc.wantErr != nil {
+					if !errors.Is(err, tc.wantErr) {
+						t.Fatalf("expected %v, got %v", tc.wantErr, err)
+					}
+					if !stream1.IsReset() {
+						t.Fatal("stream is not reset")
+					}
+					return
+				}
+				if err != nil {
+					t.Fatal(err)
+				}
+
+				testInfo(t, *res, node2Info)
+				if res.ProtocolVersion != handshake.LegacyVersion {
+					t.Fatalf("got protocol version %d, want %d", res.ProtocolVersion, handshake.LegacyVersion)
+				}
+
+				var got pb.SynAck
+				if err := r.ReadMsg(&got); err != nil {
+					t.Fatal(err)
+				}
+				if got.Ack.ProtocolVersion != handshake.LegacyVersion {
+					t.Fatalf("got synack protocol version %d, want %d", got.Ack.ProtocolVersion, handshake.LegacyVersion)
+				}
+			})
+		}
+	})
+
+	t.Run("Handle - light node limit", func(t *testing.T) {
+		var rejected []swarm.Address
+		handshakeService, err := handshake.New(signer1, aaddresser, senderMatcher, node1Info.BzzAddress.Overlay, networkID, handshake.MinSupportedVersion, handshake.MaxSupportedVersion, true, nil, nil, "", logger,
+			handshake.WithLightNodeLimit(1),
+			handshake.WithLightNodeRejectedFunc(func(overlay swarm.Address) {
+				rejected = append(rejected, overlay)
+			}),
+		)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		node1AddrInfo, err := libp2ppeer.AddrInfoFromP2pAddr(node1ma)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		// each handshake is signed over a new nonce to not be rejected as replayed
+		handle := func(peerID libp2ppeer.ID, nonce []byte) error {
+			signature, err := signer2.Sign(handshake.SignData(networkID, node2BzzAddress.Overlay, nonce, challenge, handshake.MaxSupportedVersion, handshake.MaxSupportedVersion, timestamp, nil))
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			var buffer1 bytes.Buffer
+			var buffer2 bytes.Buffer
+			stream1 := p2ptest.NewStream(&buffer1, &buffer2)
+			stream2 := p2ptest.NewStream(&buffer2, &buffer1)
+
+			w := protobuf.NewWriter(stream2)
+			if err := w.WriteMsg(&pb.Syn{
+				ObservedUnderlay: node1maBinary,
+				ProtocolVersion:  handshake.MaxSupportedVersion,
+				NetworkID:        networkID,
+			}); err != nil {
+				t.Fatal(err)
+			}
+
+			if err := w.WriteMsg(&pb.Ack{
+				Address: &pb.BzzAddress{
+					Underlay:  node2maBinary,
+					Overlay:   node2BzzAddress.Overlay.Bytes(),
+					Signature: node2BzzAddress.Signature,
+				},
+				NetworkID:          networkID,
+				FullNode:           false,
+				ProtocolVersion:    handshake.MaxSupportedVersion,
+				MaxProtocolVersion: handshake.MaxSupportedVersion,
+				Timestamp:          timestamp,
+				Nonce:              nonce,
+				Signature:          signature,
+			}); err != nil {
+				t.Fatal(err)
+			}
+
+			_, err = handshakeService.Handle(context.Background(), stream1, node2AddrInfo.Addrs[0], peerID)
+			return err
+		}
+
+		if err := handle(node2AddrInfo.ID, bytes.Repeat([]byte{1}, 32)); err != nil {
+			t.Fatal(err)
+		}
+
+		if err := handle(node1AddrInfo.ID, bytes.Repeat([]byte{2}, 32)); !errors.Is(err, handshake.ErrLightNodeRejected) {
+			t.Fatalf("expected error %v, got %v", handshake.ErrLightNodeRejected, err)
+		}
+
+		if len(rejected) != 1 || !rejected[0].Equal(node2BzzAddress.Overlay) {
+			t.Fatalf("got rejected %v, want %v", rejected, []swarm.Address{node2BzzAddress.Overlay})
+		}
+	})
+
+	t.Run("mode update", func(t *testing.T) {
+		handshakeService, err := handshake.New(signer1, aaddresser, senderMatcher, node1Info.BzzAddress.Overlay, networkID, handshake.MinSupportedVersion, handshake.MaxSupportedVersion, true, nil, nil, "", logger,
+			handshake.WithLightNodeLimit(1),
+		)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		node1AddrInfo, err := libp2ppeer.AddrInfoFromP2pAddr(node1ma)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		update := func(peerID libp2ppeer.ID, light bool) (bool, error) {
+			var buffer1 bytes.Buffer
+			var buffer2 bytes.Buffer
+			stream1 := p2ptest.NewStream(&buffer1, &buffer2)
+			stream2 := p2ptest.NewStream(&buffer2, &buffer1)
+
+			if err := handshakeService.NotifyMode(context.Background(), stream2, light); err != nil {
+				t.Fatal(err)
+			}
+			return handshakeService.HandleModeUpdate(context.Background(), stream1, peerID)
+		}
+
+		for _, tc := range []struct {
+			peerID       libp2ppeer.ID
+			light        bool
+			wantFullNode bool
+			wantErr      error
+		}{
+			{peerID: node2AddrInfo.ID, light: true},
+			{peerID: node2AddrInfo.ID, light: true},
+			{peerID: node1AddrInfo.ID, light: true, wantErr: handshake.ErrLightNodeRejected},
+			{peerID: node2AddrInfo.ID, light: false, wantFullNode: true},
+			{peerID: node1AddrInfo.ID, light: true},
+		} {
+			fullNode, err := update(tc.peerID, tc.light)
+			if !errors.Is(err, tc.wantErr) {
+				t.Fatalf("peer %s light %v: got error %v, want %v", tc.peerID, tc.light, err, tc.wantErr)
+			}
+			if fullNode != tc.wantFullNode {
+				t.Fatalf("peer %s light %v: got full node %v, want %v", tc.peerID, tc.light, fullNode, tc.wantFullNode)
+			}
+		}
+
+		t.Run("read error", func(t *testing.T) {
+			var buffer1 bytes.Buffer
+			var buffer2 bytes.Buffer
+			stream := p2ptest.NewStream(&buffer1, &buffer2)
+			testErr := errors.New("test error")
+			stream.SetReadError(testErr, 0)
+
+			if _, err := handshakeService.HandleModeUpdate(context.Background(), stream, node2AddrInfo.ID); !errors.Is(err, testErr) {
+				t.Fatalf("got error %v, want %v", err, testErr)
+			}
+		})
+	})
+
+	t.Run("new peer", func(t *testing.T) {
+		info := handshake.Info{
+			BzzAddress: node2BzzAddress,
+			FullNode:   true,
+		}
+
+		peer, err := handshake.NewPeer(info, node2ma)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !peer.Address.Equal(node2BzzAddress.Overlay) || peer.ID != node2AddrInfo.ID || !peer.FullNode {
+			t.Fatalf("got peer %v %s full node %v, want %v %s full node %v", peer.Address, peer.ID, peer.FullNode, node2BzzAddress.Overlay, node2AddrInfo.ID, true)
+		}
+
+		other, err := handshake.NewPeer(handshake.Info{BzzAddress: node1BzzAddress, FullNode: true}, node1ma)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if peer.Key() == other.Key() {
+			t.Fatalf("peers %s and %s have the same key", peer.ID, other.ID)
+		}
+		same, err := handshake.NewPeer(info, node2ma)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if peer.Key() != same.Key() {
+			t.Fatal("key of the same peer is not stable")
+		}
+
+		if _, err := handshake.NewPeer(info, node1ma); !errors.Is(err, handshake.ErrPeerIDMismatch) {
+			t.Fatalf("got error %v, want %v", err, handshake.ErrPeerIDMismatch)
+		}
+
+		if _, err := handshake.NewPeer(info, node2AddrInfo.Addrs[0]); err == nil {
+			t.Fatal("expected error for underlay without peer id")
+		}
+
+		if _, err := handshake.NewPeer(handshake.Info{}, node2ma); !errors.Is(err, handshake.ErrInvalidAck) {
+			t.Fatalf("got error %v, want %v", err, handshake.ErrInvalidAck)
+		}
+	})
+
+	t.Run("Handle - rate limit", func(t *testing.T) {
+		now := time.Unix(1600000000, 0)
+		handshake.SetTimeNow(func() time.Time { return now })
+		defer handshake.SetTimeNow(time.Now)
+
+		handshakeService, err := handshake.New(signer1, aaddresser, senderMatcher, node1Info.BzzAddress.Overlay, networkID, handshake.MinSupportedVersion, handshake.MaxSupportedVersion, true, nil, nil, "", logger, handshake.WithHandshakeRateLimit(1, 2))
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		// the handshakes fail on reading the syn, the rate limit is checked before
+		handle := func(addr ma.Multiaddr) error {
+			stream := &p2ptest.Stream{}
+			stream.SetReadError(io.EOF, 0)
+			_, err := handshakeService.Handle(context.Background(), stream, addr, node2AddrInfo.ID)
+			return err
+		}
+
+		var (
+			wg      sync.WaitGroup
+			mu      sync.Mutex
+			limited int
+		)
+		for i := 0; i < 10; i++ {
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				if errors.Is(handle(node2AddrInfo.Addrs[0]), handshake.ErrHandshakeRateLimited) {
+					mu.Lock()
+					limited++
+					mu.Unlock()
+				}
+			}()
+		}
+		wg.Wait()
+		if limited != 8 {
+			t.Fatalf("got %d rate limited handshakes, want %d", limited, 8)
+		}
+
+		now = now.Add(time.Second)
+		if err := handle(node2AddrInfo.Addrs[0]); errors.Is(err, handshake.ErrHandshakeRateLimited) {
+			t.Fatal("handshake is rate limited after the token is refilled")
+		}
+		if err := handle(node2AddrInfo.Addrs[0]); !errors.Is(err, handshake.ErrHandshakeRateLimited) {
+			t.Fatalf("expected %v, got %v", handshake.ErrHandshakeRateLimited, err)
+		}
+
+		// the idle limiter is pruned
+		otherAddr, err := ma.NewMultiaddr("/ip4/10.0.0.1/tcp/1634")
+		if err != nil {
+			t.Fatal(err)
+		}
+		now = now.Add(time.Minute)
+		if err := handle(otherAddr); errors.Is(err, handshake.ErrHandshakeRateLimited) {
+			t.Fatal("handshake from another address is rate limited")
+		}
+		if got := handshakeService.RateLimitedAddresses(); got != 1 {
+			t.Fatalf("got %d rate limited addresses, want %d", got, 1)
+		}
+	})
+
+	t.Run("Handle - invalid rate limit", func(t *testing.T) {
+		for _, tc := range []struct {
+			name  string
+			rps   float64
+			burst int
+		}{
+			{name: "zero rate", rps: 0, burst: 1},
+			{name: "negative rate", rps: -1, burst: 1},
+			{name: "zero burst", rps: 1, burst: 0},
+			{name: "negative burst", rps: 1, burst: -1},
+		} {
+			t.Run(tc.name, func(t *testing.T) {
+				_, err := handshake.New(signer1, aaddresser, senderMatcher, node1Info.BzzAddress.Overlay, networkID, handshake.MinSupportedVersion, handshake.MaxSupportedVersion, true, nil, nil, "", logger, handshake.WithHandshakeRateLimit(tc.rps, tc.burst))
+				if !errors.Is(err, handshake.ErrInvalidRateLimit) {
+					t.Fatalf("expected error %v, got %v", handshake.ErrInvalidRateLimit, err)
+				}
+			})
+		}
+	})
+
+	t.Run("Handle - admission", func(t *testing.T) {
+		errBlocked := errors.New("blocked")
+
+		handle := func(admit func(handshake.Info) error) (*handshake.Info, error) {
+			handshakeService, err := handshake.New(signer1, aaddresser, senderMatcher, node1Info.BzzAddress.Overlay, networkID, handshake.MinSupportedVersion, handshake.MaxSupportedVersion, true, nil, nil, "", logger, handshake.WithAdmissionFunc(admit))
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			var buffer1 bytes.Buffer
+			var buffer2 bytes.Buffer
+			stream1 := p2ptest.NewStream(&buffer1, &buffer2)
+			stream2 := p2ptest.NewStream(&buffer2, &buffer1)
+
+			w := protobuf.NewWriter(stream2)
+			if err := w.WriteMsg(&pb.Syn{
+				ObservedUnderlay: node1maBinary,
+				ProtocolVersion:  handshake.MaxSupportedVersion,
+				NetworkID:        networkID,
+			}); err != nil {
+				t.Fatal(err)
+			}
+
+			if err := w.WriteMsg(&pb.Ack{
+				Address: &pb.BzzAddress{
+					Underlay:  node2maBinary,
+					Overlay:   node2BzzAddress.Overlay.Bytes(),
+					Signature: node2BzzAddress.Signature,
+				},
+				NetworkID:          networkID,
+				FullNode:           true,
+				ProtocolVersion:    handshake.MaxSupportedVersion,
+				MaxProtocolVersion: handshake.MaxSupportedVersion,
+				Timestamp:          timestamp,
+				Nonce:              nonce,
+				Signature:          node2AckSignature,
+			}); err != nil {
+				t.Fatal(err)
+			}
+
+			return handshakeService.Handle(context.Background(), stream1, node2AddrInfo.Addrs[0], node2AddrInfo.ID)
+		}
+
+		var admitted []swarm.Address
+		res, err := handle(func(info handshake.Info) error {
+			admitted = append(admitted, info.BzzAddress.Overlay)
+			return nil
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+		testInfo(t, *res, node2Info)
+		if len(admitted) != 1 || !admitted[0].Equal(node2BzzAddress.Overlay) {
+			t.Fatalf("got admitted %v, want %v", admitted, []swarm.Address{node2BzzAddress.Overlay})
+		}
+
+		_, err = handle(func(info handshake.Info) error {
+			return errBlocked
+		})
+		if !errors.Is(err, handshake.ErrPeerRejected) {
+			t.Fatalf("expected error %v, got %v", handshake.ErrPeerRejected, err)
+		}
+		if !strings.Contains(err.Error(), errBlocked.Error()) {
+			t.Fatalf("error %q does not contain the admission error %q", err, errBlocked)
+		}
+		if handshake.IsRetryable(err) {
+			t.Fatal("rejected handshake is retryable")
+		}
+	})
+
+	t.Run("Handle - duplicate handshake", func(t *testing.T) {
+		handshakeService, err := handshake.New(signer1, aaddresser, senderMatcher, node1Info.BzzAddress.Overlay, networkID, handshake.MinSupportedVersion, handshake.MaxSupportedVersion, true, nil, nil, "", logger)
+		if err != nil {
+			t.Fatal(err)
+		}
+		var buffer1 bytes.Buffer
+		var buffer2 bytes.Buffer
+		stream1 := p2ptest.NewStream(&buffer1, &buffer2)
+		stream2 := p2ptest.NewStream(&buffer2, &buffer1)
+
+		w := protobuf.NewWriter(stream2)
+		if err := w.WriteMsg(&pb.Syn{
+			ObservedUnderlay: node1maBinary,
+			ProtocolVersion:  handshake.MaxSupportedVersion,
+			NetworkID:        networkID,
+		}); err != nil {
+			t.Fatal(err)
+		}
+
+		if err := w.WriteMsg(&pb.Ack{
+			Address: &pb.BzzAddress{
+				Underlay:  node2maBinary,
+				Overlay:   node2BzzAddress.Overlay.Bytes(),
+				Signature: node2BzzAddress.Signature,
+			},
+			NetworkID:          networkID,
+			FullNode:           true,
+			ProtocolVersion:    handshake.MaxSupportedVersion,
+			MaxProtocolVersion: handshake.MaxSupportedVersion,
+			Timestamp:          timestamp,
+			Nonce:              nonce,
+			Signature:          node2AckSignature,
+		}); err != nil {
+			t.Fatal(err)
+		}
+
+		res, err := handshakeService.Handle(context.Background(), stream1, node2AddrInfo.Addrs[0], node2AddrInfo.ID)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		testInfo(t, *res, node2Info)
+
+		_, r := protobuf.NewWriterAndReader(stream2)
+		var got pb.SynAck
+		if err := r.ReadMsg(&got); err != nil {
+			t.Fatal(err)
+		}
+
+		if !bytes.Equal(got.Syn.ObservedUnderlay, node2maBinary) {
+			t.Fatalf("got bad syn")
+		}
+
+		bzzAddress, err := bzz.ParseAddress(got.Ack.Address.Underlay, got.Ack.Address.Overlay, got.Ack.Address.Signature, got.Ack.NetworkID)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		testInfo(t, node1Info, handshake.Info{
+			BzzAddress: bzzAddress,
+			FullNode:   got.Ack.FullNode,
+		})
+
+		_, err = handshakeService.Handle(context.Background(), stream1, node2AddrInfo.Addrs[0], node2AddrInfo.ID)
+		if err != handshake.ErrHandshakeDuplicate {
+			t.Fatalf("expected %s, got %s", handshake.ErrHandshakeDuplicate, err)
+		}
+
+		if !stream1.IsReset() {
+			t.Fatal("stream is not reset")
+		}
+	})
+
+	t.Run("Handle - invalid ack", func(t *testing.T) {
+		handshakeService, err := handshake.New(signer1, aaddresser, senderMatcher, node1Info.BzzAddress.Overlay, networkID, handshake.MinSupportedVersion, handshake.MaxSupportedVersion, true, nil, nil, "", logger)
+		if err != nil {
+			t.Fatal(err)
+		}
+		var buffer1 bytes.Buffer
+		var buffer2 bytes.Buffer
+		stream1 := p2ptest.NewStream(&buffer1, &buffer2)
+		stream2 := p2ptest.NewStream(&buffer2, &buffer1)
+
+		w := protobuf.NewWriter(stream2)
+		if err := w.WriteMsg(&pb.Syn{
 			ObservedUnderlay: node1maBinary,
+			ProtocolVersion:  handshake.MaxSupportedVersion,
+			NetworkID:        networkID,
+		}); err != nil {
+			t.Fatal(err)
+		}
+
+		if err := w.WriteMsg(&pb.Ack{
+			Address: &pb.BzzAddress{
+				Underlay:  node2maBinary,
+				Overlay:   node2BzzAddress.Overlay.Bytes(),
+				Signature: node1BzzAddress.Signature,
+			},
+			NetworkID:          networkID,
+			FullNode:           true,
+			ProtocolVersion:    handshake.MaxSupportedVersion,
+			MaxProtocolVersion: handshake.MaxSupportedVersion,
+			Timestamp:          timestamp,
+			Nonce:              nonce,
+			Signature:          node2AckSignature,
+		}); err != nil {
+			t.Fatal(err)
+		}
+
+		_, err = handshakeService.Handle(context.Background(), stream1, node2AddrInfo.Addrs[0], node2AddrInfo.ID)
+		if err != handshake.ErrInvalidAck {
+			t.Fatalf("expected %s, got %v", handshake.ErrInvalidAck, err)
+		}
+
+		if !stream1.IsReset() {
+			t.Fatal("stream is not reset")
+		}
+	})
+
+	t.Run("Handle - invalid remote address", func(t *testing.T) {
+		for _, tc := range []struct {
+			name              string
+			address           *pb.BzzAddress
+			retryAfterSeconds uint32
+		}{
+			{
+				name: "no address",
+			},
+			{
+				// only the synack may tell to try again later
+				name:              "try again later without address",
+				retryAfterSeconds: 1,
+			},
+			{
+				name:    "empty address",
+				address: &pb.BzzAddress{},
+			},
+			{
+				name: "empty underlay",
+				address: &pb.BzzAddress{
+					Overlay:   node2BzzAddress.Overlay.Bytes(),
+					Signature: node2BzzAddress.Signature,
+				},
+			},
+			{
+				name: "empty overlay",
+				address: &pb.BzzAddress{
+					Underlay:  node2maBinary,
+					Signature: node2BzzAddress.Signature,
+				},
+			},
+			{
+				name: "short overlay",
+				address: &pb.BzzAddress{
+					Underlay:  node2maBinary,
+					Overlay:   node2BzzAddress.Overlay.Bytes()[1:],
+					Signature: node2BzzAddress.Signature,
+				},
+			},
+		} {
+			t.Run(tc.name, func(t *testing.T) {
+				handshakeService, err := handshake.New(signer1, aaddresser, senderMatcher, node1Info.BzzAddress.Overlay, networkID, handshake.MinSupportedVersion, handshake.MaxSupportedVersion, true, nil, nil, "", logger)
+				if err != nil {
+					t.Fatal(err)
+				}
+				var buffer1 bytes.Buffer
+				var buffer2 bytes.Buffer
+				stream1 := p2ptest.NewStream(&buffer1, &buffer2)
+				stream2 := p2ptest.NewStream(&buffer2, &buffer1)
+
+				w := protobuf.NewWriter(stream2)
+				if err := w.WriteMsg(&pb.Syn{
+					ObservedUnderlay: node1maBinary,
+					ProtocolVersion:  handshake.MaxSupportedVersion,
+					NetworkID:        networkID,
+				}); err != nil {
+					t.Fatal(err)
+				}
+
+				if err := w.WriteMsg(&pb.Ack{
+					Address:            tc.address,
+					NetworkID:          networkID,
+					FullNode:           true,
+					ProtocolVersion:    handshake.MaxSupportedVersion,
+					MaxProtocolVersion: handshake.MaxSupportedVersion,
+					Timestamp:          timestamp,
+					Nonce:              nonce,
+					Signature:          node2AckSignature,
+					RetryAfterSeconds:  tc.retryAfterSeconds,
+				}); err != nil {
+					t.Fatal(err)
+				}
+
+				_, err = handshakeService.Handle(context.Background(), stream1, node2AddrInfo.Addrs[0], node2AddrInfo.ID)
+				if !errors.Is(err, handshake.ErrInvalidRemoteAddress) {
+					t.Fatalf("expected %s, got %v", handshake.ErrInvalidRemoteAddress, err)
+				}
+				if handshake.IsRetryable(err) {
+					t.Fatalf("error %v is retryable", err)
+				}
+
+				if !stream1.IsReset() {
+					t.Fatal("stream is not reset")
+				}
+			})
+		}
+	})
+
+	t.Run("Handshake - invalid remote address", func(t *testing.T) {
+		var buffer1 bytes.Buffer
+		var buffer2 bytes.Buffer
+		stream1 := p2ptest.NewStream(&buffer1, &buffer2)
+		stream2 := p2ptest.NewStream(&buffer2, &buffer1)
+
+		w := protobuf.NewWriter(stream2)
+		if err := w.WriteMsg(&pb.SynAck{
+			Syn: &pb.Syn{
+				ObservedUnderlay: node1maBinary,
+			},
+			Ack: &pb.Ack{
+				Address: &pb.BzzAddress{
+					Underlay:  node2maBinary,
+					Signature: node2BzzAddress.Signature,
+				},
+				NetworkID:       networkID,
+				FullNode:        true,
+				ProtocolVersion: handshake.MaxSupportedVersion,
+			},
+		}); err != nil {
+			t.Fatal(err)
+		}
+
+		res, err := handshakeService.Handshake(context.Background(), stream1, node2AddrInfo.Addrs[0], node2AddrInfo.ID)
+		if res != nil {
+			t.Fatal("res should be nil")
+		}
+		if !errors.Is(err, handshake.ErrInvalidRemoteAddress) {
+			t.Fatalf("expected %s, got %v", handshake.ErrInvalidRemoteAddress, err)
+		}
+	})
+
+	t.Run("Handshake - synack without ack", func(t *testing.T) {
+		var buffer1 bytes.Buffer
+		var buffer2 bytes.Buffer
+		stream1 := p2ptest.NewStream(&buffer1, &buffer2)
+		stream2 := p2ptest.NewStream(&buffer2, &buffer1)
+
+		w := protobuf.NewWriter(stream2)
+		if err := w.WriteMsg(&pb.SynAck{
+			Syn: &pb.Syn{
+				ObservedUnderlay: node1maBinary,
+			},
 		}); err != nil {
 			t.Fatal(err)
 		}
 
-		res, err := handshakeService.Handle(context.Background(), stream, node2AddrInfo.Addrs[0], node2AddrInfo.ID)
-		if err == nil || err.Error() != expectedErr.Error() {
-			t.Fatal("expected:", expectedErr, "got:", err)
+		_, err := handshakeService.Handshake(context.Background(), stream1, node2AddrInfo.Addrs[0], node2AddrInfo.ID)
+		if !errors.Is(err, handshake.ErrInvalidAck) {
+			t.Fatalf("expected %s, got %v", handshake.ErrInvalidAck, err)
 		}
-
-		if res != nil {
-			t.Fatal("handshake returned non-nil res")
+		if handshake.IsRetryable(err) {
+			t.Fatalf("error %v is retryable", err)
 		}
 	})
 
-	t.Run("Handle - ack read error ", func(t *testing.T) {
-		handshakeService, err := handshake.New(signer1, aaddresser, senderMatcher, node1Info.BzzAddress.Overlay, networkID, true, nil, "", logger)
+	t.Run("Handle - self connection", func(t *testing.T) {
+		handshakeService, err := handshake.New(signer1, aaddresser, senderMatcher, node1Info.BzzAddress.Overlay, networkID, handshake.MinSupportedVersion, handshake.MaxSupportedVersion, true, nil, nil, "", logger)
 		if err != nil {
 			t.Fatal(err)
 		}
-		testErr := errors.New("test error")
-		expectedErr := fmt.Errorf("read ack message: %w", testErr)
 		var buffer1 bytes.Buffer
 		var buffer2 bytes.Buffer
-		stream1 := mock.NewStream(&buffer1, &buffer2)
-		stream2 := mock.NewStream(&buffer2, &buffer1)
-		stream1.SetReadErr(testErr, 1)
+		stream1 := p2ptest.NewStream(&buffer1, &buffer2)
+		stream2 := p2ptest.NewStream(&buffer2, &buffer1)
+
 		w := protobuf.NewWriter(stream2)
 		if err := w.WriteMsg(&pb.Syn{
 			ObservedUnderlay: node1maBinary,
+			ProtocolVersion:  handshake.MaxSupportedVersion,
+			NetworkID:        networkID,
 		}); err != nil {
 			t.Fatal(err)
 		}
 
-		res, err := handshakeService.Handle(context.Background(), stream1, node2AddrInfo.Addrs[0], node2AddrInfo.ID)
-		if err == nil || err.Error() != expectedErr.Error() {
-			t.Fatal("expected:", expectedErr, "got:", err)
+		if err := w.WriteMsg(&pb.Ack{
+			Address: &pb.BzzAddress{
+				Underlay:  node1maBinary,
+				Overlay:   node1BzzAddress.Overlay.Bytes(),
+				Signature: node1BzzAddress.Signature,
+			},
+			NetworkID:       networkID,
+			FullNode:        true,
+			ProtocolVersion: handshake.MaxSupportedVersion,
+		}); err != nil {
+			t.Fatal(err)
 		}
 
+		res, err := handshakeService.Handle(context.Background(), stream1, node2AddrInfo.Addrs[0], node2AddrInfo.ID)
 		if res != nil {
-			t.Fatal("handshake returned non-nil res")
+			t.Fatal("res should be nil")
+		}
+
+		if !errors.Is(err, handshake.ErrSelfConnection) {
+			t.Fatalf("expected %v, got %v", handshake.ErrSelfConnection, err)
+		}
+
+		if !stream1.IsReset() {
+			t.Fatal("stream is not reset")
 		}
 	})
 
-	t.Run("Handle - networkID mismatch ", func(t *testing.T) {
-		handshakeService, err := handshake.New(signer1, aaddresser, senderMatcher, node1Info.BzzAddress.Overlay, networkID, true, nil, "", logger)
+	t.Run("Handle - invalid signature", func(t *testing.T) {
+		handshakeService, err := handshake.New(signer1, aaddresser, senderMatcher, node1Info.BzzAddress.Overlay, networkID, handshake.MinSupportedVersion, handshake.MaxSupportedVersion, true, nil, nil, "", logger)
 		if err != nil {
 			t.Fatal(err)
 		}
 		var buffer1 bytes.Buffer
 		var buffer2 bytes.Buffer
-		stream1 := mock.NewStream(&buffer1, &buffer2)
-		stream2 := mock.NewStream(&buffer2, &buffer1)
+		stream1 := p2ptest.NewStream(&buffer1, &buffer2)
+		stream2 := p2ptest.NewStream(&buffer2, &buffer1)
 
 		w := protobuf.NewWriter(stream2)
 		if err := w.WriteMsg(&pb.Syn{
 			ObservedUnderlay: node1maBinary,
+			ProtocolVersion:  handshake.MaxSupportedVersion,
+			NetworkID:        networkID,
 		}); err != nil {
 			t.Fatal(err)
 		}
 
+		tamperedSignature := make([]byte, len(node2AckSignature))
+		copy(tamperedSignature, node2AckSignature)
+		tamperedSignature[0]++
+
 		if err := w.WriteMsg(&pb.Ack{
 			Address: &pb.BzzAddress{
 				Underlay:  node2maBinary,
 				Overlay:   node2BzzAddress.Overlay.Bytes(),
 				Signature: node2BzzAddress.Signature,
 			},
-			NetworkID: 5,
-			FullNode:  true,
+			NetworkID:          networkID,
+			FullNode:           true,
+			ProtocolVersion:    handshake.MaxSupportedVersion,
+			MaxProtocolVersion: handshake.MaxSupportedVersion,
+			Timestamp:          timestamp,
+			Nonce:              nonce,
+			Signature:          tamperedSignature,
 		}); err != nil {
 			t.Fatal(err)
 		}
@@ -535,24 +2765,32 @@ func TestHandshake(t *testing.T) {
 			t.Fatal("res should be nil")
 		}
 
-		if err != handshake.ErrNetworkIDIncompatible {
-			t.Fatalf("expected %s, got %s", handshake.ErrNetworkIDIncompatible, err)
+		if !errors.Is(err, handshake.ErrInvalidHandshakeSignature) {
+			t.Fatalf("expected %v, got %v", handshake.ErrInvalidHandshakeSignature, err)
+		}
+
+		if !stream1.IsReset() {
+			t.Fatal("stream is not reset")
 		}
 	})
 
-	t.Run("Handle - duplicate handshake", func(t *testing.T) {
-		handshakeService, err := handshake.New(signer1, aaddresser, senderMatcher, node1Info.BzzAddress.Overlay, networkID, true, nil, "", logger)
+	t.Run("Handle - transaction is not on the blockchain", func(t *testing.T) {
+		sbMock := &MockSenderMatcher{v: false}
+
+		handshakeService, err := handshake.New(signer1, aaddresser, sbMock, node1Info.BzzAddress.Overlay, networkID, handshake.MinSupportedVersion, handshake.MaxSupportedVersion, true, []byte("0xff"), nil, "", logger)
 		if err != nil {
 			t.Fatal(err)
 		}
 		var buffer1 bytes.Buffer
 		var buffer2 bytes.Buffer
-		stream1 := mock.NewStream(&buffer1, &buffer2)
-		stream2 := mock.NewStream(&buffer2, &buffer1)
+		stream1 := p2ptest.NewStream(&buffer1, &buffer2)
+		stream2 := p2ptest.NewStream(&buffer2, &buffer1)
 
 		w := protobuf.NewWriter(stream2)
 		if err := w.WriteMsg(&pb.Syn{
 			ObservedUnderlay: node1maBinary,
+			ProtocolVersion:  handshake.MaxSupportedVersion,
+			NetworkID:        networkID,
 		}); err != nil {
 			t.Fatal(err)
 		}
@@ -563,58 +2801,218 @@ func TestHandshake(t *testing.T) {
 				Overlay:   node2BzzAddress.Overlay.Bytes(),
 				Signature: node2BzzAddress.Signature,
 			},
-			NetworkID: networkID,
-			FullNode:  true,
+			NetworkID:          networkID,
+			FullNode:           true,
+			ProtocolVersion:    handshake.MaxSupportedVersion,
+			MaxProtocolVersion: handshake.MaxSupportedVersion,
+			Timestamp:          timestamp,
+			Nonce:              nonce,
+			Signature:          node2AckSignature,
 		}); err != nil {
 			t.Fatal(err)
 		}
 
-		res, err := handshakeService.Handle(context.Background(), stream1, node2AddrInfo.Addrs[0], node2AddrInfo.ID)
+		_, err = handshakeService.Handle(context.Background(), stream1, node2AddrInfo.Addrs[0], node2AddrInfo.ID)
+		if !errors.Is(err, handshake.ErrAddressNotFound) {
+			t.Fatalf("expected error %v, got %v", handshake.ErrAddressNotFound, err)
+		}
+
+		if !stream1.IsReset() {
+			t.Fatal("stream is not reset")
+		}
+	})
+
+	t.Run("Handle - advertisable error", func(t *testing.T) {
+		handshakeService, err := handshake.New(signer1, aaddresser, senderMatcher, node1Info.BzzAddress.Overlay, networkID, handshake.MinSupportedVersion, handshake.MaxSupportedVersion, true, nil, nil, "", logger)
 		if err != nil {
 			t.Fatal(err)
 		}
+		var buffer1 bytes.Buffer
+		var buffer2 bytes.Buffer
+		stream1 := p2ptest.NewStream(&buffer1, &buffer2)
+		stream2 := p2ptest.NewStream(&buffer2, &buffer1)
 
-		testInfo(t, *res, node2Info)
+		testError := errors.New("test error")
+		aaddresser.err = testError
+		defer func() {
+			aaddresser.err = nil
+		}()
 
-		_, r := protobuf.NewWriterAndReader(stream2)
-		var got pb.SynAck
-		if err := r.ReadMsg(&got); err != nil {
+		w := protobuf.NewWriter(stream2)
+		if err := w.WriteMsg(&pb.Syn{
+			ObservedUnderlay: node1maBinary,
+			ProtocolVersion:  handshake.MaxSupportedVersion,
+			NetworkID:        networkID,
+		}); err != nil {
 			t.Fatal(err)
 		}
 
-		if !bytes.Equal(got.Syn.ObservedUnderlay, node2maBinary) {
-			t.Fatalf("got bad syn")
+		res, err := handshakeService.Handle(context.Background(), stream1, node2AddrInfo.Addrs[0], node2AddrInfo.ID)
+		if err != testError {
+			t.Fatal("expected error")
 		}
 
-		bzzAddress, err := bzz.ParseAddress(got.Ack.Address.Underlay, got.Ack.Address.Overlay, got.Ack.Address.Signature, got.Ack.NetworkID)
-		if err != nil {
+		if res != nil {
+			t.Fatal("expected nil res")
+		}
+
+		if !stream1.IsReset() {
+			t.Fatal("stream is not reset")
+		}
+	})
+
+	t.Run("Handshake - version mismatch", func(t *testing.T) {
+		var buffer1 bytes.Buffer
+		var buffer2 bytes.Buffer
+		stream1 := p2ptest.NewStream(&buffer1, &buffer2)
+		stream2 := p2ptest.NewStream(&buffer2, &buffer1)
+
+		w := protobuf.NewWriter(stream2)
+		if err := w.WriteMsg(&pb.SynAck{
+			Syn: &pb.Syn{
+				ObservedUnderlay: node1maBinary,
+			},
+			Ack: &pb.Ack{
+				Address: &pb.BzzAddress{
+					Underlay:  node2maBinary,
+					Overlay:   node2BzzAddress.Overlay.Bytes(),
+					Signature: node2BzzAddress.Signature,
+				},
+				NetworkID:       networkID,
+				FullNode:        true,
+				ProtocolVersion: handshake.MaxSupportedVersion + 1,
+			},
+		}); err != nil {
 			t.Fatal(err)
 		}
 
-		testInfo(t, node1Info, handshake.Info{
-			BzzAddress: bzzAddress,
-			FullNode:   got.Ack.FullNode,
-		})
+		res, err := handshakeService.Handshake(context.Background(), stream1, node2AddrInfo.Addrs[0], node2AddrInfo.ID)
+		if res != nil {
+			t.Fatal("res should be nil")
+		}
 
-		_, err = handshakeService.Handle(context.Background(), stream1, node2AddrInfo.Addrs[0], node2AddrInfo.ID)
-		if err != handshake.ErrHandshakeDuplicate {
-			t.Fatalf("expected %s, got %s", handshake.ErrHandshakeDuplicate, err)
+		var e *handshake.VersionMismatchError
+		if !errors.As(err, &e) {
+			t.Fatalf("expected version mismatch error, got %v", err)
+		}
+		if e.Local != handshake.MaxSupportedVersion || e.Remote != handshake.MaxSupportedVersion+1 {
+			t.Fatalf("got versions local %d remote %d", e.Local, e.Remote)
+		}
+
+		if !stream1.IsReset() {
+			t.Fatal("stream is not reset")
 		}
 	})
 
-	t.Run("Handle - invalid ack", func(t *testing.T) {
-		handshakeService, err := handshake.New(signer1, aaddresser, senderMatcher, node1Info.BzzAddress.Overlay, networkID, true, nil, "", logger)
+	t.Run("Handshake - legacy peer", func(t *testing.T) {
+		for _, tc := range []struct {
+			name          string
+			legacyPeers   bool
+			minVersion    uint32
+			wantErr       bool
+			remoteVersion uint32
+		}{
+			{
+				name:        "accepted",
+				legacyPeers: true,
+				minVersion:  handshake.MinSupportedVersion,
+			},
+			{
+				name:          "rejected by min version",
+				legacyPeers:   true,
+				minVersion:    handshake.LegacyVersion + 1,
+				wantErr:       true,
+				remoteVersion: handshake.LegacyVersion,
+			},
+			{
+				name:       "not allowed",
+				minVersion: handshake.MinSupportedVersion,
+				wantErr:    true,
+			},
+		} {
+			t.Run(tc.name, func(t *testing.T) {
+				handshakeService, err := handshake.New(signer1, aaddresser, senderMatcher, node1Info.BzzAddress.Overlay, networkID, tc.minVersion, handshake.MaxSupportedVersion, true, nil, nil, "", logger, handshake.WithLegacyPeers(tc.legacyPeers))
+				if err != nil {
+					t.Fatal(err)
+				}
+				var buffer1 bytes.Buffer
+				var buffer2 bytes.Buffer
+				stream1 := p2ptest.NewStream(&buffer1, &buffer2)
+				stream2 := p2ptest.NewStream(&buffer2, &buffer1)
+
+				// the synack of a peer which predates the version negotiation
+				w, r := protobuf.NewWriterAndReader(stream2)
+				if err := w.WriteMsg(&pb.SynAck{
+					Syn: &pb.Syn{
+						ObservedUnderlay: node1maBinary,
+					},
+					Ack: &pb.Ack{
+						Address: &pb.BzzAddress{
+							Underlay:  node2maBinary,
+							Overlay:   node2BzzAddress.Overlay.Bytes(),
+							Signature: node2BzzAddress.Signature,
+						},
+						NetworkID: networkID,
+						FullNode:  true,
+					},
+				}); err != nil {
+					t.Fatal(err)
+				}
+
+				res, err := handshakeService.Handshake(context.Background(), stream1, node2AddrInfo.Addrs[0], node2AddrInfo.ID)
+				if tc.wantErr {
+					var e *handshake.VersionMismatchError
+					if !errors.As(err, &e) {
+						t.Fatalf("expected version mismatch error, got %v", err)
+					}
+					if e.Remote != tc.remoteVersion {
+						t.Fatalf("got remote version %d, want %d", e.Remote, tc.remoteVersion)
+					}
+					return
+				}
+				if err != nil {
+					t.Fatal(err)
+				}
+
+				testInfo(t, *res, node2Info)
+				if res.ProtocolVersion != handshake.LegacyVersion {
+					t.Fatalf("got protocol version %d, want %d", res.ProtocolVersion, handshake.LegacyVersion)
+				}
+
+				var syn pb.Syn
+				if err := r.ReadMsg(&syn); err != nil {
+					t.Fatal(err)
+				}
+				var ack pb.Ack
+				if err := r.ReadMsg(&ack); err != nil {
+					t.Fatal(err)
+				}
+				if ack.ProtocolVersion != handshake.LegacyVersion {
+					t.Fatalf("got ack protocol version %d, want %d", ack.ProtocolVersion, handshake.LegacyVersion)
+				}
+			})
+		}
+	})
+
+	t.Run("Handle - version negotiation", func(t *testing.T) {
+		handshakeService, err := handshake.New(signer1, aaddresser, senderMatcher, node1Info.BzzAddress.Overlay, networkID, 1, 3, true, nil, nil, "", logger)
+		if err != nil {
+			t.Fatal(err)
+		}
+		signature, err := signer2.Sign(handshake.SignData(networkID, node2BzzAddress.Overlay, nonce, challenge, 2, 2, timestamp, nil))
 		if err != nil {
 			t.Fatal(err)
 		}
 		var buffer1 bytes.Buffer
 		var buffer2 bytes.Buffer
-		stream1 := mock.NewStream(&buffer1, &buffer2)
-		stream2 := mock.NewStream(&buffer2, &buffer1)
+		stream1 := p2ptest.NewStream(&buffer1, &buffer2)
+		stream2 := p2ptest.NewStream(&buffer2, &buffer1)
 
 		w := protobuf.NewWriter(stream2)
 		if err := w.WriteMsg(&pb.Syn{
 			ObservedUnderlay: node1maBinary,
+			ProtocolVersion:  2,
+			NetworkID:        networkID,
 		}); err != nil {
 			t.Fatal(err)
 		}
@@ -623,35 +3021,563 @@ func TestHandshake(t *testing.T) {
 			Address: &pb.BzzAddress{
 				Underlay:  node2maBinary,
 				Overlay:   node2BzzAddress.Overlay.Bytes(),
-				Signature: node1BzzAddress.Signature,
+				Signature: node2BzzAddress.Signature,
 			},
-			NetworkID: networkID,
-			FullNode:  true,
+			NetworkID:          networkID,
+			FullNode:           true,
+			ProtocolVersion:    2,
+			MaxProtocolVersion: 2,
+			Timestamp:          timestamp,
+			Nonce:              nonce,
+			Signature:          signature,
 		}); err != nil {
 			t.Fatal(err)
 		}
 
-		_, err = handshakeService.Handle(context.Background(), stream1, node2AddrInfo.Addrs[0], node2AddrInfo.ID)
-		if err != handshake.ErrInvalidAck {
-			t.Fatalf("expected %s, got %v", handshake.ErrInvalidAck, err)
+		res, err := handshakeService.Handle(context.Background(), stream1, node2AddrInfo.Addrs[0], node2AddrInfo.ID)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if res.ProtocolVersion != 2 {
+			t.Fatalf("got protocol version %d, want %d", res.ProtocolVersion, 2)
+		}
+
+		_, r := protobuf.NewWriterAndReader(stream2)
+		var got pb.SynAck
+		if err := r.ReadMsg(&got); err != nil {
+			t.Fatal(err)
+		}
+
+		if got.Ack.ProtocolVersion != 2 {
+			t.Fatalf("got synack protocol version %d, want %d", got.Ack.ProtocolVersion, 2)
 		}
 	})
 
-	t.Run("Handle - transaction is not on the blockchain", func(t *testing.T) {
-		sbMock := &MockSenderMatcher{v: false}
+	t.Run("Handle - at capacity", func(t *testing.T) {
+		node1AddrInfo, err := libp2ppeer.AddrInfoFromP2pAddr(node1ma)
+		if err != nil {
+			t.Fatal(err)
+		}
+		initiator, err := handshake.New(signer1, aaddresser, senderMatcher, node1Info.BzzAddress.Overlay, networkID, handshake.MinSupportedVersion, handshake.MaxSupportedVersion, true, nil, nil, "", logger)
+		if err != nil {
+			t.Fatal(err)
+		}
+		// the node is full and a peer slot is expected to be free in 1.5s
+		responder, err := handshake.New(signer2, aaddresser, senderMatcher, node2Info.BzzAddress.Overlay, networkID, handshake.MinSupportedVersion, handshake.MaxSupportedVersion, true, nil, nil, "", logger, handshake.WithCapacityFunc(func() time.Duration {
+			return 1500 * time.Millisecond
+		}))
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		stream1, stream2 := handshaketest.NewPipe()
+		defer stream1.Close()
+		defer stream2.Close()
+
+		handled := make(chan error, 1)
+		go func() {
+			_, err := responder.Handle(context.Background(), stream2, node1AddrInfo.Addrs[0], node1AddrInfo.ID)
+			handled <- err
+		}()
+
+		want := &handshake.TryAgainLaterError{RetryAfter: 2 * time.Second}
+
+		_, err = initiator.Handshake(context.Background(), stream1, node2AddrInfo.Addrs[0], node2AddrInfo.ID)
+		var tryAgain *handshake.TryAgainLaterError
+		if !errors.As(err, &tryAgain) {
+			t.Fatalf("got error %v, want %v", err, want)
+		}
+		if tryAgain.RetryAfter != want.RetryAfter {
+			t.Fatalf("got retry after %s, want %s", tryAgain.RetryAfter, want.RetryAfter)
+		}
+		if !errors.Is(err, handshake.ErrTryAgainLater) {
+			t.Fatalf("error %v does not wrap %v", err, handshake.ErrTryAgainLater)
+		}
+		if handshake.IsRetryable(err) {
+			t.Fatalf("error %v is retryable", err)
+		}
+
+		if err := <-handled; !errors.As(err, &tryAgain) || tryAgain.RetryAfter != want.RetryAfter {
+			t.Fatalf("got handle error %v, want %v", err, want)
+		}
+	})
+
+	t.Run("Handle - deprecated version", func(t *testing.T) {
+		node1AddrInfo, err := libp2ppeer.AddrInfoFromP2pAddr(node1ma)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		for _, tc := range []struct {
+			name       string
+			maxVersion uint32
+			deprecated bool
+		}{
+			{
+				name:       "deprecated",
+				maxVersion: 1,
+				deprecated: true,
+			},
+			{
+				name:       "current",
+				maxVersion: 2,
+			},
+		} {
+			t.Run(tc.name, func(t *testing.T) {
+				var logs bytes.Buffer
+				initiator, err := handshake.New(signer1, aaddresser, senderMatcher, node1Info.BzzAddress.Overlay, networkID, 1, tc.maxVersion, true, nil, nil, "", logger)
+				if err != nil {
+					t.Fatal(err)
+				}
+				responder, err := handshake.New(signer2, aaddresser, senderMatcher, node2Info.BzzAddress.Overlay, networkID, 1, 2, true, nil, nil, "", logging.New(&logs, logrus.WarnLevel), handshake.WithDeprecatedVersions(1))
+				if err != nil {
+					t.Fatal(err)
+				}
+
+				stream1, stream2 := handshaketest.NewPipe()
+				defer stream1.Close()
+				defer stream2.Close()
+
+				handled := make(chan error, 1)
+				go func() {
+					_, err := responder.Handle(context.Background(), stream2, node1AddrInfo.Addrs[0], node1AddrInfo.ID)
+					handled <- err
+				}()
+
+				if _, err := initiator.Handshake(context.Background(), stream1, node2AddrInfo.Addrs[0], node2AddrInfo.ID); err != nil {
+					t.Fatal(err)
+				}
+				if err := <-handled; err != nil {
+					t.Fatal(err)
+				}
+
+				logged := strings.Contains(logs.String(), "deprecated protocol version")
+				if logged != tc.deprecated {
+					t.Fatalf("got deprecation warning %v, want %v: %q", logged, tc.deprecated, logs.String())
+				}
+				if tc.deprecated && !strings.Contains(logs.String(), "protocol_version=1") {
+					t.Fatalf("deprecation warning %q does not contain the version", logs.String())
+				}
+
+				want := 0.0
+				if tc.deprecated {
+					want = 1
+				}
+				if got := testutil.ToFloat64(responder.DeprecatedVersionCounter()); got != want {
+					t.Fatalf("got deprecated version count %v, want %v", got, want)
+				}
+			})
+		}
+	})
+
+	t.Run("Handle - downgrade", func(t *testing.T) {
+		for _, tc := range []struct {
+			name        string
+			maxVersion  uint32
+			legacyPeers bool
+			// version advertised in the syn received by the responder
+			synVersion uint32
+			// versions signed by the initiator
+			signedMaxVersion uint32
+			signedVersion    uint32
+			// version in the ack received by the responder
+			ackVersion uint32
+			wantErr    error
+		}{
+			{
+				name:             "syn version stripped",
+				maxVersion:       handshake.MaxSupportedVersion,
+				legacyPeers:      true,
+				synVersion:       0,
+				signedMaxVersion: handshake.MaxSupportedVersion,
+				signedVersion:    handshake.LegacyVersion,
+				ackVersion:       handshake.LegacyVersion,
+				wantErr:          handshake.ErrHandshakeDowngrade,
+			},
+			{
+				name:             "syn version lowered",
+				maxVersion:       handshake.MaxSupportedVersion,
+				synVersion:       handshake.LegacyVersion,
+				signedMaxVersion: handshake.MaxSupportedVersion,
+				signedVersion:    handshake.LegacyVersion,
+				ackVersion:       handshake.LegacyVersion,
+				wantErr:          handshake.ErrHandshakeDowngrade,
+			},
+			{
+				name:             "syn version altered",
+				maxVersion:       3,
+				synVersion:       2,
+				signedMaxVersion: 3,
+				signedVersion:    2,
+				ackVersion:       2,
+				wantErr:          handshake.ErrHandshakeDowngrade,
+			},
+			{
+				name:             "synack version altered",
+				maxVersion:       3,
+				synVersion:       3,
+				signedMaxVersion: 3,
+				signedVersion:    2,
+				ackVersion:       2,
+				wantErr:          handshake.ErrHandshakeDowngrade,
+			},
+			{
+				name:             "ack version altered after signing",
+				maxVersion:       3,
+				synVersion:       3,
+				signedMaxVersion: 3,
+				signedVersion:    3,
+				ackVersion:       2,
+				wantErr:          handshake.ErrInvalidHandshakeSignature,
+			},
+		} {
+			t.Run(tc.name, func(t *testing.T) {
+				handshakeService, err := handshake.New(signer1, aaddresser, senderMatcher, node1Info.BzzAddress.Overlay, networkID, 1, tc.maxVersion, true, nil, nil, "", logger, handshake.WithLegacyPeers(tc.legacyPeers))
+				if err != nil {
+					t.Fatal(err)
+				}
+				signature, err := signer2.Sign(handshake.SignData(networkID, node2BzzAddress.Overlay, nonce, challenge, tc.signedMaxVersion, tc.signedVersion, timestamp, nil))
+				if err != nil {
+					t.Fatal(err)
+				}
+				var buffer1 bytes.Buffer
+				var buffer2 bytes.Buffer
+				stream1 := p2ptest.NewStream(&buffer1, &buffer2)
+				stream2 := p2ptest.NewStream(&buffer2, &buffer1)
+
+				w := protobuf.NewWriter(stream2)
+				if err := w.WriteMsg(&pb.Syn{
+					ObservedUnderlay: node1maBinary,
+					ProtocolVersion:  tc.synVersion,
+					NetworkID:        networkID,
+				}); err != nil {
+					t.Fatal(err)
+				}
+
+				if err := w.WriteMsg(&pb.Ack{
+					Address: &pb.BzzAddress{
+						Underlay:  node2maBinary,
+						Overlay:   node2BzzAddress.Overlay.Bytes(),
+						Signature: node2BzzAddress.Signature,
+					},
+					NetworkID:          networkID,
+					FullNode:           true,
+					ProtocolVersion:    tc.ackVersion,
+					MaxProtocolVersion: tc.signedMaxVersion,
+					Timestamp:          timestamp,
+					Nonce:              nonce,
+					Signature:          signature,
+				}); err != nil {
+					t.Fatal(err)
+				}
+
+				res, err := handshakeService.Handle(context.Background(), stream1, node2AddrInfo.Addrs[0], node2AddrInfo.ID)
+				if res != nil {
+					t.Fatal("res should be nil")
+				}
+				if !errors.Is(err, tc.wantErr) {
+					t.Fatalf("expected %v, got %v", tc.wantErr, err)
+				}
+				if handshake.IsRetryable(err) {
+					t.Fatalf("error %v is retryable", err)
+				}
+				if !stream1.IsReset() {
+					t.Fatal("stream is not reset")
+				}
+			})
+		}
+	})
+
+	t.Run("Handshake - downgrade", func(t *testing.T) {
+		for _, tc := range []struct {
+			name string
+			// versions in the synack received by the initiator
+			version    uint32
+			maxVersion uint32
+			wantErr    error
+		}{
+			{
+				name:       "forged low version",
+				version:    handshake.LegacyVersion,
+				maxVersion: handshake.MaxSupportedVersion,
+				wantErr:    handshake.ErrHandshakeDowngrade,
+			},
+			{
+				name:       "highest version of the responder",
+				version:    handshake.LegacyVersion,
+				maxVersion: handshake.LegacyVersion,
+			},
+		} {
+			t.Run(tc.name, func(t *testing.T) {
+				var buffer1 bytes.Buffer
+				var buffer2 bytes.Buffer
+				stream1 := p2ptest.NewStream(&buffer1, &buffer2)
+				stream2 := p2ptest.NewStream(&buffer2, &buffer1)
+
+				w := protobuf.NewWriter(stream2)
+				if err := w.WriteMsg(&pb.SynAck{
+					Syn: &pb.Syn{
+						ObservedUnderlay: node1maBinary,
+					},
+					Ack: &pb.Ack{
+						Address: &pb.BzzAddress{
+							Underlay:  node2maBinary,
+							Overlay:   node2BzzAddress.Overlay.Bytes(),
+							Signature: node2BzzAddress.Signature,
+						},
+						NetworkID:          networkID,
+						FullNode:           true,
+						ProtocolVersion:    tc.version,
+						MaxProtocolVersion: tc.maxVersion,
+					},
+				}); err != nil {
+					t.Fatal(err)
+				}
+
+				res, err := handshakeService.Handshake(context.Background(), stream1, node2AddrInfo.Addrs[0], node2AddrInfo.ID)
+				if tc.wantErr == nil {
+					if err != nil {
+						t.Fatal(err)
+					}
+					if res.ProtocolVersion != tc.version {
+						t.Fatalf("got protocol version %d, want %d", res.ProtocolVersion, tc.version)
+					}
+					return
+				}
+				if res != nil {
+					t.Fatal("res should be nil")
+				}
+				if !errors.Is(err, tc.wantErr) {
+					t.Fatalf("expected %v, got %v", tc.wantErr, err)
+				}
+				if handshake.IsRetryable(err) {
+					t.Fatalf("error %v is retryable", err)
+				}
+				if !stream1.IsReset() {
+					t.Fatal("stream is not reset")
+				}
+			})
+		}
+	})
+
+	t.Run("Handshake and Handle - downgrade in transit", func(t *testing.T) {
+		node1AddrInfo, err := libp2ppeer.AddrInfoFromP2pAddr(node1ma)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		for _, tc := range []struct {
+			name        string
+			legacyPeers bool
+			// alterSyn and alterSynAck change the messages in transit
+			alterSyn         func(*pb.Syn)
+			alterSynAck      func(*pb.SynAck)
+			wantHandshakeErr error
+			wantHandleErr    error
+		}{
+			{
+				name:        "syn version stripped",
+				legacyPeers: true,
+				alterSyn:    func(m *pb.Syn) { m.ProtocolVersion = 0 },
+				alterSynAck: func(m *pb.SynAck) { m.Ack.MaxProtocolVersion = 0 },
+				// the initiator can not tell a legacy responder
+				wantHandleErr: handshake.ErrHandshakeDowngrade,
+			},
+			{
+				name:          "syn version stripped, legacy peers not allowed",
+				alterSyn:      func(m *pb.Syn) { m.ProtocolVersion = 0 },
+				wantHandleErr: handshake.ErrVersionMismatch,
+			},
+			{
+				name:          "syn version lowered",
+				alterSyn:      func(m *pb.Syn) { m.ProtocolVersion = handshake.LegacyVersion },
+				alterSynAck:   func(m *pb.SynAck) { m.Ack.MaxProtocolVersion = 0 },
+				wantHandleErr: handshake.ErrHandshakeDowngrade,
+			},
+			{
+				name:             "syn version lowered, detected by the initiator",
+				alterSyn:         func(m *pb.Syn) { m.ProtocolVersion = handshake.LegacyVersion },
+				wantHandshakeErr: handshake.ErrHandshakeDowngrade,
+			},
+			{
+				name:             "synack version lowered",
+				alterSynAck:      func(m *pb.SynAck) { m.Ack.ProtocolVersion = handshake.LegacyVersion },
+				wantHandshakeErr: handshake.ErrHandshakeDowngrade,
+			},
+			{
+				name: "synack version lowered, max version stripped",
+				alterSynAck: func(m *pb.SynAck) {
+					m.Ack.ProtocolVersion = handshake.LegacyVersion
+					m.Ack.MaxProtocolVersion = 0
+				},
+				wantHandleErr: handshake.ErrHandshakeDowngrade,
+			},
+		} {
+			t.Run(tc.name, func(t *testing.T) {
+				handshakeService2, err := handshake.New(signer2, aaddresser, senderMatcher, node2Info.BzzAddress.Overlay, networkID, handshake.MinSupportedVersion, handshake.MaxSupportedVersion, true, nil, nil, "", logger, handshake.WithLegacyPeers(tc.legacyPeers))
+				if err != nil {
+					t.Fatal(err)
+				}
+
+				initiator, relayIn := handshaketest.NewPipe()
+				relayOut, responder := handshaketest.NewPipe()
+				defer initiator.Close()
+				defer responder.Close()
+
+				// relay the messages between the peers, altering them like
+				// an attacker on the path
+				go func() {
+					defer relayIn.Close()
+					defer relayOut.Close()
+					wIn, rIn := protobuf.NewWriterAndReader(relayIn)
+					wOut, rOut := protobuf.NewWriterAndReader(relayOut)
+
+					var syn pb.Syn
+					if err := rIn.ReadMsg(&syn); err != nil {
+						return
+					}
+					if tc.alterSyn != nil {
+						tc.alterSyn(&syn)
+					}
+					if err := wOut.WriteMsg(&syn); err != nil {
+						return
+					}
+
+					var synAck pb.SynAck
+					if err := rOut.ReadMsg(&synAck); err != nil {
+						return
+					}
+					if tc.alterSynAck != nil {
+						tc.alterSynAck(&synAck)
+					}
+					if err := wIn.WriteMsg(&synAck); err != nil {
+						return
+					}
+
+					var ack pb.Ack
+					if err := rIn.ReadMsg(&ack); err != nil {
+						return
+					}
+					_ = wOut.WriteMsg(&ack)
+				}()
+
+				type result struct {
+					info *handshake.Info
+					err  error
+				}
+				handled := make(chan result, 1)
+				go func() {
+					info, err := handshakeService2.Handle(context.Background(), responder, node1AddrInfo.Addrs[0], node1AddrInfo.ID)
+					handled <- result{info: info, err: err}
+				}()
+
+				_, err = handshakeService.Handshake(context.Background(), initiator, node2AddrInfo.Addrs[0], node2AddrInfo.ID)
+				if tc.wantHandshakeErr != nil && !errors.Is(err, tc.wantHandshakeErr) {
+					t.Fatalf("expected handshake error %v, got %v", tc.wantHandshakeErr, err)
+				}
+
+				r := <-handled
+				if r.err == nil {
+					t.Fatal("expected handle error")
+				}
+				if tc.wantHandleErr != nil && !errors.Is(r.err, tc.wantHandleErr) {
+					t.Fatalf("expected handle error %v, got %v", tc.wantHandleErr, r.err)
+				}
+			})
+		}
+	})
+
+	t.Run("Handle - clock skew", func(t *testing.T) {
+		now := time.Unix(1600000000, 0)
+		handshake.SetTimeNow(func() time.Time { return now })
+		defer handshake.SetTimeNow(time.Now)
+
+		maxClockSkew := time.Minute
+		for _, tc := range []struct {
+			name    string
+			skew    time.Duration
+			wantErr error
+		}{
+			{name: "behind within window", skew: -maxClockSkew},
+			{name: "ahead within window", skew: maxClockSkew},
+			{name: "behind outside window", skew: -maxClockSkew - time.Second, wantErr: handshake.ErrHandshakeExpired},
+			{name: "ahead outside window", skew: maxClockSkew + time.Second, wantErr: handshake.ErrHandshakeExpired},
+		} {
+			t.Run(tc.name, func(t *testing.T) {
+				handshakeService, err := handshake.New(signer1, aaddresser, senderMatcher, node1Info.BzzAddress.Overlay, networkID, handshake.MinSupportedVersion, handshake.MaxSupportedVersion, true, nil, nil, "", logger,
+					handshake.WithMaxClockSkew(maxClockSkew),
+				)
+				if err != nil {
+					t.Fatal(err)
+				}
+				timestamp := now.Add(tc.skew).Unix()
+				signature, err := signer2.Sign(handshake.SignData(networkID, node2BzzAddress.Overlay, nonce, challenge, handshake.MaxSupportedVersion, handshake.MaxSupportedVersion, timestamp, nil))
+				if err != nil {
+					t.Fatal(err)
+				}
+				var buffer1 bytes.Buffer
+				var buffer2 bytes.Buffer
+				stream1 := p2ptest.NewStream(&buffer1, &buffer2)
+				stream2 := p2ptest.NewStream(&buffer2, &buffer1)
+
+				w := protobuf.NewWriter(stream2)
+				if err := w.WriteMsg(&pb.Syn{
+					ObservedUnderlay: node1maBinary,
+					ProtocolVersion:  handshake.MaxSupportedVersion,
+					NetworkID:        networkID,
+				}); err != nil {
+					t.Fatal(err)
+				}
+
+				if err := w.WriteMsg(&pb.Ack{
+					Address: &pb.BzzAddress{
+						Underlay:  node2maBinary,
+						Overlay:   node2BzzAddress.Overlay.Bytes(),
+						Signature: node2BzzAddress.Signature,
+					},
+					NetworkID:          networkID,
+					FullNode:           true,
+					ProtocolVersion:    handshake.MaxSupportedVersion,
+					MaxProtocolVersion: handshake.MaxSupportedVersion,
+					Timestamp:          timestamp,
+					Nonce:              nonce,
+					Signature:          signature,
+				}); err != nil {
+					t.Fatal(err)
+				}
+
+				_, err = handshakeService.Handle(context.Background(), stream1, node2AddrInfo.Addrs[0], node2AddrInfo.ID)
+				if !errors.Is(err, tc.wantErr) {
+					t.Fatalf("expected %v, got %v", tc.wantErr, err)
+				}
+				if err != nil && handshake.IsRetryable(err) {
+					t.Fatalf("error %v is retryable", err)
+				}
+			})
+		}
+	})
 
-		handshakeService, err := handshake.New(signer1, aaddresser, sbMock, node1Info.BzzAddress.Overlay, networkID, true, []byte("0xff"), "", logger)
+	t.Run("Handle - capabilities", func(t *testing.T) {
+		capabilities := []string{"pricing", "pushsync/2"}
+		handshakeService, err := handshake.New(signer1, aaddresser, senderMatcher, node1Info.BzzAddress.Overlay, networkID, handshake.MinSupportedVersion, handshake.MaxSupportedVersion, true, nil, capabilities, "", logger)
+		if err != nil {
+			t.Fatal(err)
+		}
+		signature, err := signer2.Sign(handshake.SignData(networkID, node2BzzAddress.Overlay, nonce, challenge, handshake.MaxSupportedVersion, handshake.MaxSupportedVersion, timestamp, []string{"pricing"}))
 		if err != nil {
 			t.Fatal(err)
 		}
 		var buffer1 bytes.Buffer
 		var buffer2 bytes.Buffer
-		stream1 := mock.NewStream(&buffer1, &buffer2)
-		stream2 := mock.NewStream(&buffer2, &buffer1)
+		stream1 := p2ptest.NewStream(&buffer1, &buffer2)
+		stream2 := p2ptest.NewStream(&buffer2, &buffer1)
 
 		w := protobuf.NewWriter(stream2)
 		if err := w.WriteMsg(&pb.Syn{
 			ObservedUnderlay: node1maBinary,
+			ProtocolVersion:  handshake.MaxSupportedVersion,
+			NetworkID:        networkID,
 		}); err != nil {
 			t.Fatal(err)
 		}
@@ -662,48 +3588,103 @@ func TestHandshake(t *testing.T) {
 				Overlay:   node2BzzAddress.Overlay.Bytes(),
 				Signature: node2BzzAddress.Signature,
 			},
-			NetworkID: networkID,
-			FullNode:  true,
+			NetworkID:          networkID,
+			FullNode:           true,
+			ProtocolVersion:    handshake.MaxSupportedVersion,
+			MaxProtocolVersion: handshake.MaxSupportedVersion,
+			Timestamp:          timestamp,
+			Nonce:              nonce,
+			Signature:          signature,
+			Capabilities:       []string{"pricing"},
 		}); err != nil {
 			t.Fatal(err)
 		}
 
-		_, err = handshakeService.Handle(context.Background(), stream1, node2AddrInfo.Addrs[0], node2AddrInfo.ID)
-		if !errors.Is(err, handshake.ErrAddressNotFound) {
-			t.Fatalf("expected error %v, got %v", handshake.ErrAddressNotFound, err)
+		res, err := handshakeService.Handle(context.Background(), stream1, node2AddrInfo.Addrs[0], node2AddrInfo.ID)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if !reflect.DeepEqual(res.Capabilities, []string{"pricing"}) {
+			t.Fatalf("got capabilities %v, want %v", res.Capabilities, []string{"pricing"})
+		}
+
+		_, r := protobuf.NewWriterAndReader(stream2)
+		var got pb.SynAck
+		if err := r.ReadMsg(&got); err != nil {
+			t.Fatal(err)
+		}
+
+		if !reflect.DeepEqual(got.Ack.Capabilities, capabilities) {
+			t.Fatalf("got synack capabilities %v, want %v", got.Ack.Capabilities, capabilities)
 		}
 	})
 
-	t.Run("Handle - advertisable error", func(t *testing.T) {
-		handshakeService, err := handshake.New(signer1, aaddresser, senderMatcher, node1Info.BzzAddress.Overlay, networkID, true, nil, "", logger)
+	t.Run("Handle - version mismatch", func(t *testing.T) {
+		handshakeService, err := handshake.New(signer1, aaddresser, senderMatcher, node1Info.BzzAddress.Overlay, networkID, 2, 3, true, nil, nil, "", logger)
 		if err != nil {
 			t.Fatal(err)
 		}
 		var buffer1 bytes.Buffer
 		var buffer2 bytes.Buffer
-		stream1 := mock.NewStream(&buffer1, &buffer2)
-		stream2 := mock.NewStream(&buffer2, &buffer1)
-
-		testError := errors.New("test error")
-		aaddresser.err = testError
-		defer func() {
-			aaddresser.err = nil
-		}()
+		stream1 := p2ptest.NewStream(&buffer1, &buffer2)
+		stream2 := p2ptest.NewStream(&buffer2, &buffer1)
 
 		w := protobuf.NewWriter(stream2)
 		if err := w.WriteMsg(&pb.Syn{
 			ObservedUnderlay: node1maBinary,
+			ProtocolVersion:  1,
+			NetworkID:        networkID,
 		}); err != nil {
 			t.Fatal(err)
 		}
 
 		res, err := handshakeService.Handle(context.Background(), stream1, node2AddrInfo.Addrs[0], node2AddrInfo.ID)
-		if err != testError {
-			t.Fatal("expected error")
+		if res != nil {
+			t.Fatal("res should be nil")
 		}
 
-		if res != nil {
-			t.Fatal("expected nil res")
+		var e *handshake.VersionMismatchError
+		if !errors.As(err, &e) {
+			t.Fatalf("expected version mismatch error, got %v", err)
+		}
+		if e.Local != 3 || e.Remote != 1 {
+			t.Fatalf("got versions local %d remote %d", e.Local, e.Remote)
+		}
+		if !errors.Is(err, handshake.ErrVersionMismatch) {
+			t.Fatalf("expected error %v, got %v", handshake.ErrVersionMismatch, err)
+		}
+
+		if !stream1.IsReset() {
+			t.Fatal("stream is not reset")
+		}
+	})
+
+	t.Run("protocol ids", func(t *testing.T) {
+		defaultID := p2p.NewSwarmStreamName(handshake.ProtocolName, handshake.ProtocolVersion, handshake.StreamName)
+		if got := handshakeService.ProtocolIDs(); len(got) != 1 || got[0] != defaultID {
+			t.Fatalf("got protocol ids %v, want %v", got, []string{defaultID})
+		}
+
+		ids := []string{"/swarm/bzz-handshake/1.0.0/handshake", defaultID}
+		svc, err := handshake.New(signer1, aaddresser, senderMatcher, node1Info.BzzAddress.Overlay, networkID, handshake.MinSupportedVersion, handshake.MaxSupportedVersion, true, nil, nil, "", logger, handshake.WithProtocolIDs(ids...))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got := svc.ProtocolIDs(); !reflect.DeepEqual(got, ids) {
+			t.Fatalf("got protocol ids %v, want %v", got, ids)
+		}
+
+		_, err = handshake.New(signer1, aaddresser, senderMatcher, node1Info.BzzAddress.Overlay, networkID, handshake.MinSupportedVersion, handshake.MaxSupportedVersion, true, nil, nil, "", logger, handshake.WithProtocolIDs())
+		if !errors.Is(err, handshake.ErrNoProtocolIDs) {
+			t.Fatalf("expected error %v, got %v", handshake.ErrNoProtocolIDs, err)
+		}
+	})
+
+	t.Run("Handshake - invalid version range", func(t *testing.T) {
+		_, err := handshake.New(signer1, aaddresser, senderMatcher, node1Info.BzzAddress.Overlay, networkID, 3, 2, true, nil, nil, "", logger)
+		if !errors.Is(err, handshake.ErrInvalidVersionRange) {
+			t.Fatalf("expected error %v, got %v", handshake.ErrInvalidVersionRange, err)
 		}
 	})
 }
@@ -716,6 +3697,44 @@ func testInfo(t *testing.T, got, want handshake.Info) {
 	}
 }
 
+// blockingStream is a stream which reads block until the stream is released.
+type blockingStream struct {
+	*p2ptest.Stream
+	reading     chan struct{}
+	readingOnce sync.Once
+	released    chan struct{}
+	releaseOnce sync.Once
+}
+
+func newBlockingStream(s *p2ptest.Stream) *blockingStream {
+	return &blockingStream{
+		Stream:   s,
+		reading:  make(chan struct{}),
+		released: make(chan struct{}),
+	}
+}
+
+func (s *blockingStream) Read(p []byte) (int, error) {
+	s.readingOnce.Do(func() { close(s.reading) })
+	<-s.released
+	return 0, io.EOF
+}
+
+func (s *blockingStream) release() {
+	s.releaseOnce.Do(func() { close(s.released) })
+}
+
+// delayedStream is a stream which delays every read.
+type delayedStream struct {
+	*p2ptest.Stream
+	delay time.Duration
+}
+
+func (s *delayedStream) Read(p []byte) (int, error) {
+	time.Sleep(s.delay)
+	return s.Stream.Read(p)
+}
+
 type AdvertisableAddresserMock struct {
 	advertisableAddress ma.Multiaddr
 	err                 error
@@ -0,0 +1,47 @@
+// Copyright 2021 The Swarm Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+// Package handshaketest provides helpers for testing handshakes between
+// two services.
+package handshaketest
+
+import (
+	"net"
+
+	"github.com/ethersphere/bee/pkg/p2p"
+)
+
+// Stream is one end of a full-duplex in-memory connection.
+type Stream struct {
+	net.Conn
+}
+
+// NewPipe returns two connected streams, so that the messages written to
+// one of them can be read from the other, like with net.Pipe. Writes block
+// until the data is read on the other end, which makes it suitable for
+// running Handshake and Handle concurrently.
+func NewPipe() (*Stream, *Stream) {
+	c1, c2 := net.Pipe()
+	return &Stream{Conn: c1}, &Stream{Conn: c2}
+}
+
+// Headers returns nil as the stream has no headers.
+func (s *Stream) Headers() p2p.Headers {
+	return nil
+}
+
+// ResponseHeaders returns nil as the stream has no headers.
+func (s *Stream) ResponseHeaders() p2p.Headers {
+	return nil
+}
+
+// FullClose closes the stream.
+func (s *Stream) FullClose() error {
+	return s.Close()
+}
+
+// Reset closes the stream.
+func (s *Stream) Reset() error {
+	return s.Close()
+}
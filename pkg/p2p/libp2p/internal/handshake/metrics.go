@@ -0,0 +1,67 @@
+// Copyright 2021 The Swarm Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package handshake
+
+import (
+	m "github.com/ethersphere/bee/pkg/metrics"
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+type metrics struct {
+	SuccessCount           prometheus.Counter
+	ReadErrorCount         prometheus.Counter
+	WriteErrorCount        prometheus.Counter
+	NetworkIDMismatchCount prometheus.Counter
+	DeprecatedVersionCount prometheus.Counter
+	Duration               prometheus.Histogram
+}
+
+func newMetrics() metrics {
+	subsystem := "handshake"
+
+	return metrics{
+		SuccessCount: prometheus.NewCounter(prometheus.CounterOpts{
+			Namespace: m.Namespace,
+			Subsystem: subsystem,
+			Name:      "success_count",
+			Help:      "Number of successful handshakes.",
+		}),
+		ReadErrorCount: prometheus.NewCounter(prometheus.CounterOpts{
+			Namespace: m.Namespace,
+			Subsystem: subsystem,
+			Name:      "read_error_count",
+			Help:      "Number of handshakes failed on reading a message from the peer.",
+		}),
+		WriteErrorCount: prometheus.NewCounter(prometheus.CounterOpts{
+			Namespace: m.Namespace,
+			Subsystem: subsystem,
+			Name:      "write_error_count",
+			Help:      "Number of handshakes failed on writing a message to the peer.",
+		}),
+		NetworkIDMismatchCount: prometheus.NewCounter(prometheus.CounterOpts{
+			Namespace: m.Namespace,
+			Subsystem: subsystem,
+			Name:      "network_id_mismatch_count",
+			Help:      "Number of handshakes failed because the peer is on a different network.",
+		}),
+		DeprecatedVersionCount: prometheus.NewCounter(prometheus.CounterOpts{
+			Namespace: m.Namespace,
+			Subsystem: subsystem,
+			Name:      "deprecated_version_count",
+			Help:      "Number of handshakes which negotiated a deprecated protocol version.",
+		}),
+		Duration: prometheus.NewHistogram(prometheus.HistogramOpts{
+			Namespace: m.Namespace,
+			Subsystem: subsystem,
+			Name:      "duration",
+			Help:      "Histogram of time spent on successful handshakes.",
+			Buckets:   []float64{0.01, 0.05, 0.1, 0.25, 0.5, 1, 2.5, 5, 15},
+		}),
+	}
+}
+
+func (s *Service) Metrics() []prometheus.Collector {
+	return m.PrometheusCollectorsFromFields(s.metrics)
+}
@@ -22,8 +22,38 @@ var _ = math.Inf
 // proto package needs to be updated.
 const _ = proto.GoGoProtoPackageIsVersion3 // please upgrade the proto package
 
+type Compression int32
+
+const (
+	Compression_NONE   Compression = 0
+	Compression_GZIP   Compression = 1
+	Compression_SNAPPY Compression = 2
+)
+
+var Compression_name = map[int32]string{
+	0: "NONE",
+	1: "GZIP",
+	2: "SNAPPY",
+}
+
+var Compression_value = map[string]int32{
+	"NONE":   0,
+	"GZIP":   1,
+	"SNAPPY": 2,
+}
+
+func (x Compression) String() string {
+	return proto.EnumName(Compression_name, int32(x))
+}
+
+func (Compression) EnumDescriptor() ([]byte, []int) {
+	return fileDescriptor_a77305914d5d202f, []int{0}
+}
+
 type Syn struct {
 	ObservedUnderlay []byte `protobuf:"bytes,1,opt,name=ObservedUnderlay,proto3" json:"ObservedUnderlay,omitempty"`
+	ProtocolVersion  uint32 `protobuf:"varint,2,opt,name=ProtocolVersion,proto3" json:"ProtocolVersion,omitempty"`
+	NetworkID        uint64 `protobuf:"varint,3,opt,name=NetworkID,proto3" json:"NetworkID,omitempty"`
 }
 
 func (m *Syn) Reset()         { *m = Syn{} }
@@ -66,12 +96,37 @@ func (m *Syn) GetObservedUnderlay() []byte {
 	return nil
 }
 
+func (m *Syn) GetProtocolVersion() uint32 {
+	if m != nil {
+		return m.ProtocolVersion
+	}
+	return 0
+}
+
+func (m *Syn) GetNetworkID() uint64 {
+	if m != nil {
+		return m.NetworkID
+	}
+	return 0
+}
+
 type Ack struct {
-	Address        *BzzAddress `protobuf:"bytes,1,opt,name=Address,proto3" json:"Address,omitempty"`
-	NetworkID      uint64      `protobuf:"varint,2,opt,name=NetworkID,proto3" json:"NetworkID,omitempty"`
-	FullNode       bool        `protobuf:"varint,3,opt,name=FullNode,proto3" json:"FullNode,omitempty"`
-	Transaction    []byte      `protobuf:"bytes,4,opt,name=Transaction,proto3" json:"Transaction,omitempty"`
-	WelcomeMessage string      `protobuf:"bytes,99,opt,name=WelcomeMessage,proto3" json:"WelcomeMessage,omitempty"`
+	Address            *BzzAddress   `protobuf:"bytes,1,opt,name=Address,proto3" json:"Address,omitempty"`
+	NetworkID          uint64        `protobuf:"varint,2,opt,name=NetworkID,proto3" json:"NetworkID,omitempty"`
+	FullNode           bool          `protobuf:"varint,3,opt,name=FullNode,proto3" json:"FullNode,omitempty"`
+	Transaction        []byte        `protobuf:"bytes,4,opt,name=Transaction,proto3" json:"Transaction,omitempty"`
+	ProtocolVersion    uint32        `protobuf:"varint,5,opt,name=ProtocolVersion,proto3" json:"ProtocolVersion,omitempty"`
+	Nonce              []byte        `protobuf:"bytes,6,opt,name=Nonce,proto3" json:"Nonce,omitempty"`
+	Signature          []byte        `protobuf:"bytes,7,opt,name=Signature,proto3" json:"Signature,omitempty"`
+	Capabilities       []string      `protobuf:"bytes,8,rep,name=Capabilities,proto3" json:"Capabilities,omitempty"`
+	BlockHeight        uint64        `protobuf:"varint,9,opt,name=BlockHeight,proto3" json:"BlockHeight,omitempty"`
+	MaxProtocolVersion uint32        `protobuf:"varint,10,opt,name=MaxProtocolVersion,proto3" json:"MaxProtocolVersion,omitempty"`
+	Timestamp          int64         `protobuf:"varint,11,opt,name=Timestamp,proto3" json:"Timestamp,omitempty"`
+	MaxMessageSize     uint32        `protobuf:"varint,12,opt,name=MaxMessageSize,proto3" json:"MaxMessageSize,omitempty"`
+	RetryAfterSeconds  uint32        `protobuf:"varint,13,opt,name=RetryAfterSeconds,proto3" json:"RetryAfterSeconds,omitempty"`
+	Compressions       []Compression `protobuf:"varint,14,rep,packed,name=Compressions,proto3,enum=handshake.Compression" json:"Compressions,omitempty"`
+	Underlays          [][]byte      `protobuf:"bytes,15,rep,name=Underlays,proto3" json:"Underlays,omitempty"`
+	WelcomeMessage     string        `protobuf:"bytes,99,opt,name=WelcomeMessage,proto3" json:"WelcomeMessage,omitempty"`
 }
 
 func (m *Ack) Reset()         { *m = Ack{} }
@@ -135,6 +190,83 @@ func (m *Ack) GetTransaction() []byte {
 	return nil
 }
 
+func (m *Ack) GetProtocolVersion() uint32 {
+	if m != nil {
+		return m.ProtocolVersion
+	}
+	return 0
+}
+
+func (m *Ack) GetNonce() []byte {
+	if m != nil {
+		return m.Nonce
+	}
+	return nil
+}
+
+func (m *Ack) GetSignature() []byte {
+	if m != nil {
+		return m.Signature
+	}
+	return nil
+}
+
+func (m *Ack) GetCapabilities() []string {
+	if m != nil {
+		return m.Capabilities
+	}
+	return nil
+}
+
+func (m *Ack) GetBlockHeight() uint64 {
+	if m != nil {
+		return m.BlockHeight
+	}
+	return 0
+}
+
+func (m *Ack) GetMaxProtocolVersion() uint32 {
+	if m != nil {
+		return m.MaxProtocolVersion
+	}
+	return 0
+}
+
+func (m *Ack) GetTimestamp() int64 {
+	if m != nil {
+		return m.Timestamp
+	}
+	return 0
+}
+
+func (m *Ack) GetMaxMessageSize() uint32 {
+	if m != nil {
+		return m.MaxMessageSize
+	}
+	return 0
+}
+
+func (m *Ack) GetRetryAfterSeconds() uint32 {
+	if m != nil {
+		return m.RetryAfterSeconds
+	}
+	return 0
+}
+
+func (m *Ack) GetCompressions() []Compression {
+	if m != nil {
+		return m.Compressions
+	}
+	return nil
+}
+
+func (m *Ack) GetUnderlays() [][]byte {
+	if m != nil {
+		return m.Underlays
+	}
+	return nil
+}
+
 func (m *Ack) GetWelcomeMessage() string {
 	if m != nil {
 		return m.WelcomeMessage
@@ -254,38 +386,98 @@ func (m *BzzAddress) GetOverlay() []byte {
 	return nil
 }
 
+type ModeUpdate struct {
+	FullNode bool `protobuf:"varint,1,opt,name=FullNode,proto3" json:"FullNode,omitempty"`
+}
+
+func (m *ModeUpdate) Reset()         { *m = ModeUpdate{} }
+func (m *ModeUpdate) String() string { return proto.CompactTextString(m) }
+func (*ModeUpdate) ProtoMessage()    {}
+func (*ModeUpdate) Descriptor() ([]byte, []int) {
+	return fileDescriptor_a77305914d5d202f, []int{4}
+}
+func (m *ModeUpdate) XXX_Unmarshal(b []byte) error {
+	return m.Unmarshal(b)
+}
+func (m *ModeUpdate) XXX_Marshal(b []byte, deterministic bool) ([]byte, error) {
+	if deterministic {
+		return xxx_messageInfo_ModeUpdate.Marshal(b, m, deterministic)
+	} else {
+		b = b[:cap(b)]
+		n, err := m.MarshalToSizedBuffer(b)
+		if err != nil {
+			return nil, err
+		}
+		return b[:n], nil
+	}
+}
+func (m *ModeUpdate) XXX_Merge(src proto.Message) {
+	xxx_messageInfo_ModeUpdate.Merge(m, src)
+}
+func (m *ModeUpdate) XXX_Size() int {
+	return m.Size()
+}
+func (m *ModeUpdate) XXX_DiscardUnknown() {
+	xxx_messageInfo_ModeUpdate.DiscardUnknown(m)
+}
+
+var xxx_messageInfo_ModeUpdate proto.InternalMessageInfo
+
+func (m *ModeUpdate) GetFullNode() bool {
+	if m != nil {
+		return m.FullNode
+	}
+	return false
+}
+
 func init() {
+	proto.RegisterEnum("handshake.Compression", Compression_name, Compression_value)
 	proto.RegisterType((*Syn)(nil), "handshake.Syn")
 	proto.RegisterType((*Ack)(nil), "handshake.Ack")
 	proto.RegisterType((*SynAck)(nil), "handshake.SynAck")
 	proto.RegisterType((*BzzAddress)(nil), "handshake.BzzAddress")
+	proto.RegisterType((*ModeUpdate)(nil), "handshake.ModeUpdate")
 }
 
 func init() { proto.RegisterFile("handshake.proto", fileDescriptor_a77305914d5d202f) }
 
 var fileDescriptor_a77305914d5d202f = []byte{
-	// 324 bytes of a gzipped FileDescriptorProto
-	0x1f, 0x8b, 0x08, 0x00, 0x00, 0x00, 0x00, 0x00, 0x02, 0xff, 0x64, 0x91, 0xdf, 0x4a, 0xf3, 0x30,
-	0x18, 0xc6, 0x97, 0x75, 0xec, 0xcf, 0xbb, 0xb1, 0xef, 0x23, 0x20, 0x14, 0x19, 0x25, 0xf4, 0x40,
-	0x8a, 0x07, 0x13, 0xf5, 0x0a, 0x36, 0x44, 0x10, 0x74, 0x83, 0x54, 0x11, 0x3c, 0x32, 0x6b, 0xc3,
-	0x36, 0x5a, 0x93, 0x91, 0x74, 0x93, 0xee, 0x2a, 0xbc, 0x1e, 0xaf, 0xc0, 0xc3, 0x1d, 0x7a, 0x28,
-	0xdb, 0x8d, 0x48, 0xe3, 0xd6, 0xce, 0x79, 0xf8, 0xfe, 0x9e, 0x27, 0xc9, 0xf3, 0xbc, 0x81, 0x7f,
-	0x13, 0x26, 0x42, 0x3d, 0x61, 0x11, 0xef, 0xce, 0x94, 0x4c, 0x24, 0x6e, 0xe4, 0xc0, 0x3d, 0x07,
-	0xcb, 0x4f, 0x05, 0x3e, 0x85, 0xff, 0xc3, 0x91, 0xe6, 0x6a, 0xc1, 0xc3, 0x07, 0x11, 0x72, 0x15,
-	0xb3, 0xd4, 0x46, 0x04, 0x79, 0x2d, 0xfa, 0x87, 0xbb, 0xef, 0x08, 0xac, 0x5e, 0x10, 0xe1, 0x33,
-	0xa8, 0xf5, 0xc2, 0x50, 0x71, 0xad, 0x8d, 0xb5, 0x79, 0x71, 0xd4, 0x2d, 0x1e, 0xea, 0x2f, 0x97,
-	0x5b, 0x91, 0xee, 0x5c, 0xb8, 0x03, 0x8d, 0x01, 0x4f, 0x5e, 0xa5, 0x8a, 0x6e, 0xae, 0xec, 0x32,
-	0x41, 0x5e, 0x85, 0x16, 0x00, 0x1f, 0x43, 0xfd, 0x7a, 0x1e, 0xc7, 0x03, 0x19, 0x72, 0xdb, 0x22,
-	0xc8, 0xab, 0xd3, 0x7c, 0xc6, 0x04, 0x9a, 0xf7, 0x8a, 0x09, 0xcd, 0x82, 0x64, 0x2a, 0x85, 0x5d,
-	0x31, 0xc9, 0xf6, 0x11, 0x3e, 0x81, 0xf6, 0x23, 0x8f, 0x03, 0xf9, 0xc2, 0xef, 0xb8, 0xd6, 0x6c,
-	0xcc, 0xed, 0x80, 0x20, 0xaf, 0x41, 0x0f, 0xa8, 0x7b, 0x0b, 0x55, 0x3f, 0x15, 0x59, 0x7c, 0x62,
-	0x9a, 0x6f, 0xa3, 0xb7, 0xf7, 0xa2, 0xfb, 0xa9, 0xa0, 0x66, 0x29, 0xc4, 0xf4, 0x34, 0x49, 0x7f,
-	0x3b, 0x7a, 0x41, 0x44, 0x33, 0xc9, 0x7d, 0x06, 0x28, 0x8a, 0x66, 0x0d, 0x0e, 0x96, 0x97, 0xcf,
-	0x59, 0x77, 0x7f, 0x3a, 0x16, 0x2c, 0x99, 0x2b, 0x6e, 0x6e, 0x6c, 0xd1, 0x02, 0x60, 0x1b, 0x6a,
-	0xc3, 0xc5, 0xcf, 0x41, 0xcb, 0x68, 0xbb, 0xb1, 0xdf, 0xf9, 0x58, 0x3b, 0x68, 0xb5, 0x76, 0xd0,
-	0xd7, 0xda, 0x41, 0x6f, 0x1b, 0xa7, 0xb4, 0xda, 0x38, 0xa5, 0xcf, 0x8d, 0x53, 0x7a, 0x2a, 0xcf,
-	0x46, 0xa3, 0xaa, 0xf9, 0xcf, 0xcb, 0xef, 0x00, 0x00, 0x00, 0xff, 0xff, 0xd1, 0x48, 0x2c, 0x4a,
-	0xe2, 0x01, 0x00, 0x00,
+	// 557 bytes of a gzipped FileDescriptorProto
+	0x1f, 0x8b, 0x08, 0x00, 0x00, 0x00, 0x00, 0x00, 0x02, 0xff, 0x6c, 0x94, 0xcf, 0x4e, 0xdb, 0x4c,
+	0x14, 0xc5, 0x63, 0x3b, 0x84, 0xe4, 0x26, 0x84, 0x7c, 0xa3, 0xaf, 0xd5, 0xa8, 0x42, 0x96, 0xe5,
+	0x45, 0x65, 0xa1, 0x96, 0x4a, 0x74, 0xd7, 0x9d, 0xa1, 0xff, 0x90, 0x1a, 0x13, 0x8d, 0xa1, 0x55,
+	0x59, 0x75, 0x62, 0x4f, 0xc1, 0xb2, 0xe3, 0xb1, 0x3c, 0x86, 0x62, 0x9e, 0xa2, 0x8f, 0xd5, 0x25,
+	0xcb, 0x2e, 0xba, 0xa8, 0xe0, 0x45, 0xaa, 0x19, 0x48, 0x62, 0x3b, 0xd9, 0xe5, 0xfe, 0xce, 0xcd,
+	0x9d, 0x73, 0x67, 0x4e, 0x02, 0xdb, 0x17, 0x34, 0x0d, 0xc5, 0x05, 0x8d, 0xd9, 0x5e, 0x96, 0xf3,
+	0x82, 0xa3, 0xde, 0x02, 0xd8, 0x25, 0x18, 0x7e, 0x99, 0xa2, 0x5d, 0x18, 0x1d, 0x4f, 0x05, 0xcb,
+	0xaf, 0x58, 0x78, 0x9a, 0x86, 0x2c, 0x4f, 0x68, 0x89, 0x35, 0x4b, 0x73, 0x06, 0x64, 0x85, 0x23,
+	0x07, 0xb6, 0x27, 0x72, 0x4c, 0xc0, 0x93, 0xcf, 0x2c, 0x17, 0x11, 0x4f, 0xb1, 0x6e, 0x69, 0xce,
+	0x16, 0x69, 0x62, 0xb4, 0x03, 0x3d, 0x8f, 0x15, 0x3f, 0x78, 0x1e, 0x1f, 0xbd, 0xc5, 0x86, 0xa5,
+	0x39, 0x6d, 0xb2, 0x04, 0xf6, 0x9f, 0x36, 0x18, 0x6e, 0x10, 0xa3, 0x57, 0xb0, 0xe9, 0x86, 0x61,
+	0xce, 0x84, 0x50, 0x47, 0xf6, 0xf7, 0x9f, 0xec, 0x2d, 0x0d, 0x1f, 0xdc, 0xdc, 0x3c, 0x8a, 0x64,
+	0xde, 0x55, 0x1f, 0xab, 0x37, 0xc6, 0xa2, 0x67, 0xd0, 0x7d, 0x7f, 0x99, 0x24, 0x1e, 0x0f, 0x99,
+	0x3a, 0xb3, 0x4b, 0x16, 0x35, 0xb2, 0xa0, 0x7f, 0x92, 0xd3, 0x54, 0xd0, 0xa0, 0x90, 0xb6, 0xdb,
+	0x6a, 0xc3, 0x2a, 0x5a, 0xb7, 0xdc, 0xc6, 0xfa, 0xe5, 0xfe, 0x87, 0x0d, 0x8f, 0xa7, 0x01, 0xc3,
+	0x1d, 0x35, 0xe5, 0xa1, 0x90, 0xde, 0xfc, 0xe8, 0x3c, 0xa5, 0xc5, 0x65, 0xce, 0xf0, 0xa6, 0x52,
+	0x96, 0x00, 0xd9, 0x30, 0x38, 0xa4, 0x19, 0x9d, 0x46, 0x49, 0x54, 0x44, 0x4c, 0xe0, 0xae, 0x65,
+	0x38, 0x3d, 0x52, 0x63, 0xd2, 0xe3, 0x41, 0xc2, 0x83, 0xf8, 0x23, 0x8b, 0xce, 0x2f, 0x0a, 0xdc,
+	0x53, 0xfb, 0x55, 0x11, 0xda, 0x03, 0x34, 0xa6, 0xd7, 0x4d, 0x9b, 0xa0, 0x6c, 0xae, 0x51, 0xa4,
+	0xa7, 0x93, 0x68, 0xc6, 0x44, 0x41, 0x67, 0x19, 0xee, 0x5b, 0x9a, 0x63, 0x90, 0x25, 0x40, 0xcf,
+	0x61, 0x38, 0xa6, 0xd7, 0x63, 0x26, 0x04, 0x3d, 0x67, 0x7e, 0x74, 0xc3, 0xf0, 0x40, 0x4d, 0x6a,
+	0x50, 0xf4, 0x02, 0xfe, 0x23, 0xac, 0xc8, 0x4b, 0xf7, 0x7b, 0xc1, 0x72, 0x9f, 0x05, 0x3c, 0x0d,
+	0x05, 0xde, 0x52, 0xad, 0xab, 0x02, 0x7a, 0x03, 0x83, 0x43, 0x3e, 0xcb, 0xe4, 0x7b, 0x45, 0x3c,
+	0x15, 0x78, 0x68, 0x19, 0xce, 0x70, 0xff, 0x69, 0xe5, 0x65, 0x2b, 0x32, 0xa9, 0xf5, 0x4a, 0xbf,
+	0xf3, 0xb0, 0x09, 0xbc, 0x6d, 0x19, 0xf2, 0x0e, 0x17, 0x40, 0xfa, 0xfd, 0xc2, 0x92, 0x80, 0xcf,
+	0xd8, 0xa3, 0x3b, 0x1c, 0x58, 0x9a, 0xd3, 0x23, 0x0d, 0x6a, 0x7f, 0x82, 0x8e, 0x5f, 0xa6, 0x32,
+	0x60, 0x96, 0xca, 0xf8, 0x63, 0xb8, 0x86, 0x15, 0x0b, 0x7e, 0x99, 0x12, 0x29, 0xc9, 0x0e, 0x37,
+	0x88, 0xb1, 0xbe, 0xd2, 0xe1, 0x06, 0x31, 0x91, 0x92, 0xfd, 0x0d, 0x60, 0x19, 0x45, 0x99, 0xb1,
+	0xc6, 0xcf, 0x64, 0x51, 0xd7, 0x13, 0xa0, 0x37, 0x13, 0x80, 0x61, 0xf3, 0xf8, 0xea, 0xe1, 0x8b,
+	0x86, 0xd2, 0xe6, 0xa5, 0xed, 0x00, 0x8c, 0x79, 0xc8, 0x4e, 0xb3, 0x90, 0x16, 0xac, 0x96, 0x62,
+	0xad, 0x9e, 0xe2, 0xdd, 0x97, 0xd0, 0xaf, 0xdc, 0x17, 0xea, 0x42, 0xdb, 0x3b, 0xf6, 0xde, 0x8d,
+	0x5a, 0xf2, 0xd3, 0x87, 0xb3, 0xa3, 0xc9, 0x48, 0x43, 0x00, 0x1d, 0xdf, 0x73, 0x27, 0x93, 0xaf,
+	0x23, 0xfd, 0x60, 0xe7, 0xd7, 0x9d, 0xa9, 0xdd, 0xde, 0x99, 0xda, 0xdf, 0x3b, 0x53, 0xfb, 0x79,
+	0x6f, 0xb6, 0x6e, 0xef, 0xcd, 0xd6, 0xef, 0x7b, 0xb3, 0x75, 0xa6, 0x67, 0xd3, 0x69, 0x47, 0xfd,
+	0x25, 0xbc, 0xfe, 0x37, 0x00, 0x5d, 0xaf, 0x89, 0x04, 0x25, 0x04, 0x00, 0x00,
 }
 
 func (m *Syn) Marshal() (dAtA []byte, err error) {
@@ -308,6 +500,16 @@ func (m *Syn) MarshalToSizedBuffer(dAtA []byte) (int, error) {
 	_ = i
 	var l int
 	_ = l
+	if m.NetworkID != 0 {
+		i = encodeVarintHandshake(dAtA, i, uint64(m.NetworkID))
+		i--
+		dAtA[i] = 0x18
+	}
+	if m.ProtocolVersion != 0 {
+		i = encodeVarintHandshake(dAtA, i, uint64(m.ProtocolVersion))
+		i--
+		dAtA[i] = 0x10
+	}
 	if len(m.ObservedUnderlay) > 0 {
 		i -= len(m.ObservedUnderlay)
 		copy(dAtA[i:], m.ObservedUnderlay)
@@ -347,6 +549,86 @@ func (m *Ack) MarshalToSizedBuffer(dAtA []byte) (int, error) {
 		i--
 		dAtA[i] = 0x9a
 	}
+	if len(m.Underlays) > 0 {
+		for iNdEx := len(m.Underlays) - 1; iNdEx >= 0; iNdEx-- {
+			i -= len(m.Underlays[iNdEx])
+			copy(dAtA[i:], m.Underlays[iNdEx])
+			i = encodeVarintHandshake(dAtA, i, uint64(len(m.Underlays[iNdEx])))
+			i--
+			dAtA[i] = 0x7a
+		}
+	}
+	if len(m.Compressions) > 0 {
+		dAtA2 := make([]byte, len(m.Compressions)*10)
+		var j1 int
+		for _, num := range m.Compressions {
+			for num >= 1<<7 {
+				dAtA2[j1] = uint8(uint64(num)&0x7f | 0x80)
+				num >>= 7
+				j1++
+			}
+			dAtA2[j1] = uint8(num)
+			j1++
+		}
+		i -= j1
+		copy(dAtA[i:], dAtA2[:j1])
+		i = encodeVarintHandshake(dAtA, i, uint64(j1))
+		i--
+		dAtA[i] = 0x72
+	}
+	if m.RetryAfterSeconds != 0 {
+		i = encodeVarintHandshake(dAtA, i, uint64(m.RetryAfterSeconds))
+		i--
+		dAtA[i] = 0x68
+	}
+	if m.MaxMessageSize != 0 {
+		i = encodeVarintHandshake(dAtA, i, uint64(m.MaxMessageSize))
+		i--
+		dAtA[i] = 0x60
+	}
+	if m.Timestamp != 0 {
+		i = encodeVarintHandshake(dAtA, i, uint64(m.Timestamp))
+		i--
+		dAtA[i] = 0x58
+	}
+	if m.MaxProtocolVersion != 0 {
+		i = encodeVarintHandshake(dAtA, i, uint64(m.MaxProtocolVersion))
+		i--
+		dAtA[i] = 0x50
+	}
+	if m.BlockHeight != 0 {
+		i = encodeVarintHandshake(dAtA, i, uint64(m.BlockHeight))
+		i--
+		dAtA[i] = 0x48
+	}
+	if len(m.Capabilities) > 0 {
+		for iNdEx := len(m.Capabilities) - 1; iNdEx >= 0; iNdEx-- {
+			i -= len(m.Capabilities[iNdEx])
+			copy(dAtA[i:], m.Capabilities[iNdEx])
+			i = encodeVarintHandshake(dAtA, i, uint64(len(m.Capabilities[iNdEx])))
+			i--
+			dAtA[i] = 0x42
+		}
+	}
+	if len(m.Signature) > 0 {
+		i -= len(m.Signature)
+		copy(dAtA[i:], m.Signature)
+		i = encodeVarintHandshake(dAtA, i, uint64(len(m.Signature)))
+		i--
+		dAtA[i] = 0x3a
+	}
+	if len(m.Nonce) > 0 {
+		i -= len(m.Nonce)
+		copy(dAtA[i:], m.Nonce)
+		i = encodeVarintHandshake(dAtA, i, uint64(len(m.Nonce)))
+		i--
+		dAtA[i] = 0x32
+	}
+	if m.ProtocolVersion != 0 {
+		i = encodeVarintHandshake(dAtA, i, uint64(m.ProtocolVersion))
+		i--
+		dAtA[i] = 0x28
+	}
 	if len(m.Transaction) > 0 {
 		i -= len(m.Transaction)
 		copy(dAtA[i:], m.Transaction)
@@ -475,6 +757,39 @@ func (m *BzzAddress) MarshalToSizedBuffer(dAtA []byte) (int, error) {
 	return len(dAtA) - i, nil
 }
 
+func (m *ModeUpdate) Marshal() (dAtA []byte, err error) {
+	size := m.Size()
+	dAtA = make([]byte, size)
+	n, err := m.MarshalToSizedBuffer(dAtA[:size])
+	if err != nil {
+		return nil, err
+	}
+	return dAtA[:n], nil
+}
+
+func (m *ModeUpdate) MarshalTo(dAtA []byte) (int, error) {
+	size := m.Size()
+	return m.MarshalToSizedBuffer(dAtA[:size])
+}
+
+func (m *ModeUpdate) MarshalToSizedBuffer(dAtA []byte) (int, error) {
+	i := len(dAtA)
+	_ = i
+	var l int
+	_ = l
+	if m.FullNode {
+		i--
+		if m.FullNode {
+			dAtA[i] = 1
+		} else {
+			dAtA[i] = 0
+		}
+		i--
+		dAtA[i] = 0x8
+	}
+	return len(dAtA) - i, nil
+}
+
 func encodeVarintHandshake(dAtA []byte, offset int, v uint64) int {
 	offset -= sovHandshake(v)
 	base := offset
@@ -496,6 +811,12 @@ func (m *Syn) Size() (n int) {
 	if l > 0 {
 		n += 1 + l + sovHandshake(uint64(l))
 	}
+	if m.ProtocolVersion != 0 {
+		n += 1 + sovHandshake(uint64(m.ProtocolVersion))
+	}
+	if m.NetworkID != 0 {
+		n += 1 + sovHandshake(uint64(m.NetworkID))
+	}
 	return n
 }
 
@@ -519,6 +840,51 @@ func (m *Ack) Size() (n int) {
 	if l > 0 {
 		n += 1 + l + sovHandshake(uint64(l))
 	}
+	if m.ProtocolVersion != 0 {
+		n += 1 + sovHandshake(uint64(m.ProtocolVersion))
+	}
+	l = len(m.Nonce)
+	if l > 0 {
+		n += 1 + l + sovHandshake(uint64(l))
+	}
+	l = len(m.Signature)
+	if l > 0 {
+		n += 1 + l + sovHandshake(uint64(l))
+	}
+	if len(m.Capabilities) > 0 {
+		for _, s := range m.Capabilities {
+			l = len(s)
+			n += 1 + l + sovHandshake(uint64(l))
+		}
+	}
+	if m.BlockHeight != 0 {
+		n += 1 + sovHandshake(uint64(m.BlockHeight))
+	}
+	if m.MaxProtocolVersion != 0 {
+		n += 1 + sovHandshake(uint64(m.MaxProtocolVersion))
+	}
+	if m.Timestamp != 0 {
+		n += 1 + sovHandshake(uint64(m.Timestamp))
+	}
+	if m.MaxMessageSize != 0 {
+		n += 1 + sovHandshake(uint64(m.MaxMessageSize))
+	}
+	if m.RetryAfterSeconds != 0 {
+		n += 1 + sovHandshake(uint64(m.RetryAfterSeconds))
+	}
+	if len(m.Compressions) > 0 {
+		l = 0
+		for _, e := range m.Compressions {
+			l += sovHandshake(uint64(e))
+		}
+		n += 1 + sovHandshake(uint64(l)) + l
+	}
+	if len(m.Underlays) > 0 {
+		for _, b := range m.Underlays {
+			l = len(b)
+			n += 1 + l + sovHandshake(uint64(l))
+		}
+	}
 	l = len(m.WelcomeMessage)
 	if l > 0 {
 		n += 2 + l + sovHandshake(uint64(l))
@@ -564,6 +930,18 @@ func (m *BzzAddress) Size() (n int) {
 	return n
 }
 
+func (m *ModeUpdate) Size() (n int) {
+	if m == nil {
+		return 0
+	}
+	var l int
+	_ = l
+	if m.FullNode {
+		n += 2
+	}
+	return n
+}
+
 func sovHandshake(x uint64) (n int) {
 	return (math_bits.Len64(x|1) + 6) / 7
 }
@@ -633,6 +1011,44 @@ func (m *Syn) Unmarshal(dAtA []byte) error {
 				m.ObservedUnderlay = []byte{}
 			}
 			iNdEx = postIndex
+		case 2:
+			if wireType != 0 {
+				return fmt.Errorf("proto: wrong wireType = %d for field ProtocolVersion", wireType)
+			}
+			m.ProtocolVersion = 0
+			for shift := uint(0); ; shift += 7 {
+				if shift >= 64 {
+					return ErrIntOverflowHandshake
+				}
+				if iNdEx >= l {
+					return io.ErrUnexpectedEOF
+				}
+				b := dAtA[iNdEx]
+				iNdEx++
+				m.ProtocolVersion |= uint32(b&0x7F) << shift
+				if b < 0x80 {
+					break
+				}
+			}
+		case 3:
+			if wireType != 0 {
+				return fmt.Errorf("proto: wrong wireType = %d for field NetworkID", wireType)
+			}
+			m.NetworkID = 0
+			for shift := uint(0); ; shift += 7 {
+				if shift >= 64 {
+					return ErrIntOverflowHandshake
+				}
+				if iNdEx >= l {
+					return io.ErrUnexpectedEOF
+				}
+				b := dAtA[iNdEx]
+				iNdEx++
+				m.NetworkID |= uint64(b&0x7F) << shift
+				if b < 0x80 {
+					break
+				}
+			}
 		default:
 			iNdEx = preIndex
 			skippy, err := skipHandshake(dAtA[iNdEx:])
@@ -795,11 +1211,11 @@ func (m *Ack) Unmarshal(dAtA []byte) error {
 				m.Transaction = []byte{}
 			}
 			iNdEx = postIndex
-		case 99:
-			if wireType != 2 {
-				return fmt.Errorf("proto: wrong wireType = %d for field WelcomeMessage", wireType)
+		case 5:
+			if wireType != 0 {
+				return fmt.Errorf("proto: wrong wireType = %d for field ProtocolVersion", wireType)
 			}
-			var stringLen uint64
+			m.ProtocolVersion = 0
 			for shift := uint(0); ; shift += 7 {
 				if shift >= 64 {
 					return ErrIntOverflowHandshake
@@ -809,21 +1225,336 @@ func (m *Ack) Unmarshal(dAtA []byte) error {
 				}
 				b := dAtA[iNdEx]
 				iNdEx++
-				stringLen |= uint64(b&0x7F) << shift
+				m.ProtocolVersion |= uint32(b&0x7F) << shift
 				if b < 0x80 {
 					break
 				}
 			}
-			intStringLen := int(stringLen)
-			if intStringLen < 0 {
-				return ErrInvalidLengthHandshake
-			}
-			postIndex := iNdEx + intStringLen
-			if postIndex < 0 {
-				return ErrInvalidLengthHandshake
+		case 6:
+			if wireType != 2 {
+				return fmt.Errorf("proto: wrong wireType = %d for field Nonce", wireType)
 			}
-			if postIndex > l {
-				return io.ErrUnexpectedEOF
+			var byteLen int
+			for shift := uint(0); ; shift += 7 {
+				if shift >= 64 {
+					return ErrIntOverflowHandshake
+				}
+				if iNdEx >= l {
+					return io.ErrUnexpectedEOF
+				}
+				b := dAtA[iNdEx]
+				iNdEx++
+				byteLen |= int(b&0x7F) << shift
+				if b < 0x80 {
+					break
+				}
+			}
+			if byteLen < 0 {
+				return ErrInvalidLengthHandshake
+			}
+			postIndex := iNdEx + byteLen
+			if postIndex < 0 {
+				return ErrInvalidLengthHandshake
+			}
+			if postIndex > l {
+				return io.ErrUnexpectedEOF
+			}
+			m.Nonce = append(m.Nonce[:0], dAtA[iNdEx:postIndex]...)
+			if m.Nonce == nil {
+				m.Nonce = []byte{}
+			}
+			iNdEx = postIndex
+		case 7:
+			if wireType != 2 {
+				return fmt.Errorf("proto: wrong wireType = %d for field Signature", wireType)
+			}
+			var byteLen int
+			for shift := uint(0); ; shift += 7 {
+				if shift >= 64 {
+					return ErrIntOverflowHandshake
+				}
+				if iNdEx >= l {
+					return io.ErrUnexpectedEOF
+				}
+				b := dAtA[iNdEx]
+				iNdEx++
+				byteLen |= int(b&0x7F) << shift
+				if b < 0x80 {
+					break
+				}
+			}
+			if byteLen < 0 {
+				return ErrInvalidLengthHandshake
+			}
+			postIndex := iNdEx + byteLen
+			if postIndex < 0 {
+				return ErrInvalidLengthHandshake
+			}
+			if postIndex > l {
+				return io.ErrUnexpectedEOF
+			}
+			m.Signature = append(m.Signature[:0], dAtA[iNdEx:postIndex]...)
+			if m.Signature == nil {
+				m.Signature = []byte{}
+			}
+			iNdEx = postIndex
+		case 8:
+			if wireType != 2 {
+				return fmt.Errorf("proto: wrong wireType = %d for field Capabilities", wireType)
+			}
+			var stringLen uint64
+			for shift := uint(0); ; shift += 7 {
+				if shift >= 64 {
+					return ErrIntOverflowHandshake
+				}
+				if iNdEx >= l {
+					return io.ErrUnexpectedEOF
+				}
+				b := dAtA[iNdEx]
+				iNdEx++
+				stringLen |= uint64(b&0x7F) << shift
+				if b < 0x80 {
+					break
+				}
+			}
+			intStringLen := int(stringLen)
+			if intStringLen < 0 {
+				return ErrInvalidLengthHandshake
+			}
+			postIndex := iNdEx + intStringLen
+			if postIndex < 0 {
+				return ErrInvalidLengthHandshake
+			}
+			if postIndex > l {
+				return io.ErrUnexpectedEOF
+			}
+			m.Capabilities = append(m.Capabilities, string(dAtA[iNdEx:postIndex]))
+			iNdEx = postIndex
+		case 9:
+			if wireType != 0 {
+				return fmt.Errorf("proto: wrong wireType = %d for field BlockHeight", wireType)
+			}
+			m.BlockHeight = 0
+			for shift := uint(0); ; shift += 7 {
+				if shift >= 64 {
+					return ErrIntOverflowHandshake
+				}
+				if iNdEx >= l {
+					return io.ErrUnexpectedEOF
+				}
+				b := dAtA[iNdEx]
+				iNdEx++
+				m.BlockHeight |= uint64(b&0x7F) << shift
+				if b < 0x80 {
+					break
+				}
+			}
+		case 10:
+			if wireType != 0 {
+				return fmt.Errorf("proto: wrong wireType = %d for field MaxProtocolVersion", wireType)
+			}
+			m.MaxProtocolVersion = 0
+			for shift := uint(0); ; shift += 7 {
+				if shift >= 64 {
+					return ErrIntOverflowHandshake
+				}
+				if iNdEx >= l {
+					return io.ErrUnexpectedEOF
+				}
+				b := dAtA[iNdEx]
+				iNdEx++
+				m.MaxProtocolVersion |= uint32(b&0x7F) << shift
+				if b < 0x80 {
+					break
+				}
+			}
+		case 11:
+			if wireType != 0 {
+				return fmt.Errorf("proto: wrong wireType = %d for field Timestamp", wireType)
+			}
+			m.Timestamp = 0
+			for shift := uint(0); ; shift += 7 {
+				if shift >= 64 {
+					return ErrIntOverflowHandshake
+				}
+				if iNdEx >= l {
+					return io.ErrUnexpectedEOF
+				}
+				b := dAtA[iNdEx]
+				iNdEx++
+				m.Timestamp |= int64(b&0x7F) << shift
+				if b < 0x80 {
+					break
+				}
+			}
+		case 12:
+			if wireType != 0 {
+				return fmt.Errorf("proto: wrong wireType = %d for field MaxMessageSize", wireType)
+			}
+			m.MaxMessageSize = 0
+			for shift := uint(0); ; shift += 7 {
+				if shift >= 64 {
+					return ErrIntOverflowHandshake
+				}
+				if iNdEx >= l {
+					return io.ErrUnexpectedEOF
+				}
+				b := dAtA[iNdEx]
+				iNdEx++
+				m.MaxMessageSize |= uint32(b&0x7F) << shift
+				if b < 0x80 {
+					break
+				}
+			}
+		case 13:
+			if wireType != 0 {
+				return fmt.Errorf("proto: wrong wireType = %d for field RetryAfterSeconds", wireType)
+			}
+			m.RetryAfterSeconds = 0
+			for shift := uint(0); ; shift += 7 {
+				if shift >= 64 {
+					return ErrIntOverflowHandshake
+				}
+				if iNdEx >= l {
+					return io.ErrUnexpectedEOF
+				}
+				b := dAtA[iNdEx]
+				iNdEx++
+				m.RetryAfterSeconds |= uint32(b&0x7F) << shift
+				if b < 0x80 {
+					break
+				}
+			}
+		case 14:
+			if wireType == 0 {
+				var v Compression
+				for shift := uint(0); ; shift += 7 {
+					if shift >= 64 {
+						return ErrIntOverflowHandshake
+					}
+					if iNdEx >= l {
+						return io.ErrUnexpectedEOF
+					}
+					b := dAtA[iNdEx]
+					iNdEx++
+					v |= Compression(b&0x7F) << shift
+					if b < 0x80 {
+						break
+					}
+				}
+				m.Compressions = append(m.Compressions, v)
+			} else if wireType == 2 {
+				var packedLen int
+				for shift := uint(0); ; shift += 7 {
+					if shift >= 64 {
+						return ErrIntOverflowHandshake
+					}
+					if iNdEx >= l {
+						return io.ErrUnexpectedEOF
+					}
+					b := dAtA[iNdEx]
+					iNdEx++
+					packedLen |= int(b&0x7F) << shift
+					if b < 0x80 {
+						break
+					}
+				}
+				if packedLen < 0 {
+					return ErrInvalidLengthHandshake
+				}
+				postIndex := iNdEx + packedLen
+				if postIndex < 0 {
+					return ErrInvalidLengthHandshake
+				}
+				if postIndex > l {
+					return io.ErrUnexpectedEOF
+				}
+				var elementCount int
+				if elementCount != 0 && len(m.Compressions) == 0 {
+					m.Compressions = make([]Compression, 0, elementCount)
+				}
+				for iNdEx < postIndex {
+					var v Compression
+					for shift := uint(0); ; shift += 7 {
+						if shift >= 64 {
+							return ErrIntOverflowHandshake
+						}
+						if iNdEx >= l {
+							return io.ErrUnexpectedEOF
+						}
+						b := dAtA[iNdEx]
+						iNdEx++
+						v |= Compression(b&0x7F) << shift
+						if b < 0x80 {
+							break
+						}
+					}
+					m.Compressions = append(m.Compressions, v)
+				}
+			} else {
+				return fmt.Errorf("proto: wrong wireType = %d for field Compressions", wireType)
+			}
+		case 15:
+			if wireType != 2 {
+				return fmt.Errorf("proto: wrong wireType = %d for field Underlays", wireType)
+			}
+			var byteLen int
+			for shift := uint(0); ; shift += 7 {
+				if shift >= 64 {
+					return ErrIntOverflowHandshake
+				}
+				if iNdEx >= l {
+					return io.ErrUnexpectedEOF
+				}
+				b := dAtA[iNdEx]
+				iNdEx++
+				byteLen |= int(b&0x7F) << shift
+				if b < 0x80 {
+					break
+				}
+			}
+			if byteLen < 0 {
+				return ErrInvalidLengthHandshake
+			}
+			postIndex := iNdEx + byteLen
+			if postIndex < 0 {
+				return ErrInvalidLengthHandshake
+			}
+			if postIndex > l {
+				return io.ErrUnexpectedEOF
+			}
+			m.Underlays = append(m.Underlays, make([]byte, postIndex-iNdEx))
+			copy(m.Underlays[len(m.Underlays)-1], dAtA[iNdEx:postIndex])
+			iNdEx = postIndex
+		case 99:
+			if wireType != 2 {
+				return fmt.Errorf("proto: wrong wireType = %d for field WelcomeMessage", wireType)
+			}
+			var stringLen uint64
+			for shift := uint(0); ; shift += 7 {
+				if shift >= 64 {
+					return ErrIntOverflowHandshake
+				}
+				if iNdEx >= l {
+					return io.ErrUnexpectedEOF
+				}
+				b := dAtA[iNdEx]
+				iNdEx++
+				stringLen |= uint64(b&0x7F) << shift
+				if b < 0x80 {
+					break
+				}
+			}
+			intStringLen := int(stringLen)
+			if intStringLen < 0 {
+				return ErrInvalidLengthHandshake
+			}
+			postIndex := iNdEx + intStringLen
+			if postIndex < 0 {
+				return ErrInvalidLengthHandshake
+			}
+			if postIndex > l {
+				return io.ErrUnexpectedEOF
 			}
 			m.WelcomeMessage = string(dAtA[iNdEx:postIndex])
 			iNdEx = postIndex
@@ -1131,6 +1862,79 @@ func (m *BzzAddress) Unmarshal(dAtA []byte) error {
 	}
 	return nil
 }
+func (m *ModeUpdate) Unmarshal(dAtA []byte) error {
+	l := len(dAtA)
+	iNdEx := 0
+	for iNdEx < l {
+		preIndex := iNdEx
+		var wire uint64
+		for shift := uint(0); ; shift += 7 {
+			if shift >= 64 {
+				return ErrIntOverflowHandshake
+			}
+			if iNdEx >= l {
+				return io.ErrUnexpectedEOF
+			}
+			b := dAtA[iNdEx]
+			iNdEx++
+			wire |= uint64(b&0x7F) << shift
+			if b < 0x80 {
+				break
+			}
+		}
+		fieldNum := int32(wire >> 3)
+		wireType := int(wire & 0x7)
+		if wireType == 4 {
+			return fmt.Errorf("proto: ModeUpdate: wiretype end group for non-group")
+		}
+		if fieldNum <= 0 {
+			return fmt.Errorf("proto: ModeUpdate: illegal tag %d (wire type %d)", fieldNum, wire)
+		}
+		switch fieldNum {
+		case 1:
+			if wireType != 0 {
+				return fmt.Errorf("proto: wrong wireType = %d for field FullNode", wireType)
+			}
+			var v int
+			for shift := uint(0); ; shift += 7 {
+				if shift >= 64 {
+					return ErrIntOverflowHandshake
+				}
+				if iNdEx >= l {
+					return io.ErrUnexpectedEOF
+				}
+				b := dAtA[iNdEx]
+				iNdEx++
+				v |= int(b&0x7F) << shift
+				if b < 0x80 {
+					break
+				}
+			}
+			m.FullNode = bool(v != 0)
+		default:
+			iNdEx = preIndex
+			skippy, err := skipHandshake(dAtA[iNdEx:])
+			if err != nil {
+				return err
+			}
+			if skippy < 0 {
+				return ErrInvalidLengthHandshake
+			}
+			if (iNdEx + skippy) < 0 {
+				return ErrInvalidLengthHandshake
+			}
+			if (iNdEx + skippy) > l {
+				return io.ErrUnexpectedEOF
+			}
+			iNdEx += skippy
+		}
+	}
+
+	if iNdEx > l {
+		return io.ErrUnexpectedEOF
+	}
+	return nil
+}
 func skipHandshake(dAtA []byte) (n int, err error) {
 	l := len(dAtA)
 	iNdEx := 0
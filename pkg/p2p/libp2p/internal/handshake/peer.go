@@ -0,0 +1,58 @@
+// Copyright 2021 The Swarm Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package handshake
+
+import (
+	"fmt"
+
+	"github.com/ethersphere/bee/pkg/p2p"
+	libp2ppeer "github.com/libp2p/go-libp2p-core/peer"
+	ma "github.com/multiformats/go-multiaddr"
+)
+
+// Peer identifies a peer that completed the handshake by both its overlay
+// address and its libp2p peer ID.
+type Peer struct {
+	p2p.Peer
+	ID libp2ppeer.ID
+}
+
+// Key returns a string which uniquely identifies the peer, suitable to be
+// used as a map key in an address book.
+func (p Peer) Key() string {
+	return p.Address.ByteString() + string(p.ID)
+}
+
+// NewPeer returns the identity of the peer from the handshake Info and the
+// underlay of the connection to the peer, which must contain its peer ID.
+// ErrPeerIDMismatch is returned if the underlay advertised in the handshake
+// belongs to another peer.
+func NewPeer(info Info, underlay ma.Multiaddr) (Peer, error) {
+	if info.BzzAddress == nil {
+		return Peer{}, ErrInvalidAck
+	}
+
+	addrInfo, err := libp2ppeer.AddrInfoFromP2pAddr(underlay)
+	if err != nil {
+		return Peer{}, fmt.Errorf("underlay peer id: %w", err)
+	}
+
+	advertised, err := libp2ppeer.AddrInfoFromP2pAddr(info.BzzAddress.Underlay)
+	if err != nil {
+		return Peer{}, fmt.Errorf("advertised underlay peer id: %w", err)
+	}
+
+	if addrInfo.ID != advertised.ID {
+		return Peer{}, ErrPeerIDMismatch
+	}
+
+	return Peer{
+		Peer: p2p.Peer{
+			Address:  info.BzzAddress.Overlay,
+			FullNode: info.FullNode,
+		},
+		ID: addrInfo.ID,
+	}, nil
+}
@@ -0,0 +1,86 @@
+// Copyright 2021 The Swarm Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package handshake
+
+import (
+	"sync"
+	"time"
+
+	libp2ppeer "github.com/libp2p/go-libp2p-core/peer"
+	ma "github.com/multiformats/go-multiaddr"
+	"golang.org/x/time/rate"
+)
+
+// rateLimiter limits the rate of handshakes per remote address with a token
+// bucket for every address. Limiters of addresses which are idle long enough
+// for their bucket to be full again are pruned.
+type rateLimiter struct {
+	limit     rate.Limit
+	burst     int
+	idle      time.Duration
+	limiters  map[string]*peerLimiter
+	lastPrune time.Time
+	mu        sync.Mutex
+}
+
+type peerLimiter struct {
+	limiter  *rate.Limiter
+	lastSeen time.Time
+}
+
+func newRateLimiter(limit rate.Limit, burst int) *rateLimiter {
+	return &rateLimiter{
+		limit:     limit,
+		burst:     burst,
+		idle:      time.Duration(float64(burst) / float64(limit) * float64(time.Second)),
+		limiters:  make(map[string]*peerLimiter),
+		lastPrune: timeNow(),
+	}
+}
+
+// allow returns false if the handshake with the key exceeds the rate limit.
+func (r *rateLimiter) allow(key string) bool {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	now := timeNow()
+	if now.Sub(r.lastPrune) > r.idle {
+		r.prune(now)
+	}
+
+	l, ok := r.limiters[key]
+	if !ok {
+		l = &peerLimiter{limiter: rate.NewLimiter(r.limit, r.burst)}
+		r.limiters[key] = l
+	}
+	l.lastSeen = now
+	return l.limiter.AllowN(now, 1)
+}
+
+// prune removes the limiters which are idle longer than the time needed to
+// refill their bucket, as they are equivalent to new ones. It must be called
+// with the lock held.
+func (r *rateLimiter) prune(now time.Time) {
+	for key, l := range r.limiters {
+		if now.Sub(l.lastSeen) > r.idle {
+			delete(r.limiters, key)
+		}
+	}
+	r.lastPrune = now
+}
+
+// rateLimitKey returns the IP address of the remote multiaddress, so that
+// reconnecting from a different port or with a new peer ID is limited
+// together. The peer ID is used if the multiaddress has no IP address.
+func rateLimitKey(addr ma.Multiaddr, peerID libp2ppeer.ID) string {
+	if addr != nil {
+		for _, p := range []int{ma.P_IP4, ma.P_IP6} {
+			if v, err := addr.ValueForProtocol(p); err == nil {
+				return v
+			}
+		}
+	}
+	return peerID.String()
+}
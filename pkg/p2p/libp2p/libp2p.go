@@ -85,6 +85,12 @@ type Options struct {
 	FullNode       bool
 	WelcomeMessage string
 	Transaction    []byte
+	Capabilities   []string
+	LightNodeLimit int
+	// HandshakeProtocolIDs are the libp2p protocol ids of the handshake
+	// stream in the order of preference. The default handshake protocol id
+	// is used if it is empty.
+	HandshakeProtocolIDs []string
 }
 
 func New(ctx context.Context, signer beecrypto.Signer, networkID uint64, overlay swarm.Address, addr string, ab addressbook.Putter, storer storage.StateStorer, lightNodes *lightnode.Container, swapBackend handshake.SenderMatcher, logger logging.Logger, tracer *tracing.Tracer, o Options) (*Service, error) {
@@ -210,7 +216,12 @@ func New(ctx context.Context, signer beecrypto.Signer, networkID uint64, overlay
 		advertisableAddresser = natAddrResolver
 	}
 
-	handshakeService, err := handshake.New(signer, advertisableAddresser, swapBackend, overlay, networkID, o.FullNode, o.Transaction, o.WelcomeMessage, logger)
+	handshakeOpts := []handshake.Option{handshake.WithLightNodeLimit(o.LightNodeLimit)}
+	if len(o.HandshakeProtocolIDs) > 0 {
+		handshakeOpts = append(handshakeOpts, handshake.WithProtocolIDs(o.HandshakeProtocolIDs...))
+	}
+
+	handshakeService, err := handshake.New(signer, advertisableAddresser, swapBackend, overlay, networkID, handshake.MinSupportedVersion, handshake.MaxSupportedVersion, o.FullNode, o.Transaction, o.Capabilities, o.WelcomeMessage, logger, handshakeOpts...)
 	if err != nil {
 		return nil, fmt.Errorf("handshake service: %w", err)
 	}
@@ -238,15 +249,8 @@ func New(ctx context.Context, signer beecrypto.Signer, networkID uint64, overlay
 
 	peerRegistry.setDisconnecter(s)
 
-	// Construct protocols.
-	id := protocol.ID(p2p.NewSwarmStreamName(handshake.ProtocolName, handshake.ProtocolVersion, handshake.StreamName))
-	matcher, err := s.protocolSemverMatcher(id)
-	if err != nil {
-		return nil, fmt.Errorf("protocol version match %s: %w", id, err)
-	}
-
 	// handshake
-	s.host.SetStreamHandlerMatch(id, matcher, func(stream network.Stream) {
+	handshakeHandler := func(stream network.Stream) {
 		select {
 		case <-s.ready:
 		case <-s.ctx.Done():
@@ -364,7 +368,19 @@ func New(ctx context.Context, signer beecrypto.Signer, networkID uint64, overlay
 
 		s.logger.Debugf("stream handler: successfully connected to peer %s%s (inbound)", i.BzzAddress.ShortString(), i.LightString())
 		s.logger.Infof("stream handler: successfully connected to peer %s%s (inbound)", i.BzzAddress.Overlay, i.LightString())
-	})
+	}
+
+	// Construct protocols.
+	// The same handler serves every handshake protocol id, as they differ
+	// only in the name.
+	for _, handshakeID := range handshakeService.ProtocolIDs() {
+		id := protocol.ID(handshakeID)
+		matcher, err := s.protocolSemverMatcher(id)
+		if err != nil {
+			return nil, fmt.Errorf("protocol version match %s: %w", id, err)
+		}
+		s.host.SetStreamHandlerMatch(id, matcher, handshakeHandler)
+	}
 
 	h.Network().SetConnHandler(func(_ network.Conn) {
 		s.metrics.HandledConnectionCount.Inc()
@@ -541,7 +557,11 @@ func (s *Service) Connect(ctx context.Context, addr ma.Multiaddr) (address *bzz.
 		return nil, err
 	}
 
-	stream, err := s.newStreamForPeerID(ctx, info.ID, handshake.ProtocolName, handshake.ProtocolVersion, handshake.StreamName)
+	var handshakeIDs []protocol.ID
+	for _, id := range s.handshakeService.ProtocolIDs() {
+		handshakeIDs = append(handshakeIDs, protocol.ID(id))
+	}
+	stream, err := s.newStreamForProtocolIDs(ctx, info.ID, handshakeIDs...)
 	if err != nil {
 		_ = s.host.Network().ClosePeer(info.ID)
 		return nil, fmt.Errorf("connect new stream: %w", err)
@@ -735,7 +755,13 @@ func (s *Service) NewStream(ctx context.Context, overlay swarm.Address, headers
 
 func (s *Service) newStreamForPeerID(ctx context.Context, peerID libp2ppeer.ID, protocolName, protocolVersion, streamName string) (network.Stream, error) {
 	swarmStreamName := p2p.NewSwarmStreamName(protocolName, protocolVersion, streamName)
-	st, err := s.host.NewStream(ctx, peerID, protocol.ID(swarmStreamName))
+	return s.newStreamForProtocolIDs(ctx, peerID, protocol.ID(swarmStreamName))
+}
+
+// newStreamForProtocolIDs opens a new stream to the peer with the first of
+// the protocol ids, in the order of preference, that the peer supports.
+func (s *Service) newStreamForProtocolIDs(ctx context.Context, peerID libp2ppeer.ID, ids ...protocol.ID) (network.Stream, error) {
+	st, err := s.host.NewStream(ctx, peerID, ids...)
 	if err != nil {
 		if st != nil {
 			s.logger.Debug("stream experienced unexpected early close")
@@ -744,7 +770,7 @@ func (s *Service) newStreamForPeerID(ctx context.Context, peerID libp2ppeer.ID,
 		if err == multistream.ErrNotSupported || err == multistream.ErrIncorrectVersion {
 			return nil, p2p.NewIncompatibleStreamError(err)
 		}
-		return nil, fmt.Errorf("create stream %q to %q: %w", swarmStreamName, peerID, err)
+		return nil, fmt.Errorf("create stream %q to %q: %w", ids, peerID, err)
 	}
 	s.metrics.CreatedStreamCount.Inc()
 	return st, nil
@@ -2,7 +2,8 @@
 // Use of this source code is governed by a BSD-style
 // license that can be found in the LICENSE file.
 
-package mock
+// Package p2ptest provides helpers for testing code which uses p2p streams.
+package p2ptest
 
 import (
 	"bytes"
@@ -10,6 +11,8 @@ import (
 	"github.com/ethersphere/bee/pkg/p2p"
 )
 
+// Stream is a p2p.Stream which reads from and writes to the provided buffers.
+// Read and write errors can be injected after a number of successful calls.
 type Stream struct {
 	readBuffer        *bytes.Buffer
 	writeBuffer       *bytes.Buffer
@@ -19,17 +22,24 @@ type Stream struct {
 	writeError        error
 	readErrCheckmark  int
 	writeErrCheckmark int
+	closed            bool
+	reset             bool
 }
 
-func NewStream(readBuffer, writeBuffer *bytes.Buffer) *Stream {
-	return &Stream{readBuffer: readBuffer, writeBuffer: writeBuffer}
+// NewStream creates a new Stream which reads from the in buffer and writes to
+// the out buffer. Two streams with swapped buffers are connected to each other.
+func NewStream(in, out *bytes.Buffer) *Stream {
+	return &Stream{readBuffer: in, writeBuffer: out}
 }
-func (s *Stream) SetReadErr(err error, checkmark int) {
+
+// SetReadError makes every Read return err once checkmark reads succeeded.
+func (s *Stream) SetReadError(err error, checkmark int) {
 	s.readError = err
 	s.readErrCheckmark = checkmark
 }
 
-func (s *Stream) SetWriteErr(err error, checkmark int) {
+// SetWriteError makes every Write return err once checkmark writes succeeded.
+func (s *Stream) SetWriteError(err error, checkmark int) {
 	s.writeError = err
 	s.writeErrCheckmark = checkmark
 }
@@ -61,6 +71,7 @@ func (s *Stream) ResponseHeaders() p2p.Headers {
 }
 
 func (s *Stream) Close() error {
+	s.closed = true
 	return nil
 }
 
@@ -69,5 +80,16 @@ func (s *Stream) FullClose() error {
 }
 
 func (s *Stream) Reset() error {
+	s.reset = true
 	return nil
 }
+
+// IsClosed returns true if Close was called on the stream.
+func (s *Stream) IsClosed() bool {
+	return s.closed
+}
+
+// IsReset returns true if Reset was called on the stream.
+func (s *Stream) IsReset() bool {
+	return s.reset
+}
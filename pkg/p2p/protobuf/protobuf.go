@@ -5,27 +5,83 @@
 package protobuf
 
 import (
+	"bufio"
 	"context"
+	"encoding/binary"
 	"errors"
+	"fmt"
 	"io"
+	"net"
+	"time"
 
 	"github.com/ethersphere/bee/pkg/p2p"
 	ggio "github.com/gogo/protobuf/io"
 	"github.com/gogo/protobuf/proto"
 )
 
-const delimitedReaderMaxSize = 128 * 1024 // max message size
+const (
+	// DefaultMaxMessageSize is the maximal size of a message read by the
+	// reader created with NewReader.
+	DefaultMaxMessageSize = delimitedReaderMaxSize
 
-var ErrTimeout = errors.New("timeout")
+	delimitedReaderMaxSize = 128 * 1024 // max message size
+	// readBufferSize is the size of the buffer of the reader, so that the
+	// length prefix and small messages are read with a single call to the
+	// underlying stream.
+	readBufferSize = 4 * 1024
+)
+
+var (
+	ErrTimeout = errors.New("timeout")
+	// ErrMessageTooLarge is returned if the declared length of the message
+	// is greater than the maximal message size of the reader.
+	ErrMessageTooLarge = errors.New("message too large")
+	// ErrTrailingBytes is returned by the strict reader if the decoded
+	// message does not account for all bytes of its frame.
+	ErrTrailingBytes = errors.New("trailing bytes in message")
+)
 
 type Message = proto.Message
 
-func NewWriterAndReader(s p2p.Stream) (Writer, Reader) {
-	return NewWriter(s), NewReader(s)
+func NewWriterAndReader(s p2p.Stream, opts ...ReaderOption) (Writer, Reader) {
+	return NewWriter(s), NewReader(s, opts...)
+}
+
+func NewReader(r io.Reader, opts ...ReaderOption) Reader {
+	return NewReaderWithLimit(r, delimitedReaderMaxSize, opts...)
+}
+
+// ReaderOption is a function that configures optional parameters of the
+// Reader.
+type ReaderOption func(*Reader)
+
+// WithValidator sets the function which is called with every message right
+// after it is decoded by ReadMsg. If the function returns an error, ReadMsg
+// returns it wrapped, so that malformed messages can be rejected before they
+// are used.
+func WithValidator(f func(Message) error) ReaderOption {
+	return func(r *Reader) {
+		r.validator = f
+	}
+}
+
+// NewReaderWithLimit creates a new Reader which does not read messages larger
+// than maxSize bytes. The length of the message is checked before the buffer
+// for it is allocated.
+func NewReaderWithLimit(r io.Reader, maxSize int, opts ...ReaderOption) Reader {
+	br := bufio.NewReaderSize(r, readBufferSize)
+	// the delimited reader uses br as is, without another buffer
+	return newReader(ggio.NewDelimitedReader(br, maxSize), r, br, maxSize, opts)
 }
 
-func NewReader(r io.Reader) Reader {
-	return newReader(ggio.NewDelimitedReader(r, delimitedReaderMaxSize))
+// NewStrictReader creates a new Reader which, in addition to the limit of
+// NewReaderWithLimit, returns ErrTrailingBytes if the framed length of a
+// message is different from the length of the decoded message. Such frames
+// contain unknown fields or non-canonical encodings, which may indicate that
+// the peer and the local node disagree on the message boundaries.
+func NewStrictReader(r io.Reader, maxSize int, opts ...ReaderOption) Reader {
+	br := bufio.NewReaderSize(r, readBufferSize)
+	return newReader(&strictReader{r: br, maxSize: maxSize}, r, br, maxSize, opts)
 }
 
 func NewWriter(w io.Writer) Writer {
@@ -47,12 +103,77 @@ func ReadMessages(r io.Reader, newMessage func() Message) (m []Message, err erro
 	return m, nil
 }
 
+// strictReader is a length-delimited message reader which checks that the
+// decoded message has the framed length.
+type strictReader struct {
+	r       *bufio.Reader
+	buf     []byte
+	maxSize int
+}
+
+func (r *strictReader) ReadMsg(msg proto.Message) error {
+	length, err := binary.ReadUvarint(r.r)
+	if err != nil {
+		return err
+	}
+	if length > uint64(r.maxSize) {
+		return ErrMessageTooLarge
+	}
+	if cap(r.buf) < int(length) {
+		r.buf = make([]byte, length)
+	}
+	buf := r.buf[:length]
+	if _, err := io.ReadFull(r.r, buf); err != nil {
+		return err
+	}
+	if err := proto.Unmarshal(buf, msg); err != nil {
+		return err
+	}
+	if proto.Size(msg) != int(length) {
+		return ErrTrailingBytes
+	}
+	return nil
+}
+
 type Reader struct {
 	ggio.Reader
+	source io.Reader
+	// buffered wraps the source and it is shared by all reading methods, so
+	// that the bytes buffered for one message are not lost for the next one.
+	buffered  *bufio.Reader
+	maxSize   int
+	validator func(Message) error
+}
+
+func newReader(r ggio.Reader, source io.Reader, buffered *bufio.Reader, maxSize int, opts []ReaderOption) Reader {
+	reader := Reader{Reader: r, source: source, buffered: buffered, maxSize: maxSize}
+	for _, o := range opts {
+		o(&reader)
+	}
+	return reader
 }
 
-func newReader(r ggio.Reader) Reader {
-	return Reader{Reader: r}
+// readDeadliner is implemented by streams which support read deadlines.
+type readDeadliner interface {
+	SetReadDeadline(t time.Time) error
+}
+
+// ReadMsg reads a single message. It returns ErrMessageTooLarge if the
+// declared length of the message exceeds the maximal message size.
+func (r Reader) ReadMsg(msg proto.Message) error {
+	err := r.Reader.ReadMsg(msg)
+	if errors.Is(err, io.ErrShortBuffer) {
+		return ErrMessageTooLarge
+	}
+	if err != nil {
+		return err
+	}
+	if r.validator != nil {
+		if err := r.validator(msg); err != nil {
+			return fmt.Errorf("invalid message: %w", err)
+		}
+	}
+	return nil
 }
 
 func (r Reader) ReadMsgWithContext(ctx context.Context, msg proto.Message) error {
@@ -69,6 +190,102 @@ func (r Reader) ReadMsgWithContext(ctx context.Context, msg proto.Message) error
 	}
 }
 
+// Stream reads length-delimited frames back to back and calls f with the
+// raw bytes of every frame until the end of the stream, in which case nil
+// is returned, or until the context is done. The buffer is reused between
+// frames, so the raw bytes are valid only until f returns. Frames larger
+// than the maximal message size are rejected with ErrMessageTooLarge.
+// Stream and ReadMsg share the read buffer, so they can be used one after
+// another on the same Reader.
+//
+// If the context is done while a frame is being read, the pending read is
+// interrupted with the read deadline of the underlying stream, if it is
+// supported, and Stream returns once the read has stopped, so that later
+// reads get the following bytes. Otherwise the read goes on in the background
+// and it would consume those bytes, so the Reader must not be used anymore.
+func (r Reader) Stream(ctx context.Context, f func(raw []byte) error) error {
+	errChan := make(chan error, 1)
+	go func() {
+		errChan <- r.stream(ctx, f)
+	}()
+
+	select {
+	case err := <-errChan:
+		return err
+	case <-ctx.Done():
+	}
+
+	if dr, ok := r.source.(readDeadliner); ok {
+		// a deadline in the past fails the pending read right away
+		if err := dr.SetReadDeadline(time.Unix(1, 0)); err == nil {
+			<-errChan
+			_ = dr.SetReadDeadline(time.Time{})
+		}
+	}
+	return ctx.Err()
+}
+
+func (r Reader) stream(ctx context.Context, f func(raw []byte) error) error {
+	br := r.buffered
+	var buf []byte
+	for {
+		length, err := binary.ReadUvarint(br)
+		if err != nil {
+			if errors.Is(err, io.EOF) {
+				return nil
+			}
+			return err
+		}
+		if length > uint64(r.maxSize) {
+			return ErrMessageTooLarge
+		}
+		if cap(buf) < int(length) {
+			buf = make([]byte, length)
+		}
+		buf = buf[:length]
+		if _, err := io.ReadFull(br, buf); err != nil {
+			if errors.Is(err, io.EOF) {
+				return io.ErrUnexpectedEOF
+			}
+			return err
+		}
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+		if err := f(buf); err != nil {
+			return err
+		}
+	}
+}
+
+// ReadMsgWithTimeout reads a single message and returns ErrTimeout if it is
+// not read within the duration. The read deadline of the underlying stream is
+// used if it is supported.
+func (r Reader) ReadMsgWithTimeout(msg proto.Message, d time.Duration) error {
+	if dr, ok := r.source.(readDeadliner); ok {
+		if err := dr.SetReadDeadline(time.Now().Add(d)); err != nil {
+			return err
+		}
+		defer func() { _ = dr.SetReadDeadline(time.Time{}) }()
+
+		err := r.ReadMsg(msg)
+		var netErr net.Error
+		if errors.As(err, &netErr) && netErr.Timeout() {
+			return ErrTimeout
+		}
+		return err
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), d)
+	defer cancel()
+
+	err := r.ReadMsgWithContext(ctx, msg)
+	if errors.Is(err, context.DeadlineExceeded) {
+		return ErrTimeout
+	}
+	return err
+}
+
 type Writer struct {
 	ggio.Writer
 }
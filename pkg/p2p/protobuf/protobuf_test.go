@@ -5,9 +5,13 @@
 package protobuf_test
 
 import (
+	"bytes"
 	"context"
+	"encoding/binary"
+	"errors"
 	"fmt"
 	"io"
+	"net"
 	"testing"
 	"time"
 
@@ -65,6 +69,48 @@ func TestReader_ReadMsg(t *testing.T) {
 	}
 }
 
+func TestReader_buffered(t *testing.T) {
+	var buf bytes.Buffer
+	w := protobuf.NewWriter(&buf)
+	for _, m := range []string{"first", "second", "third"} {
+		if err := w.WriteMsg(&pb.Message{Text: m}); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	source := &countingReader{r: &buf}
+	r := protobuf.NewReader(source)
+
+	var msg pb.Message
+	for _, want := range []string{"first", "second"} {
+		if err := r.ReadMsg(&msg); err != nil {
+			t.Fatal(err)
+		}
+		if msg.Text != want {
+			t.Fatalf("got message %q, want %q", msg.Text, want)
+		}
+	}
+	if source.reads != 1 {
+		t.Fatalf("got %d reads from the source, want 1", source.reads)
+	}
+
+	// the rest of the buffered bytes are available to Stream
+	var got []string
+	if err := r.Stream(context.Background(), func(raw []byte) error {
+		var msg pb.Message
+		if err := msg.Unmarshal(raw); err != nil {
+			return err
+		}
+		got = append(got, msg.Text)
+		return nil
+	}); err != nil {
+		t.Fatal(err)
+	}
+	if fmt.Sprint(got) != fmt.Sprint([]string{"third"}) {
+		t.Fatalf("got messages %v, want %v", got, []string{"third"})
+	}
+}
+
 func TestReader_timeout(t *testing.T) {
 	messages := []string{"first", "second", "third"}
 
@@ -125,6 +171,308 @@ func TestReader_timeout(t *testing.T) {
 	}
 }
 
+func TestReader_messageTooLarge(t *testing.T) {
+	for _, tc := range []struct {
+		name    string
+		size    uint64
+		reader  func(io.Reader) protobuf.Reader
+		wantErr error
+	}{
+		{
+			name: "NewReader",
+			size: 128*1024 + 1,
+			reader: func(r io.Reader) protobuf.Reader {
+				return protobuf.NewReader(r)
+			},
+			wantErr: protobuf.ErrMessageTooLarge,
+		},
+		{
+			name: "NewReaderWithLimit",
+			size: 1025,
+			reader: func(r io.Reader) protobuf.Reader {
+				return protobuf.NewReaderWithLimit(r, 1024)
+			},
+			wantErr: protobuf.ErrMessageTooLarge,
+		},
+		{
+			name: "NewReaderWithLimit huge",
+			size: 1 << 62,
+			reader: func(r io.Reader) protobuf.Reader {
+				return protobuf.NewReaderWithLimit(r, 1024)
+			},
+			wantErr: protobuf.ErrMessageTooLarge,
+		},
+		{
+			name: "NewReaderWithLimit within limit",
+			size: 1024,
+			reader: func(r io.Reader) protobuf.Reader {
+				return protobuf.NewReaderWithLimit(r, 1024)
+			},
+			wantErr: io.EOF,
+		},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			// only the length prefix is sent, without the message
+			prefix := make([]byte, binary.MaxVarintLen64)
+			n := binary.PutUvarint(prefix, tc.size)
+
+			var msg pb.Message
+			err := tc.reader(bytes.NewReader(prefix[:n])).ReadMsg(&msg)
+			if !errors.Is(err, tc.wantErr) {
+				t.Fatalf("got error %v, want %v", err, tc.wantErr)
+			}
+		})
+	}
+}
+
+func TestReader_Stream(t *testing.T) {
+	messages := []string{"first", "second", "third"}
+
+	var buf bytes.Buffer
+	w := protobuf.NewWriter(&buf)
+	for _, m := range messages {
+		if err := w.WriteMsg(&pb.Message{Text: m}); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	var got []string
+	err := protobuf.NewReader(&buf).Stream(context.Background(), func(raw []byte) error {
+		var msg pb.Message
+		if err := msg.Unmarshal(raw); err != nil {
+			return err
+		}
+		got = append(got, msg.Text)
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if fmt.Sprint(got) != fmt.Sprint(messages) {
+		t.Errorf("got messages %v, want %v", got, messages)
+	}
+
+	t.Run("callback error", func(t *testing.T) {
+		wantErr := errors.New("test error")
+		var calls int
+		err := protobuf.NewReader(newMessageReader(messages, 0)).Stream(context.Background(), func(raw []byte) error {
+			calls++
+			return wantErr
+		})
+		if !errors.Is(err, wantErr) {
+			t.Fatalf("got error %v, want %v", err, wantErr)
+		}
+		if calls != 1 {
+			t.Fatalf("got %v calls, want 1", calls)
+		}
+	})
+
+	t.Run("message too large", func(t *testing.T) {
+		prefix := make([]byte, binary.MaxVarintLen64)
+		n := binary.PutUvarint(prefix, 1025)
+		err := protobuf.NewReaderWithLimit(bytes.NewReader(prefix[:n]), 1024).Stream(context.Background(), func(raw []byte) error {
+			return nil
+		})
+		if !errors.Is(err, protobuf.ErrMessageTooLarge) {
+			t.Fatalf("got error %v, want %v", err, protobuf.ErrMessageTooLarge)
+		}
+	})
+
+	t.Run("context canceled", func(t *testing.T) {
+		r, w := io.Pipe()
+		defer w.Close()
+
+		ctx, cancel := context.WithCancel(context.Background())
+		cancel()
+		err := protobuf.NewReader(r).Stream(ctx, func(raw []byte) error {
+			return nil
+		})
+		if !errors.Is(err, context.Canceled) {
+			t.Fatalf("got error %v, want %v", err, context.Canceled)
+		}
+	})
+
+	t.Run("read after context canceled", func(t *testing.T) {
+		c1, c2 := net.Pipe()
+		defer c1.Close()
+		defer c2.Close()
+
+		r := protobuf.NewReader(c1)
+
+		ctx, cancel := context.WithCancel(context.Background())
+		time.AfterFunc(50*time.Millisecond, cancel)
+		err := r.Stream(ctx, func(raw []byte) error {
+			return errors.New("unexpected frame")
+		})
+		if !errors.Is(err, context.Canceled) {
+			t.Fatalf("got error %v, want %v", err, context.Canceled)
+		}
+
+		// the message is not consumed by the canceled stream
+		go func() {
+			_ = protobuf.NewWriter(c2).WriteMsg(&pb.Message{Text: "first"})
+		}()
+		var msg pb.Message
+		if err := r.ReadMsgWithTimeout(&msg, time.Second); err != nil {
+			t.Fatal(err)
+		}
+		if msg.Text != "first" {
+			t.Errorf("got message %q, want %q", msg.Text, "first")
+		}
+	})
+}
+
+func TestStrictReader(t *testing.T) {
+	msg := &pb.Message{Text: "first"}
+	data, err := msg.Marshal()
+	if err != nil {
+		t.Fatal(err)
+	}
+	// an unknown varint field 15 with value 1 inside the frame
+	crafted := append(append([]byte(nil), data...), 0x78, 0x01)
+
+	frame := func(data []byte) []byte {
+		prefix := make([]byte, binary.MaxVarintLen64)
+		n := binary.PutUvarint(prefix, uint64(len(data)))
+		return append(prefix[:n], data...)
+	}
+
+	// a valid message, the crafted one and again a valid message
+	var buf bytes.Buffer
+	buf.Write(frame(data))
+	buf.Write(frame(crafted))
+	buf.Write(frame(data))
+	stream := buf.Bytes()
+
+	t.Run("lenient", func(t *testing.T) {
+		r := protobuf.NewReader(bytes.NewReader(stream))
+		for i := 0; i < 3; i++ {
+			var got pb.Message
+			if err := r.ReadMsg(&got); err != nil {
+				t.Fatal(err)
+			}
+			if got.Text != msg.Text {
+				t.Fatalf("got message %q, want %q", got.Text, msg.Text)
+			}
+		}
+	})
+
+	t.Run("strict", func(t *testing.T) {
+		r := protobuf.NewStrictReader(bytes.NewReader(stream), 1024)
+		var got pb.Message
+		if err := r.ReadMsg(&got); err != nil {
+			t.Fatal(err)
+		}
+		if got.Text != msg.Text {
+			t.Fatalf("got message %q, want %q", got.Text, msg.Text)
+		}
+		if err := r.ReadMsg(&got); !errors.Is(err, protobuf.ErrTrailingBytes) {
+			t.Fatalf("got error %v, want %v", err, protobuf.ErrTrailingBytes)
+		}
+		// the frame is consumed, so the next message is read correctly
+		if err := r.ReadMsg(&got); err != nil {
+			t.Fatal(err)
+		}
+		if got.Text != msg.Text {
+			t.Fatalf("got message %q, want %q", got.Text, msg.Text)
+		}
+		if err := r.ReadMsg(&got); err != io.EOF {
+			t.Fatalf("got error %v, want %v", err, io.EOF)
+		}
+	})
+
+	t.Run("strict message too large", func(t *testing.T) {
+		r := protobuf.NewStrictReader(bytes.NewReader(stream), len(data)-1)
+		var got pb.Message
+		if err := r.ReadMsg(&got); !errors.Is(err, protobuf.ErrMessageTooLarge) {
+			t.Fatalf("got error %v, want %v", err, protobuf.ErrMessageTooLarge)
+		}
+	})
+}
+
+func TestReader_WithValidator(t *testing.T) {
+	errEmptyText := errors.New("empty text")
+	validator := protobuf.WithValidator(func(m protobuf.Message) error {
+		if m.(*pb.Message).Text == "" {
+			return errEmptyText
+		}
+		return nil
+	})
+
+	for _, tc := range []struct {
+		name       string
+		readerFunc func(r io.Reader) protobuf.Reader
+	}{
+		{
+			name: "NewReader",
+			readerFunc: func(r io.Reader) protobuf.Reader {
+				return protobuf.NewReader(r, validator)
+			},
+		},
+		{
+			name: "NewStrictReader",
+			readerFunc: func(r io.Reader) protobuf.Reader {
+				return protobuf.NewStrictReader(r, 1024, validator)
+			},
+		},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			r := tc.readerFunc(newMessageReader([]string{"first", ""}, 0))
+
+			var msg pb.Message
+			if err := r.ReadMsg(&msg); err != nil {
+				t.Fatal(err)
+			}
+			if msg.Text != "first" {
+				t.Fatalf("got message %q, want %q", msg.Text, "first")
+			}
+
+			err := r.ReadMsgWithContext(context.Background(), &msg)
+			if !errors.Is(err, errEmptyText) {
+				t.Fatalf("got error %v, want %v", err, errEmptyText)
+			}
+		})
+	}
+}
+
+func TestReader_ReadMsgWithTimeout(t *testing.T) {
+	t.Run("blocking reader", func(t *testing.T) {
+		pr, pw := io.Pipe()
+		defer pw.Close()
+
+		var msg pb.Message
+		err := protobuf.NewReader(pr).ReadMsgWithTimeout(&msg, 50*time.Millisecond)
+		if !errors.Is(err, protobuf.ErrTimeout) {
+			t.Fatalf("got error %v, want %v", err, protobuf.ErrTimeout)
+		}
+	})
+
+	t.Run("read deadline", func(t *testing.T) {
+		c1, c2 := net.Pipe()
+		defer c1.Close()
+		defer c2.Close()
+
+		r := protobuf.NewReader(c1)
+
+		var msg pb.Message
+		err := r.ReadMsgWithTimeout(&msg, 50*time.Millisecond)
+		if !errors.Is(err, protobuf.ErrTimeout) {
+			t.Fatalf("got error %v, want %v", err, protobuf.ErrTimeout)
+		}
+
+		// a message received within the timeout is read
+		go func() {
+			_ = protobuf.NewWriter(c2).WriteMsg(&pb.Message{Text: "first"})
+		}()
+		if err := r.ReadMsgWithTimeout(&msg, time.Second); err != nil {
+			t.Fatal(err)
+		}
+		if msg.Text != "first" {
+			t.Errorf("got message %q, want %q", msg.Text, "first")
+		}
+	})
+}
+
 func TestWriter(t *testing.T) {
 	messages := []string{"first", "second", "third"}
 
@@ -244,6 +592,46 @@ func TestReadMessages(t *testing.T) {
 	}
 }
 
+func BenchmarkReader_ReadMsg(b *testing.B) {
+	var buf bytes.Buffer
+	w := protobuf.NewWriter(&buf)
+	for i := 0; i < 1000; i++ {
+		if err := w.WriteMsg(&pb.Message{Text: fmt.Sprintf("message %d", i)}); err != nil {
+			b.Fatal(err)
+		}
+	}
+	data := buf.Bytes()
+
+	b.ReportAllocs()
+	b.ResetTimer()
+	for n := 0; n < b.N; n++ {
+		source := &countingReader{r: bytes.NewReader(data)}
+		r := protobuf.NewReader(source)
+		var msg pb.Message
+		for {
+			if err := r.ReadMsg(&msg); err != nil {
+				if err == io.EOF {
+					break
+				}
+				b.Fatal(err)
+			}
+		}
+		b.ReportMetric(float64(source.reads), "reads/op")
+	}
+}
+
+// countingReader counts the calls to the Read method of the underlying
+// reader.
+type countingReader struct {
+	r     io.Reader
+	reads int
+}
+
+func (c *countingReader) Read(p []byte) (n int, err error) {
+	c.reads++
+	return c.r.Read(p)
+}
+
 func newMessageReader(messages []string, delay time.Duration) io.Reader {
 	r, pipe := io.Pipe()
 	w := protobuf.NewWriter(pipe)
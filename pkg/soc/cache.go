@@ -0,0 +1,57 @@
+// Copyright 2021 The Swarm Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package soc
+
+import (
+	"crypto/sha256"
+
+	"github.com/ethersphere/bee/pkg/swarm"
+	lru "github.com/hashicorp/golang-lru"
+)
+
+// CachedValidator validates single-owner chunks and memoizes the results, so
+// that popular chunks which are validated repeatedly are validated only once.
+// It is safe for concurrent use.
+type CachedValidator struct {
+	cache *lru.Cache
+}
+
+// NewCachedValidator creates a new CachedValidator which remembers the
+// results of up to maxEntries chunks, evicting the least recently used ones.
+// The maxEntries is at least one.
+func NewCachedValidator(maxEntries int) *CachedValidator {
+	if maxEntries < 1 {
+		maxEntries = 1
+	}
+	// the error is returned only for a non-positive size
+	cache, _ := lru.New(maxEntries)
+	return &CachedValidator{cache: cache}
+}
+
+// cachedResult is the value of the cache, so that the nil error of valid
+// chunks is cached as well.
+type cachedResult struct {
+	err error
+}
+
+// Validate checks if the chunk is a valid single-owner chunk and returns the
+// reason if it is not, as Validate does. The results are keyed by both the
+// address and the hash of the data of the chunk, so that a chunk with the
+// same address but different data is validated again.
+func (v *CachedValidator) Validate(ch swarm.Chunk) error {
+	key := cacheKey(ch)
+	if r, ok := v.cache.Get(key); ok {
+		return r.(cachedResult).err
+	}
+	err := Validate(ch)
+	v.cache.Add(key, cachedResult{err: err})
+	return err
+}
+
+// cacheKey returns the key of the chunk in the cache of the CachedValidator.
+func cacheKey(ch swarm.Chunk) string {
+	h := sha256.Sum256(ch.Data())
+	return ch.Address().ByteString() + string(h[:])
+}
@@ -0,0 +1,86 @@
+// Copyright 2021 The Swarm Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package soc_test
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/ethersphere/bee/pkg/soc"
+	"github.com/ethersphere/bee/pkg/swarm"
+)
+
+func TestCachedValidator(t *testing.T) {
+	chunks := newUpdateChunks(t, 3)
+
+	t.Run("hit", func(t *testing.T) {
+		v := soc.NewCachedValidator(10)
+		if v.Cached(chunks[0]) {
+			t.Fatal("chunk cached before validation")
+		}
+		for i := 0; i < 2; i++ {
+			if err := v.Validate(chunks[0]); err != nil {
+				t.Fatal(err)
+			}
+			if !v.Cached(chunks[0]) {
+				t.Fatal("chunk not cached")
+			}
+		}
+	})
+
+	t.Run("miss", func(t *testing.T) {
+		v := soc.NewCachedValidator(10)
+		if err := v.Validate(chunks[0]); err != nil {
+			t.Fatal(err)
+		}
+
+		// a changed payload under the same address must be validated again
+		data := append([]byte(nil), chunks[0].Data()...)
+		data[len(data)-1]++
+		changed := swarm.NewChunk(chunks[0].Address(), data)
+		if v.Cached(changed) {
+			t.Fatal("changed chunk cached")
+		}
+		want := soc.Validate(changed)
+		if want == nil {
+			t.Fatal("changed chunk is valid")
+		}
+		for i := 0; i < 2; i++ {
+			if err := v.Validate(changed); !errors.Is(err, want) {
+				t.Fatalf("got error %v, want %v", err, want)
+			}
+		}
+		if err := v.Validate(chunks[0]); err != nil {
+			t.Fatal(err)
+		}
+	})
+
+	t.Run("eviction", func(t *testing.T) {
+		v := soc.NewCachedValidator(2)
+		for _, ch := range chunks[:2] {
+			if err := v.Validate(ch); err != nil {
+				t.Fatal(err)
+			}
+		}
+		// use the first chunk, so that the second one is the least recently
+		// used
+		if err := v.Validate(chunks[0]); err != nil {
+			t.Fatal(err)
+		}
+		if err := v.Validate(chunks[2]); err != nil {
+			t.Fatal(err)
+		}
+
+		if !v.Cached(chunks[0]) {
+			t.Fatal("recently used chunk evicted")
+		}
+		if v.Cached(chunks[1]) {
+			t.Fatal("least recently used chunk not evicted")
+		}
+		if !v.Cached(chunks[2]) {
+			t.Fatal("new chunk not cached")
+		}
+	})
+}
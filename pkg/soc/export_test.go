@@ -4,23 +4,16 @@
 
 package soc
 
+import "github.com/ethersphere/bee/pkg/swarm"
+
 var (
 	ErrInvalidAddress = errInvalidAddress
 	Hash              = hash
 	RecoverAddress    = recoverAddress
 )
 
-// Signature returns the SOC signature.
-func (s *SOC) Signature() []byte {
-	return s.signature
-}
-
-// OwnerAddress returns the ethereum address of the SOC owner.
-func (s *SOC) OwnerAddress() []byte {
-	return s.owner
-}
-
-// ID returns the SOC id.
-func (s *SOC) ID() []byte {
-	return s.id
+// Cached reports whether the result of the chunk is in the cache, without
+// updating its recency.
+func (v *CachedValidator) Cached(ch swarm.Chunk) bool {
+	return v.cache.Contains(cacheKey(ch))
 }
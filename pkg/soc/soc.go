@@ -9,6 +9,7 @@ package soc
 import (
 	"bytes"
 	"errors"
+	stdhash "hash"
 
 	"github.com/ethersphere/bee/pkg/cac"
 	"github.com/ethersphere/bee/pkg/crypto"
@@ -21,20 +22,62 @@ const (
 	minChunkSize  = IdSize + SignatureSize + swarm.SpanSize
 )
 
+// SignatureScheme identifies how the owner of a SOC is derived from its
+// signature.
+type SignatureScheme uint8
+
+const (
+	// SchemeECDSARecover is the default scheme, a secp256k1 ECDSA signature
+	// [R || S || V] from which the public key of the owner is recovered.
+	SchemeECDSARecover SignatureScheme = iota + 1
+)
+
 var (
 	errInvalidAddress = errors.New("soc: invalid address")
-	errWrongChunkSize = errors.New("soc: chunk length is less than minimum")
+
+	// ErrShortChunk is returned when the chunk data is too short to hold
+	// the id, the signature and the wrapped chunk span.
+	ErrShortChunk = errors.New("soc: chunk length is less than minimum")
+	// ErrInvalidSignature is returned when the owner can not be recovered
+	// from the chunk signature.
+	ErrInvalidSignature = errors.New("soc: invalid signature")
+	// ErrAddressMismatch is returned when the chunk address does not match
+	// the address derived from the id and the recovered owner.
+	ErrAddressMismatch = errors.New("soc: address mismatch")
+	// ErrInvalidIdLength is returned when the SOC id is not IdSize bytes long.
+	ErrInvalidIdLength = errors.New("soc: invalid id length")
+	// ErrInvalidSpan is returned when the span of the wrapped chunk is less
+	// than the length of its payload.
+	ErrInvalidSpan = errors.New("soc: invalid span")
+	// ErrInvalidContentChunk is returned when the wrapped chunk is not a valid
+	// content-addressed chunk.
+	ErrInvalidContentChunk = errors.New("soc: invalid content-addressed chunk")
+	// ErrUnexpectedOwner is returned when the chunk is valid but it is not
+	// signed by the expected owner.
+	ErrUnexpectedOwner = errors.New("soc: unexpected owner")
+	// ErrEmptyPayload is returned when signing a SOC which wraps a chunk
+	// without payload, unless it is allowed with WithEmptyPayload.
+	ErrEmptyPayload = errors.New("soc: empty payload")
+	// ErrUnknownSignatureScheme is returned when the scheme byte of the
+	// signature does not identify a supported signature scheme.
+	ErrUnknownSignatureScheme = errors.New("soc: unknown signature scheme")
 )
 
 // ID is a SOC identifier
 type ID []byte
 
+// HasherFactory creates the hasher used for the signed digest and the
+// address of a SOC. The default is swarm.NewHasher, keccak256.
+type HasherFactory func() stdhash.Hash
+
 // SOC wraps a content-addressed chunk.
 type SOC struct {
-	id        ID
-	owner     []byte // owner is the address in bytes of SOC owner.
-	signature []byte
-	chunk     swarm.Chunk // wrapped chunk.
+	id           ID
+	owner        []byte // owner is the address in bytes of SOC owner.
+	signature    []byte
+	chunk        swarm.Chunk // wrapped chunk.
+	hasher       HasherFactory
+	emptyPayload bool // emptyPayload allows signing a wrapped chunk without payload.
 }
 
 // New creates a new SOC representation from arbitrary id and
@@ -46,8 +89,40 @@ func New(id ID, ch swarm.Chunk) *SOC {
 	}
 }
 
+// WrapContent creates the content-addressed chunk of data to be wrapped in a
+// SOC. The span is prepended to data and the address is its BMT hash.
+func WrapContent(data []byte) (swarm.Chunk, error) {
+	return cac.New(data)
+}
+
+// WithHasher sets the hasher factory used for the signed digest and the
+// address of the SOC. Chunks created with a custom hasher are valid only if
+// they are validated with the same one.
+func (s *SOC) WithHasher(f HasherFactory) *SOC {
+	s.hasher = f
+	return s
+}
+
+// WithEmptyPayload allows signing the SOC when the wrapped chunk has only the
+// span and no payload, which is rejected with ErrEmptyPayload by default.
+func (s *SOC) WithEmptyPayload() *SOC {
+	s.emptyPayload = true
+	return s
+}
+
+// newHasher returns a new hasher from the hasher factory of the SOC.
+func (s *SOC) newHasher() stdhash.Hash {
+	if s.hasher == nil {
+		return swarm.NewHasher()
+	}
+	return s.hasher()
+}
+
 // NewSigned creates a single-owner chunk based on already signed data.
 func NewSigned(id ID, ch swarm.Chunk, owner, sig []byte) (*SOC, error) {
+	if len(id) != IdSize {
+		return nil, ErrInvalidIdLength
+	}
 	s := New(id, ch)
 	if len(owner) != crypto.AddressSize {
 		return nil, errInvalidAddress
@@ -62,7 +137,22 @@ func (s *SOC) address() (swarm.Address, error) {
 	if len(s.owner) != crypto.AddressSize {
 		return swarm.ZeroAddress, errInvalidAddress
 	}
-	return CreateAddress(s.id, s.owner)
+	return createAddress(s.id, s.owner, s.newHasher())
+}
+
+// ID returns the SOC id.
+func (s *SOC) ID() ID {
+	return s.id
+}
+
+// Signature returns the SOC signature.
+func (s *SOC) Signature() []byte {
+	return s.signature
+}
+
+// OwnerAddress returns the ethereum address of the SOC owner.
+func (s *SOC) OwnerAddress() []byte {
+	return s.owner
 }
 
 // WrappedChunk returns the chunk wrapped by the SOC.
@@ -90,23 +180,28 @@ func (s *SOC) toBytes() []byte {
 
 // Sign signs a SOC using the given signer.
 // It returns a signed SOC chunk ready for submission to the network.
+// The wrapped chunk must be a valid content-addressed chunk with a non-empty
+// payload, unless empty payloads are allowed with WithEmptyPayload.
 func (s *SOC) Sign(signer crypto.Signer) (swarm.Chunk, error) {
-	// create owner
-	publicKey, err := signer.PublicKey()
-	if err != nil {
-		return nil, err
+	if len(s.id) != IdSize {
+		return nil, ErrInvalidIdLength
+	}
+	if !cac.Valid(s.chunk) {
+		return nil, ErrInvalidContentChunk
+	}
+	if !s.emptyPayload && len(s.chunk.Data()) == swarm.SpanSize {
+		return nil, ErrEmptyPayload
 	}
-	ownerAddressBytes, err := crypto.NewEthereumAddress(*publicKey)
+
+	// create owner
+	ownerAddress, err := signer.EthereumAddress()
 	if err != nil {
 		return nil, err
 	}
-	if len(ownerAddressBytes) != crypto.AddressSize {
-		return nil, errInvalidAddress
-	}
-	s.owner = ownerAddressBytes
+	s.owner = ownerAddress.Bytes()
 
 	// generate the data to sign
-	toSignBytes, err := hash(s.id, s.chunk.Address().Bytes())
+	toSignBytes, err := s.signedDigestWith(s.newHasher())
 	if err != nil {
 		return nil, err
 	}
@@ -121,11 +216,144 @@ func (s *SOC) Sign(signer crypto.Signer) (swarm.Chunk, error) {
 	return s.Chunk()
 }
 
+// Resign transfers a single-owner chunk to a new owner. The id and the wrapped
+// chunk of the valid chunk ch are signed by newSigner, so the returned chunk
+// has the address of the id and the new owner.
+func Resign(ch swarm.Chunk, newSigner crypto.Signer) (swarm.Chunk, error) {
+	s, err := validated(ch, swarm.NewHasher())
+	if err != nil {
+		return nil, err
+	}
+	// the wrapped chunk is kept as is, even if it has no payload
+	return New(s.id, s.chunk).WithEmptyPayload().Sign(newSigner)
+}
+
 // FromChunk recreates a SOC representation from swarm.Chunk data.
 func FromChunk(sch swarm.Chunk) (*SOC, error) {
+	return fromChunk(sch, swarm.NewHasher())
+}
+
+// fromChunk recreates a SOC representation from swarm.Chunk data
+// using the provided hasher for the signed digest.
+func fromChunk(sch swarm.Chunk, h stdhash.Hash) (*SOC, error) {
+	s, err := parse(sch)
+	if err != nil {
+		return nil, err
+	}
+
+	scheme, err := signatureScheme(s.signature)
+	if err != nil {
+		return nil, err
+	}
+
+	toSignBytes, err := s.signedDigestWith(h)
+	if err != nil {
+		return nil, err
+	}
+
+	// recover owner information
+	var recoveredOwnerAddress []byte
+	switch scheme {
+	case SchemeECDSARecover:
+		recoveredOwnerAddress, err = recoverAddress(s.signature, toSignBytes)
+		if err != nil {
+			return nil, ErrInvalidSignature
+		}
+	default:
+		return nil, ErrUnknownSignatureScheme
+	}
+	if len(recoveredOwnerAddress) != crypto.AddressSize {
+		return nil, errInvalidAddress
+	}
+	s.owner = recoveredOwnerAddress
+
+	return s, nil
+}
+
+// RecoverOwner recovers the public key of the owner of a single-owner chunk
+// and returns it in compressed form.
+func RecoverOwner(sch swarm.Chunk) ([]byte, error) {
+	s, err := parse(sch)
+	if err != nil {
+		return nil, err
+	}
+	// the public key can be recovered only with the ECDSA scheme
+	if scheme, err := signatureScheme(s.signature); err != nil {
+		return nil, err
+	} else if scheme != SchemeECDSARecover {
+		return nil, ErrUnknownSignatureScheme
+	}
+
+	toSignBytes, err := s.signedDigest()
+	if err != nil {
+		return nil, err
+	}
+
+	recoveredPublicKey, err := crypto.Recover(s.signature, toSignBytes)
+	if err != nil {
+		return nil, ErrInvalidSignature
+	}
+	return crypto.EncodeSecp256k1PublicKey(recoveredPublicKey), nil
+}
+
+// Identifier returns the id of a single-owner chunk, the first IdSize bytes
+// of the chunk data.
+func Identifier(sch swarm.Chunk) (ID, error) {
+	chunkData := sch.Data()
+	if len(chunkData) < minChunkSize {
+		return nil, ErrShortChunk
+	}
+	return chunkData[:IdSize], nil
+}
+
+// Scheme returns the signature scheme of a single-owner chunk. The signature
+// is not verified.
+func Scheme(sch swarm.Chunk) (SignatureScheme, error) {
+	chunkData := sch.Data()
+	if len(chunkData) < minChunkSize {
+		return 0, ErrShortChunk
+	}
+	return signatureScheme(chunkData[IdSize : IdSize+SignatureSize])
+}
+
+// signatureScheme returns the scheme identified by the scheme byte, the last
+// byte of the signature. For the ECDSA scheme it is the recovery id, 27 to 34,
+// so that chunks signed before the schemes were introduced keep the default
+// scheme. Other values are reserved for future schemes, which have the rest
+// of the signature, 64 bytes, available.
+func signatureScheme(signature []byte) (SignatureScheme, error) {
+	if v := signature[SignatureSize-1]; v >= 27 && v <= 34 {
+		return SchemeECDSARecover, nil
+	}
+	return 0, ErrUnknownSignatureScheme
+}
+
+// PayloadSize returns the size of the payload of the chunk wrapped by a
+// single-owner chunk, without the span. The signature is not verified.
+func PayloadSize(sch swarm.Chunk) (int, error) {
+	s, err := parse(sch)
+	if err != nil {
+		return 0, err
+	}
+	return len(s.chunk.Data()) - swarm.SpanSize, nil
+}
+
+// Owner returns the ethereum address of the owner of a single-owner chunk
+// recovered from its signature.
+func Owner(sch swarm.Chunk) ([]byte, error) {
+	s, err := FromChunk(sch)
+	if err != nil {
+		return nil, err
+	}
+	return s.owner, nil
+}
+
+// parse splits the single-owner chunk data into the id, the signature
+// and the wrapped chunk without recovering the owner.
+func parse(sch swarm.Chunk) (*SOC, error) {
 	chunkData := sch.Data()
 	if len(chunkData) < minChunkSize {
-		return nil, errWrongChunkSize
+		return nil, ErrShortChunk
 	}
 
 	// add all the data fields to the SOC
@@ -142,30 +370,35 @@ func FromChunk(sch swarm.Chunk) (*SOC, error) {
 	if err != nil {
 		return nil, err
 	}
-
-	toSignBytes, err := hash(s.id, ch.Address().Bytes())
-	if err != nil {
-		return nil, err
-	}
-
-	// recover owner information
-	recoveredOwnerAddress, err := recoverAddress(s.signature, toSignBytes)
-	if err != nil {
-		return nil, err
-	}
-	if len(recoveredOwnerAddress) != crypto.AddressSize {
-		return nil, errInvalidAddress
-	}
-	s.owner = recoveredOwnerAddress
 	s.chunk = ch
 
 	return s, nil
 }
 
+// signedDigest returns the digest the owner signs, the hash of the id
+// and the wrapped chunk address.
+func (s *SOC) signedDigest() ([]byte, error) {
+	return s.signedDigestWith(swarm.NewHasher())
+}
+
+// signedDigestWith returns the signed digest using the provided hasher.
+func (s *SOC) signedDigestWith(h stdhash.Hash) ([]byte, error) {
+	return hashWith(h, s.id, s.chunk.Address().Bytes())
+}
+
 // CreateAddress creates a new SOC address from the id and
-// the ethereum address of the owner.
+// the ethereum address of the owner. The address is the keccak256
+// hash of id || owner, so it can be computed before the chunk exists.
 func CreateAddress(id ID, owner []byte) (swarm.Address, error) {
-	sum, err := hash(id, owner)
+	return createAddress(id, owner, swarm.NewHasher())
+}
+
+// createAddress creates a new SOC address using the provided hasher.
+func createAddress(id ID, owner []byte, h stdhash.Hash) (swarm.Address, error) {
+	if len(id) != IdSize {
+		return swarm.ZeroAddress, ErrInvalidIdLength
+	}
+	sum, err := hashWith(h, id, owner)
 	if err != nil {
 		return swarm.ZeroAddress, err
 	}
@@ -174,7 +407,12 @@ func CreateAddress(id ID, owner []byte) (swarm.Address, error) {
 
 // hash hashes the given values in order.
 func hash(values ...[]byte) ([]byte, error) {
-	h := swarm.NewHasher()
+	return hashWith(swarm.NewHasher(), values...)
+}
+
+// hashWith resets the hasher and hashes the given values in order with it.
+func hashWith(h stdhash.Hash, values ...[]byte) ([]byte, error) {
+	h.Reset()
 	for _, v := range values {
 		_, err := h.Write(v)
 		if err != nil {
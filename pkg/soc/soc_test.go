@@ -9,6 +9,7 @@ import (
 	"encoding/binary"
 	"encoding/hex"
 	"errors"
+	"fmt"
 	"testing"
 
 	"github.com/ethereum/go-ethereum/common"
@@ -16,6 +17,7 @@ import (
 	"github.com/ethersphere/bee/pkg/crypto"
 	"github.com/ethersphere/bee/pkg/soc"
 	"github.com/ethersphere/bee/pkg/swarm"
+	"golang.org/x/crypto/sha3"
 )
 
 func TestNew(t *testing.T) {
@@ -45,6 +47,38 @@ func TestNew(t *testing.T) {
 	}
 }
 
+func TestWrapContent(t *testing.T) {
+	bmtHashOfFoo := "2387e8e7d8a48c2a9339c97c1dc3461a9a7aa07e994c5cb8b38fd7c1b3e6ea48"
+	payload := []byte("foo")
+
+	ch, err := soc.WrapContent(payload)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := swarm.MustParseHexAddress(bmtHashOfFoo); !ch.Address().Equal(want) {
+		t.Fatalf("address mismatch. got %s want %s", ch.Address(), want)
+	}
+
+	fooBytes := make([]byte, swarm.SpanSize+len(payload))
+	binary.LittleEndian.PutUint64(fooBytes, uint64(len(payload)))
+	copy(fooBytes[swarm.SpanSize:], payload)
+	if !bytes.Equal(ch.Data(), fooBytes) {
+		t.Fatalf("data mismatch. got %x want %x", ch.Data(), fooBytes)
+	}
+
+	privKey, err := crypto.GenerateSecp256k1Key()
+	if err != nil {
+		t.Fatal(err)
+	}
+	sch, err := soc.New(make([]byte, soc.IdSize), ch).Sign(crypto.NewDefaultSigner(privKey))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !soc.Valid(sch) {
+		t.Fatal("wrapped content is not a valid soc")
+	}
+}
+
 func TestNewSigned(t *testing.T) {
 	owner := common.HexToAddress("8d3766440f0d7b949a5e32995d09619a7f86e632")
 	// signature of hash(id + chunk address of foo)
@@ -172,6 +206,36 @@ func TestChunkErrorWithoutOwner(t *testing.T) {
 }
 
 // TestSign tests whether a soc is correctly signed.
+// TestInvalidIdLength verifies that ids shorter than IdSize are rejected
+// instead of producing a chunk with a corrupted address.
+func TestInvalidIdLength(t *testing.T) {
+	owner := common.HexToAddress("8d3766440f0d7b949a5e32995d09619a7f86e632")
+	id := make([]byte, 16)
+
+	ch, err := cac.New([]byte("foo"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	privKey, err := crypto.GenerateSecp256k1Key()
+	if err != nil {
+		t.Fatal(err)
+	}
+	signer := crypto.NewDefaultSigner(privKey)
+
+	if _, err := soc.New(id, ch).Sign(signer); !errors.Is(err, soc.ErrInvalidIdLength) {
+		t.Fatalf("sign: got error %v, want %v", err, soc.ErrInvalidIdLength)
+	}
+
+	if _, err := soc.NewSigned(id, ch, owner.Bytes(), make([]byte, soc.SignatureSize)); !errors.Is(err, soc.ErrInvalidIdLength) {
+		t.Fatalf("new signed: got error %v, want %v", err, soc.ErrInvalidIdLength)
+	}
+
+	if _, err := soc.CreateAddress(id, owner.Bytes()); !errors.Is(err, soc.ErrInvalidIdLength) {
+		t.Fatalf("create address: got error %v, want %v", err, soc.ErrInvalidIdLength)
+	}
+}
+
 func TestSign(t *testing.T) {
 	privKey, err := crypto.GenerateSecp256k1Key()
 	if err != nil {
@@ -227,6 +291,355 @@ func TestSign(t *testing.T) {
 	}
 }
 
+// TestSignWithHasher verifies that a soc signed with a custom hasher is
+// valid only with the same hasher.
+func TestSignWithHasher(t *testing.T) {
+	privKey, err := crypto.GenerateSecp256k1Key()
+	if err != nil {
+		t.Fatal(err)
+	}
+	signer := crypto.NewDefaultSigner(privKey)
+
+	ch, err := cac.New([]byte("foo"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	id := make([]byte, soc.IdSize)
+	sch, err := soc.New(id, ch).WithHasher(sha3.New256).Sign(signer)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	owner, err := signer.EthereumAddress()
+	if err != nil {
+		t.Fatal(err)
+	}
+	h := sha3.New256()
+	_, _ = h.Write(id)
+	_, _ = h.Write(owner.Bytes())
+	if want := swarm.NewAddress(h.Sum(nil)); !sch.Address().Equal(want) {
+		t.Fatalf("got address %s, want %s", sch.Address(), want)
+	}
+
+	if !soc.ValidWithHasher(sch, sha3.New256) {
+		t.Fatal("chunk is not valid with the hasher it was created with")
+	}
+	if soc.Valid(sch) {
+		t.Fatal("chunk created with a custom hasher is valid with the default hasher")
+	}
+
+	// a chunk created with the default hasher is not valid with a custom one
+	sch, err = soc.New(id, ch).Sign(signer)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !soc.ValidWithHasher(sch, swarm.NewHasher) {
+		t.Fatal("chunk is not valid with the default hasher")
+	}
+	if err := soc.ValidateWithHasher(sch, sha3.New256); !errors.Is(err, soc.ErrAddressMismatch) {
+		t.Fatalf("got error %v, want %v", err, soc.ErrAddressMismatch)
+	}
+}
+
+// TestSignInvalidContentChunk verifies that a soc is not signed if the
+// wrapped chunk address does not match its data.
+func TestSignInvalidContentChunk(t *testing.T) {
+	privKey, err := crypto.GenerateSecp256k1Key()
+	if err != nil {
+		t.Fatal(err)
+	}
+	signer := crypto.NewDefaultSigner(privKey)
+
+	ch, err := cac.New([]byte("foo"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	other, err := cac.New([]byte("bar"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	invalid := swarm.NewChunk(other.Address(), ch.Data())
+
+	if _, err := soc.New(make([]byte, soc.IdSize), invalid).Sign(signer); !errors.Is(err, soc.ErrInvalidContentChunk) {
+		t.Fatalf("got error %v, want %v", err, soc.ErrInvalidContentChunk)
+	}
+}
+
+// TestSignEmptyPayload verifies that a chunk without payload is wrapped only
+// when empty payloads are allowed.
+func TestSignEmptyPayload(t *testing.T) {
+	privKey, err := crypto.GenerateSecp256k1Key()
+	if err != nil {
+		t.Fatal(err)
+	}
+	signer := crypto.NewDefaultSigner(privKey)
+
+	ch, err := cac.NewWithDataSpan(make([]byte, swarm.SpanSize))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := soc.New(make([]byte, soc.IdSize), ch).Sign(signer); !errors.Is(err, soc.ErrEmptyPayload) {
+		t.Fatalf("got error %v, want %v", err, soc.ErrEmptyPayload)
+	}
+
+	sch, err := soc.New(make([]byte, soc.IdSize), ch).WithEmptyPayload().Sign(signer)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := soc.Validate(sch); err != nil {
+		t.Fatal(err)
+	}
+}
+
+// TestPayloadSize verifies that the size of the wrapped payload is read
+// from a soc chunk.
+func TestPayloadSize(t *testing.T) {
+	privKey, err := crypto.GenerateSecp256k1Key()
+	if err != nil {
+		t.Fatal(err)
+	}
+	signer := crypto.NewDefaultSigner(privKey)
+
+	for _, size := range []int{0, 1, swarm.ChunkSize} {
+		t.Run(fmt.Sprintf("%d bytes", size), func(t *testing.T) {
+			data := make([]byte, swarm.SpanSize+size)
+			binary.LittleEndian.PutUint64(data, uint64(size))
+			ch, err := cac.NewWithDataSpan(data)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			sch, err := soc.New(make([]byte, soc.IdSize), ch).WithEmptyPayload().Sign(signer)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			got, err := soc.PayloadSize(sch)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got != size {
+				t.Fatalf("got payload size %d, want %d", got, size)
+			}
+		})
+	}
+
+	t.Run("short chunk", func(t *testing.T) {
+		short := swarm.NewChunk(swarm.ZeroAddress, make([]byte, soc.IdSize+soc.SignatureSize))
+		if _, err := soc.PayloadSize(short); !errors.Is(err, soc.ErrShortChunk) {
+			t.Fatalf("got error %v, want %v", err, soc.ErrShortChunk)
+		}
+	})
+}
+
+func TestScheme(t *testing.T) {
+	privKey, err := crypto.GenerateSecp256k1Key()
+	if err != nil {
+		t.Fatal(err)
+	}
+	ch, err := cac.New([]byte("foo"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	sch, err := soc.New(make([]byte, soc.IdSize), ch).Sign(crypto.NewDefaultSigner(privKey))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	t.Run("default", func(t *testing.T) {
+		scheme, err := soc.Scheme(sch)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if scheme != soc.SchemeECDSARecover {
+			t.Fatalf("got scheme %d, want %d", scheme, soc.SchemeECDSARecover)
+		}
+		if err := soc.Validate(sch); err != nil {
+			t.Fatal(err)
+		}
+	})
+
+	t.Run("unknown", func(t *testing.T) {
+		data := make([]byte, len(sch.Data()))
+		copy(data, sch.Data())
+		data[soc.IdSize+soc.SignatureSize-1] = 0xff
+		unknown := swarm.NewChunk(sch.Address(), data)
+
+		if _, err := soc.Scheme(unknown); !errors.Is(err, soc.ErrUnknownSignatureScheme) {
+			t.Fatalf("got error %v, want %v", err, soc.ErrUnknownSignatureScheme)
+		}
+		if err := soc.Validate(unknown); !errors.Is(err, soc.ErrUnknownSignatureScheme) {
+			t.Fatalf("got error %v, want %v", err, soc.ErrUnknownSignatureScheme)
+		}
+		if _, err := soc.RecoverOwner(unknown); !errors.Is(err, soc.ErrUnknownSignatureScheme) {
+			t.Fatalf("got error %v, want %v", err, soc.ErrUnknownSignatureScheme)
+		}
+	})
+}
+
+func TestResign(t *testing.T) {
+	privKey1, err := crypto.GenerateSecp256k1Key()
+	if err != nil {
+		t.Fatal(err)
+	}
+	privKey2, err := crypto.GenerateSecp256k1Key()
+	if err != nil {
+		t.Fatal(err)
+	}
+	signer2 := crypto.NewDefaultSigner(privKey2)
+
+	ch, err := cac.New([]byte("foo"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	id := bytes.Repeat([]byte{1}, soc.IdSize)
+	sch, err := soc.New(id, ch).Sign(crypto.NewDefaultSigner(privKey1))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	resigned, err := soc.Resign(sch, signer2)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !soc.Valid(resigned) {
+		t.Fatal("resigned chunk is not valid")
+	}
+	if resigned.Address().Equal(sch.Address()) {
+		t.Fatalf("resigned chunk has the address of the original %s", sch.Address())
+	}
+
+	owner2, err := signer2.EthereumAddress()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := soc.ValidateWithOwner(resigned, owner2.Bytes()); err != nil {
+		t.Fatal(err)
+	}
+	wantAddress, err := soc.CreateAddress(id, owner2.Bytes())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !resigned.Address().Equal(wantAddress) {
+		t.Fatalf("got address %s, want %s", resigned.Address(), wantAddress)
+	}
+
+	s, err := soc.FromChunk(resigned)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(s.ID(), id) {
+		t.Fatalf("got id %x, want %x", s.ID(), id)
+	}
+	if !s.WrappedChunk().Equal(ch) {
+		t.Fatal("wrapped chunk is not the original one")
+	}
+
+	// the original chunk is not affected
+	if !soc.Valid(sch) {
+		t.Fatal("original chunk is not valid")
+	}
+
+	t.Run("invalid chunk", func(t *testing.T) {
+		invalid := swarm.NewChunk(swarm.ZeroAddress, sch.Data())
+		if _, err := soc.Resign(invalid, signer2); !errors.Is(err, soc.ErrAddressMismatch) {
+			t.Fatalf("got error %v, want %v", err, soc.ErrAddressMismatch)
+		}
+	})
+}
+
+// TestSignWithSignerFunc verifies that a valid soc chunk is created with
+// a signer which does not expose the private key.
+func TestSignWithSignerFunc(t *testing.T) {
+	privKey, err := crypto.GenerateSecp256k1Key()
+	if err != nil {
+		t.Fatal(err)
+	}
+	// remote represents a signer holding the key outside of the node
+	remote := crypto.NewDefaultSigner(privKey)
+	signer := crypto.NewSignerFunc(remote.Sign, remote.PublicKey)
+
+	ch, err := cac.New([]byte("foo"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	sch, err := soc.New(make([]byte, soc.IdSize), ch).Sign(signer)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if err := soc.Validate(sch); err != nil {
+		t.Fatal(err)
+	}
+
+	s, err := soc.FromChunk(sch)
+	if err != nil {
+		t.Fatal(err)
+	}
+	owner, err := remote.EthereumAddress()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(s.OwnerAddress(), owner.Bytes()) {
+		t.Fatalf("owner address mismatch. got %x want %x", s.OwnerAddress(), owner.Bytes())
+	}
+}
+
+// TestIdentifierAndOwner verifies that the id and the owner are read
+// back from a signed soc chunk.
+func TestIdentifierAndOwner(t *testing.T) {
+	privKey, err := crypto.GenerateSecp256k1Key()
+	if err != nil {
+		t.Fatal(err)
+	}
+	signer := crypto.NewDefaultSigner(privKey)
+	owner, err := signer.EthereumAddress()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	ch, err := cac.New([]byte("foo"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	id := make([]byte, soc.IdSize)
+	id[0] = 1
+	sch, err := soc.New(id, ch).Sign(signer)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	gotID, err := soc.Identifier(sch)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(gotID, id) {
+		t.Fatalf("id mismatch. got %x want %x", gotID, id)
+	}
+
+	gotOwner, err := soc.Owner(sch)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(gotOwner, owner.Bytes()) {
+		t.Fatalf("owner mismatch. got %x want %x", gotOwner, owner.Bytes())
+	}
+
+	t.Run("short chunk", func(t *testing.T) {
+		short := swarm.NewChunk(sch.Address(), sch.Data()[:soc.IdSize+soc.SignatureSize])
+		if _, err := soc.Identifier(short); !errors.Is(err, soc.ErrShortChunk) {
+			t.Fatalf("got error %v, want %v", err, soc.ErrShortChunk)
+		}
+		if _, err := soc.Owner(short); !errors.Is(err, soc.ErrShortChunk) {
+			t.Fatalf("got error %v, want %v", err, soc.ErrShortChunk)
+		}
+	})
+}
+
 // TestFromChunk verifies that valid chunk data deserializes to
 // a fully populated soc object.
 func TestFromChunk(t *testing.T) {
@@ -282,6 +695,102 @@ func TestFromChunk(t *testing.T) {
 	}
 }
 
+// TestRecoverOwner verifies that the public key of the signer is
+// recovered from a signed soc chunk.
+func TestRecoverOwner(t *testing.T) {
+	privKey, err := crypto.GenerateSecp256k1Key()
+	if err != nil {
+		t.Fatal(err)
+	}
+	signer := crypto.NewDefaultSigner(privKey)
+
+	ch, err := cac.New([]byte("foo"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	sch, err := soc.New(make([]byte, soc.IdSize), ch).Sign(signer)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	owner, err := soc.RecoverOwner(sch)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	want := crypto.EncodeSecp256k1PublicKey(&privKey.PublicKey)
+	if !bytes.Equal(owner, want) {
+		t.Fatalf("owner public key mismatch. got %x want %x", owner, want)
+	}
+
+	// the address derived from the compressed public key is the owner address
+	publicKey, err := crypto.DecodeSecp256k1PublicKey(owner)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ownerAddress, err := crypto.NewEthereumAddress(*publicKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	wantAddress, err := soc.Owner(sch)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(ownerAddress, wantAddress) {
+		t.Fatalf("owner address mismatch. got %x want %x", ownerAddress, wantAddress)
+	}
+
+	t.Run("short chunk", func(t *testing.T) {
+		short := swarm.NewChunk(sch.Address(), sch.Data()[:soc.IdSize])
+		if _, err := soc.RecoverOwner(short); err == nil {
+			t.Fatal("expected error")
+		}
+	})
+}
+
+// TestFromChunkRoundtrip verifies that a soc parsed from a signed chunk
+// serializes back to the identical chunk.
+func TestFromChunkRoundtrip(t *testing.T) {
+	privKey, err := crypto.GenerateSecp256k1Key()
+	if err != nil {
+		t.Fatal(err)
+	}
+	signer := crypto.NewDefaultSigner(privKey)
+
+	ch, err := cac.New([]byte("foo"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	id := make([]byte, soc.IdSize)
+	id[0] = 1
+	sch, err := soc.New(id, ch).Sign(signer)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	s, err := soc.FromChunk(sch)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if !bytes.Equal(s.ID(), id) {
+		t.Fatalf("id mismatch. got %x want %x", s.ID(), id)
+	}
+	if !ch.Equal(s.WrappedChunk()) {
+		t.Fatalf("wrapped chunk mismatch. got %s want %s", s.WrappedChunk().Address(), ch.Address())
+	}
+
+	rch, err := s.Chunk()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !rch.Equal(sch) {
+		t.Fatalf("chunk mismatch. got %s want %s", rch.Address(), sch.Address())
+	}
+}
+
 func TestCreateAddress(t *testing.T) {
 	id := make([]byte, soc.IdSize)
 	owner := common.HexToAddress("8d3766440f0d7b949a5e32995d09619a7f86e632")
@@ -296,6 +805,41 @@ func TestCreateAddress(t *testing.T) {
 	}
 }
 
+// TestCreateAddressMatchesSign verifies that the address computed from
+// the id and owner matches the address of the signed chunk.
+func TestCreateAddressMatchesSign(t *testing.T) {
+	privKey, err := crypto.GenerateSecp256k1Key()
+	if err != nil {
+		t.Fatal(err)
+	}
+	signer := crypto.NewDefaultSigner(privKey)
+
+	owner, err := signer.EthereumAddress()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	ch, err := cac.New([]byte("foo"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	id := make([]byte, soc.IdSize)
+	copy(id, "id")
+	sch, err := soc.New(id, ch).Sign(signer)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	addr, err := soc.CreateAddress(id, owner.Bytes())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !addr.Equal(sch.Address()) {
+		t.Fatalf("soc address mismatch. got %s want %s", addr, sch.Address())
+	}
+}
+
 func TestRecoverAddress(t *testing.T) {
 	owner := common.HexToAddress("8d3766440f0d7b949a5e32995d09619a7f86e632")
 	id := make([]byte, soc.IdSize)
@@ -319,3 +863,38 @@ func TestRecoverAddress(t *testing.T) {
 		t.Fatalf("owner address mismatch. got %x want %x", addr, owner.Bytes())
 	}
 }
+
+func BenchmarkSign(b *testing.B) {
+	privKey, err := crypto.GenerateSecp256k1Key()
+	if err != nil {
+		b.Fatal(err)
+	}
+	ch, err := cac.New([]byte("foo"))
+	if err != nil {
+		b.Fatal(err)
+	}
+	id := make([]byte, soc.IdSize)
+
+	for _, bc := range []struct {
+		name   string
+		signer crypto.Signer
+	}{
+		{
+			name:   "default signer",
+			signer: crypto.NewDefaultSigner(privKey),
+		},
+		{
+			name:   "caching signer",
+			signer: crypto.NewCachingSigner(privKey),
+		},
+	} {
+		b.Run(bc.name, func(b *testing.B) {
+			b.ReportAllocs()
+			for i := 0; i < b.N; i++ {
+				if _, err := soc.New(id, ch).Sign(bc.signer); err != nil {
+					b.Fatal(err)
+				}
+			}
+		})
+	}
+}
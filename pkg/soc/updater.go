@@ -0,0 +1,169 @@
+// Copyright 2021 The Swarm Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package soc
+
+import (
+	"encoding/binary"
+	"errors"
+	"time"
+
+	"github.com/ethersphere/bee/pkg/cac"
+	"github.com/ethersphere/bee/pkg/crypto"
+	"github.com/ethersphere/bee/pkg/swarm"
+)
+
+// TimestampSize is the size of the timestamp embedded by
+// Updater.UpdateWithTimestamp.
+const TimestampSize = 8
+
+var (
+	// ErrNoTimestamp is returned when the wrapped chunk payload is too short
+	// to hold a timestamp.
+	ErrNoTimestamp = errors.New("soc: no timestamp")
+	// ErrUpdateConflict is returned when the update at the index already
+	// exists.
+	ErrUpdateConflict = errors.New("soc: update already exists")
+)
+
+// Updater creates single-owner chunks with sequential ids derived
+// from a topic and an index.
+type Updater struct {
+	topic  []byte
+	signer crypto.Signer
+}
+
+// NewUpdater creates a new Updater for the topic which signs the chunks
+// with the signer.
+func NewUpdater(topic []byte, signer crypto.Signer) *Updater {
+	return &Updater{
+		topic:  topic,
+		signer: signer,
+	}
+}
+
+// Update creates a signed single-owner chunk wrapping the data with the id
+// derived from the topic and the index.
+func (u *Updater) Update(index uint64, data []byte) (swarm.Chunk, error) {
+	id, err := UpdateID(u.topic, index)
+	if err != nil {
+		return nil, err
+	}
+
+	ch, err := cac.New(data)
+	if err != nil {
+		return nil, err
+	}
+
+	return New(id, ch).Sign(u.signer)
+}
+
+// UpdateIfAbsent creates a signed single-owner chunk like Update, but only if
+// the exists function reports that there is no chunk at its address yet. It
+// returns ErrUpdateConflict otherwise. The address is derived from the id and
+// the owner, so it is checked before the chunk is signed. The check and the
+// following upload of the chunk are not atomic, so concurrent writers can
+// still both succeed if they check at the same time.
+func (u *Updater) UpdateIfAbsent(index uint64, data []byte, exists func(swarm.Address) (bool, error)) (swarm.Chunk, error) {
+	id, err := UpdateID(u.topic, index)
+	if err != nil {
+		return nil, err
+	}
+	owner, err := u.signer.EthereumAddress()
+	if err != nil {
+		return nil, err
+	}
+	addr, err := CreateAddress(id, owner.Bytes())
+	if err != nil {
+		return nil, err
+	}
+
+	found, err := exists(addr)
+	if err != nil {
+		return nil, err
+	}
+	if found {
+		return nil, ErrUpdateConflict
+	}
+
+	return u.Update(index, data)
+}
+
+// UpdateWithTimestamp creates a signed single-owner chunk like Update, but
+// prefixes the data with the current unix time in seconds. The timestamp is
+// part of the wrapped chunk payload, so the chunk layout is
+//
+//	id (32) | signature (65) | span (8) | timestamp (8) | data
+//
+// where the span is an 8-byte little-endian uint64 which covers both the
+// timestamp and the data, and the timestamp is an 8-byte big-endian uint64
+// unix time in seconds. Validation is not affected by the timestamp as it
+// is signed as part of the wrapped chunk.
+func (u *Updater) UpdateWithTimestamp(index uint64, data []byte) (swarm.Chunk, error) {
+	payload := make([]byte, TimestampSize+len(data))
+	binary.BigEndian.PutUint64(payload, uint64(time.Now().Unix()))
+	copy(payload[TimestampSize:], data)
+	return u.Update(index, payload)
+}
+
+// Timestamp returns the timestamp of a single-owner chunk created with
+// Updater.UpdateWithTimestamp, the first TimestampSize bytes of the wrapped
+// chunk payload. It does not verify the signature of the chunk and it can
+// not tell apart chunks without a timestamp whose payload is long enough.
+func Timestamp(ch swarm.Chunk) (uint64, error) {
+	s, err := parse(ch)
+	if err != nil {
+		return 0, err
+	}
+	payload := s.chunk.Data()[swarm.SpanSize:]
+	if len(payload) < TimestampSize {
+		return 0, ErrNoTimestamp
+	}
+	return binary.BigEndian.Uint64(payload), nil
+}
+
+// UpdateID returns the id of the update at the index, the keccak256
+// hash of topic || index, where the index is encoded as big-endian uint64.
+func UpdateID(topic []byte, index uint64) (ID, error) {
+	indexBytes := make([]byte, 8)
+	binary.BigEndian.PutUint64(indexBytes, index)
+	return hash(topic, indexBytes)
+}
+
+// FeedCandidates returns the addresses of the count updates of the owner under
+// the topic which follow the update at the index after, in the order of their
+// indices, so that a lookup of the latest update can probe them. It returns
+// nil if the owner is not an ethereum address. Indices past the maximal index
+// are not returned.
+func FeedCandidates(topic, owner []byte, after uint64, count int) []swarm.Address {
+	if len(owner) != crypto.AddressSize {
+		return nil
+	}
+	if count < 0 {
+		count = 0
+	}
+	addrs := make([]swarm.Address, 0, count)
+	for index := after + 1; len(addrs) < count && index > after; index++ {
+		id, err := UpdateID(topic, index)
+		if err != nil {
+			return nil
+		}
+		addr, err := CreateAddress(id, owner)
+		if err != nil {
+			return nil
+		}
+		addrs = append(addrs, addr)
+	}
+	return addrs
+}
+
+// ResourceID returns the id of the single-value resource of the owner under
+// the topic, the keccak256 hash of topic || owner. The address of the
+// resource chunk is CreateAddress(id, owner).
+func ResourceID(topic, owner []byte) (ID, error) {
+	if len(owner) != crypto.AddressSize {
+		return nil, errInvalidAddress
+	}
+	return hash(topic, owner)
+}
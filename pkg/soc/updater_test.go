@@ -0,0 +1,231 @@
+// Copyright 2021 The Swarm Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package soc_test
+
+import (
+	"bytes"
+	"encoding/hex"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/ethersphere/bee/pkg/crypto"
+	"github.com/ethersphere/bee/pkg/soc"
+	"github.com/ethersphere/bee/pkg/swarm"
+)
+
+func TestUpdater(t *testing.T) {
+	privKey, err := crypto.GenerateSecp256k1Key()
+	if err != nil {
+		t.Fatal(err)
+	}
+	signer := crypto.NewDefaultSigner(privKey)
+
+	owner, err := signer.EthereumAddress()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	topic := []byte("topic")
+	u := soc.NewUpdater(topic, signer)
+
+	updates := []struct {
+		index uint64
+		data  []byte
+		chunk swarm.Chunk
+	}{
+		{index: 0, data: []byte("foo")},
+		{index: 1, data: []byte("bar")},
+	}
+
+	for i, up := range updates {
+		ch, err := u.Update(up.index, up.data)
+		if err != nil {
+			t.Fatal(err)
+		}
+		updates[i].chunk = ch
+
+		if !soc.Valid(ch) {
+			t.Fatalf("update %d evaluates to invalid", up.index)
+		}
+
+		id, err := soc.UpdateID(topic, up.index)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		addr, err := soc.CreateAddress(id, owner.Bytes())
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !addr.Equal(ch.Address()) {
+			t.Fatalf("update %d address mismatch. got %s want %s", up.index, ch.Address(), addr)
+		}
+
+		s, err := soc.FromChunk(ch)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if payload := s.WrappedChunk().Data()[swarm.SpanSize:]; !bytes.Equal(payload, up.data) {
+			t.Fatalf("update %d payload mismatch. got %q want %q", up.index, payload, up.data)
+		}
+	}
+
+	if updates[0].chunk.Address().Equal(updates[1].chunk.Address()) {
+		t.Fatalf("updates with different indices have the same address %s", updates[0].chunk.Address())
+	}
+}
+
+func TestUpdaterUpdateIfAbsent(t *testing.T) {
+	privKey, err := crypto.GenerateSecp256k1Key()
+	if err != nil {
+		t.Fatal(err)
+	}
+	u := soc.NewUpdater([]byte("topic"), crypto.NewDefaultSigner(privKey))
+
+	stored := make(map[string]bool)
+	exists := func(addr swarm.Address) (bool, error) {
+		return stored[addr.ByteString()], nil
+	}
+
+	// free slot
+	ch, err := u.UpdateIfAbsent(0, []byte("foo"), exists)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !soc.Valid(ch) {
+		t.Fatal("update evaluates to invalid")
+	}
+	stored[ch.Address().ByteString()] = true
+
+	// the same index with different data
+	if _, err := u.UpdateIfAbsent(0, []byte("bar"), exists); !errors.Is(err, soc.ErrUpdateConflict) {
+		t.Fatalf("got error %v, want %v", err, soc.ErrUpdateConflict)
+	}
+
+	// the next index is free
+	if _, err := u.UpdateIfAbsent(1, []byte("bar"), exists); err != nil {
+		t.Fatal(err)
+	}
+
+	// errors of the exists function are returned
+	testErr := errors.New("test error")
+	_, err = u.UpdateIfAbsent(2, []byte("baz"), func(swarm.Address) (bool, error) {
+		return false, testErr
+	})
+	if !errors.Is(err, testErr) {
+		t.Fatalf("got error %v, want %v", err, testErr)
+	}
+}
+
+func TestUpdaterWithTimestamp(t *testing.T) {
+	privKey, err := crypto.GenerateSecp256k1Key()
+	if err != nil {
+		t.Fatal(err)
+	}
+	u := soc.NewUpdater([]byte("topic"), crypto.NewDefaultSigner(privKey))
+
+	var last uint64
+	for index := uint64(0); index < 2; index++ {
+		start := uint64(time.Now().Unix())
+		ch, err := u.UpdateWithTimestamp(index, []byte("foo"))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !soc.Valid(ch) {
+			t.Fatalf("update %d evaluates to invalid", index)
+		}
+
+		ts, err := soc.Timestamp(ch)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if ts < start || ts < last {
+			t.Fatalf("update %d timestamp %d is not monotonic, previous %d, start %d", index, ts, last, start)
+		}
+		last = ts
+
+		s, err := soc.FromChunk(ch)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if payload := s.WrappedChunk().Data()[swarm.SpanSize+soc.TimestampSize:]; !bytes.Equal(payload, []byte("foo")) {
+			t.Fatalf("update %d payload mismatch. got %q want %q", index, payload, "foo")
+		}
+	}
+
+	ch, err := u.Update(2, []byte("bar"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := soc.Timestamp(ch); !errors.Is(err, soc.ErrNoTimestamp) {
+		t.Fatalf("got error %v, want %v", err, soc.ErrNoTimestamp)
+	}
+}
+
+func TestResourceID(t *testing.T) {
+	owner, err := hex.DecodeString("8d3766440f0d7b949a5e32995d09619a7f86e632")
+	if err != nil {
+		t.Fatal(err)
+	}
+	topic := []byte("topic")
+
+	id, err := soc.ResourceID(topic, owner)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(id) != soc.IdSize {
+		t.Fatalf("got id length %d, want %d", len(id), soc.IdSize)
+	}
+
+	addr, err := soc.CreateAddress(id, owner)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := swarm.MustParseHexAddress("2328e775b8e851b8633f600f559269358c90fe788629d5f99ace76e48c1b49e0")
+	if !addr.Equal(want) {
+		t.Fatalf("got address %s, want %s", addr, want)
+	}
+
+	if _, err := soc.ResourceID(topic, owner[1:]); err == nil {
+		t.Fatal("expected error for invalid owner length")
+	}
+}
+
+func TestFeedCandidates(t *testing.T) {
+	owner, err := hex.DecodeString("8d3766440f0d7b949a5e32995d09619a7f86e632")
+	if err != nil {
+		t.Fatal(err)
+	}
+	topic := []byte("topic")
+
+	got := soc.FeedCandidates(topic, owner, 5, 3)
+	if len(got) != 3 {
+		t.Fatalf("got %d candidates, want 3", len(got))
+	}
+	for i, index := range []uint64{6, 7, 8} {
+		id, err := soc.UpdateID(topic, index)
+		if err != nil {
+			t.Fatal(err)
+		}
+		want, err := soc.CreateAddress(id, owner)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !got[i].Equal(want) {
+			t.Fatalf("got candidate %s at %d, want the address of index %d %s", got[i], i, index, want)
+		}
+	}
+
+	if got := soc.FeedCandidates(topic, owner, 5, 0); len(got) != 0 {
+		t.Fatalf("got %d candidates, want none", len(got))
+	}
+	if got := soc.FeedCandidates(topic, owner, ^uint64(0)-1, 3); len(got) != 1 {
+		t.Fatalf("got %d candidates before the maximal index, want 1", len(got))
+	}
+	if got := soc.FeedCandidates(topic, owner[1:], 5, 3); got != nil {
+		t.Fatalf("got candidates %v for invalid owner, want nil", got)
+	}
+}
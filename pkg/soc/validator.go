@@ -5,19 +5,118 @@
 package soc
 
 import (
+	"bytes"
+	"encoding/binary"
+	stdhash "hash"
+
+	"github.com/ethersphere/bee/pkg/crypto"
 	"github.com/ethersphere/bee/pkg/swarm"
 )
 
 // Valid checks if the chunk is a valid single-owner chunk.
 func Valid(ch swarm.Chunk) bool {
-	s, err := FromChunk(ch)
+	return Validate(ch) == nil
+}
+
+// Validate checks if the chunk is a valid single-owner chunk and returns
+// the reason if it is not.
+func Validate(ch swarm.Chunk) error {
+	return validate(ch, swarm.NewHasher())
+}
+
+// ValidWithHasher checks if the chunk is a valid single-owner chunk created
+// with the hasher factory f.
+func ValidWithHasher(ch swarm.Chunk, f HasherFactory) bool {
+	return ValidateWithHasher(ch, f) == nil
+}
+
+// ValidateWithHasher checks if the chunk is a valid single-owner chunk created
+// with the hasher factory f and returns the reason if it is not.
+func ValidateWithHasher(ch swarm.Chunk, f HasherFactory) error {
+	return validate(ch, f())
+}
+
+// ValidWithOwner checks if the chunk is a valid single-owner chunk signed by
+// the expected owner.
+func ValidWithOwner(ch swarm.Chunk, expectedOwner []byte) bool {
+	return ValidateWithOwner(ch, expectedOwner) == nil
+}
+
+// ValidateWithOwner checks if the chunk is a valid single-owner chunk signed
+// by the expected owner, the ethereum address in bytes, and returns the reason
+// if it is not. ErrUnexpectedOwner is returned for chunks which are valid but
+// signed by another owner.
+func ValidateWithOwner(ch swarm.Chunk, expectedOwner []byte) error {
+	s, err := validated(ch, swarm.NewHasher())
 	if err != nil {
-		return false
+		return err
+	}
+	if !bytes.Equal(s.owner, expectedOwner) {
+		return ErrUnexpectedOwner
 	}
+	return nil
+}
 
-	address, err := s.address()
+// ValidAddress checks if the chunk address is the single-owner chunk address
+// of its id and the given owner. The owner is not recovered from the signature
+// and the wrapped chunk is not checked, so it is not a security check. It is
+// meant as a cheap first-pass filter when the owner is already known, for
+// example for bulk existence checks, and chunks received from the network
+// must still be checked with Valid or ValidWithOwner.
+func ValidAddress(ch swarm.Chunk, owner []byte) bool {
+	id, err := Identifier(ch)
+	if err != nil {
+		return false
+	}
+	address, err := CreateAddress(id, owner)
 	if err != nil {
 		return false
 	}
 	return ch.Address().Equal(address)
 }
+
+// ValidateBatch validates the single-owner chunks reusing a single hasher
+// across the batch. The error at index i is the result of Validate for the
+// chunk at index i.
+func ValidateBatch(chunks []swarm.Chunk) []error {
+	h := swarm.NewHasher()
+	errs := make([]error, len(chunks))
+	for i, ch := range chunks {
+		errs[i] = validate(ch, h)
+	}
+	return errs
+}
+
+// validate validates the single-owner chunk using the provided hasher.
+func validate(ch swarm.Chunk, h stdhash.Hash) error {
+	_, err := validated(ch, h)
+	return err
+}
+
+// validated validates the single-owner chunk using the provided hasher and
+// returns it with the recovered owner.
+func validated(ch swarm.Chunk, h stdhash.Hash) (*SOC, error) {
+	s, err := fromChunk(ch, h)
+	if err != nil {
+		return nil, err
+	}
+
+	// the span of intermediate chunks covers the whole subtree, so only a
+	// span shorter than the payload is invalid
+	data := s.chunk.Data()
+	if binary.LittleEndian.Uint64(data[:swarm.SpanSize]) < uint64(len(data)-swarm.SpanSize) {
+		return nil, ErrInvalidSpan
+	}
+
+	if len(s.owner) != crypto.AddressSize {
+		return nil, errInvalidAddress
+	}
+	address, err := createAddress(s.id, s.owner, h)
+	if err != nil {
+		return nil, err
+	}
+	if !ch.Address().Equal(address) {
+		return nil, ErrAddressMismatch
+	}
+	return s, nil
+}
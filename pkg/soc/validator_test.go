@@ -5,9 +5,16 @@
 package soc_test
 
 import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"math/big"
 	"strings"
 	"testing"
 
+	"github.com/btcsuite/btcd/btcec"
+	"github.com/ethersphere/bee/pkg/cac"
+	"github.com/ethersphere/bee/pkg/crypto"
 	"github.com/ethersphere/bee/pkg/soc"
 	"github.com/ethersphere/bee/pkg/swarm"
 )
@@ -29,6 +36,35 @@ func TestValid(t *testing.T) {
 	}
 }
 
+// TestValidIntermediateChunk verifies that the validator accepts chunks
+// wrapping an intermediate chunk, whose span is the length of the data of
+// the whole subtree and not of its payload.
+func TestValidIntermediateChunk(t *testing.T) {
+	privKey, err := crypto.GenerateSecp256k1Key()
+	if err != nil {
+		t.Fatal(err)
+	}
+	signer := crypto.NewDefaultSigner(privKey)
+
+	// an intermediate chunk with the references of two full data chunks
+	payload := make([]byte, 2*swarm.HashSize)
+	data := make([]byte, swarm.SpanSize, swarm.SpanSize+len(payload))
+	binary.LittleEndian.PutUint64(data, 2*swarm.ChunkSize)
+	data = append(data, payload...)
+	ch, err := cac.NewWithDataSpan(data)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	sch, err := soc.New(make([]byte, soc.IdSize), ch).Sign(signer)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := soc.Validate(sch); err != nil {
+		t.Fatal(err)
+	}
+}
+
 // TestInvalid verifies that the validator can detect chunks
 // with invalid data and invalid address.
 func TestInvalid(t *testing.T) {
@@ -43,15 +79,20 @@ func TestInvalid(t *testing.T) {
 	for _, c := range []struct {
 		name  string
 		chunk func() swarm.Chunk
+		err   error
 	}{
 		{
 			name: "wrong soc address",
 			chunk: func() swarm.Chunk {
-				wrongAddressBytes := sch.Address().Bytes()
+				wrongAddressBytes := append([]byte(nil), sch.Address().Bytes()...)
 				wrongAddressBytes[0] = 255 - wrongAddressBytes[0]
-				wrongAddress := swarm.NewAddress(wrongAddressBytes)
+				wrongAddress, err := swarm.NewValidatedAddress(wrongAddressBytes)
+				if err != nil {
+					t.Fatal(err)
+				}
 				return swarm.NewChunk(wrongAddress, sch.Data())
 			},
+			err: soc.ErrAddressMismatch,
 		},
 		{
 			name: "invalid data",
@@ -63,6 +104,19 @@ func TestInvalid(t *testing.T) {
 				chunkData[0] = 0x01
 				return swarm.NewChunk(socAddress, data)
 			},
+			err: soc.ErrInvalidSpan,
+		},
+		{
+			name: "invalid span",
+			chunk: func() swarm.Chunk {
+				data := make([]byte, len(sch.Data()))
+				copy(data, sch.Data())
+				cursor := soc.IdSize + soc.SignatureSize
+				span := data[cursor : cursor+swarm.SpanSize]
+				binary.LittleEndian.PutUint64(span, binary.LittleEndian.Uint64(span)-1)
+				return swarm.NewChunk(socAddress, data)
+			},
+			err: soc.ErrInvalidSpan,
 		},
 		{
 			name: "invalid id",
@@ -73,6 +127,7 @@ func TestInvalid(t *testing.T) {
 				id[0] = 0x01
 				return swarm.NewChunk(socAddress, data)
 			},
+			err: soc.ErrAddressMismatch,
 		},
 		{
 			name: "invalid signature",
@@ -85,18 +140,46 @@ func TestInvalid(t *testing.T) {
 				sig[0] = 0x01
 				return swarm.NewChunk(socAddress, data)
 			},
+			err: soc.ErrInvalidSignature,
+		},
+		{
+			name: "high s signature",
+			chunk: func() swarm.Chunk {
+				data := make([]byte, len(sch.Data()))
+				copy(data, sch.Data())
+				// replace the signature with its malleated form, (r, n-s)
+				// with the flipped recovery id, which recovers the same owner
+				sig := data[soc.IdSize : soc.IdSize+soc.SignatureSize]
+				n := btcec.S256().N
+				new(big.Int).Sub(n, new(big.Int).SetBytes(sig[32:64])).FillBytes(sig[32:64])
+				sig[64] = 27 + ((sig[64] - 27) ^ 1)
+				return swarm.NewChunk(socAddress, data)
+			},
+			err: soc.ErrInvalidSignature,
+		},
+		{
+			name: "unknown signature scheme",
+			chunk: func() swarm.Chunk {
+				data := make([]byte, len(sch.Data()))
+				copy(data, sch.Data())
+				data[soc.IdSize+soc.SignatureSize-1] = 0x01
+				return swarm.NewChunk(socAddress, data)
+			},
+			err: soc.ErrUnknownSignatureScheme,
 		},
 		{
 			name: "nil data",
 			chunk: func() swarm.Chunk {
 				return swarm.NewChunk(socAddress, nil)
 			},
+			err: soc.ErrShortChunk,
 		},
 		{
 			name: "small data",
 			chunk: func() swarm.Chunk {
 				return swarm.NewChunk(socAddress, []byte("small"))
 			},
+			err: soc.ErrShortChunk,
 		},
 		{
 			name: "large data",
@@ -106,9 +189,199 @@ func TestInvalid(t *testing.T) {
 		},
 	} {
 		t.Run(c.name, func(t *testing.T) {
-			if soc.Valid(c.chunk()) {
+			ch := c.chunk()
+			if soc.Valid(ch) {
 				t.Fatal("chunk with invalid data evaluates to valid")
 			}
+			if c.err == nil {
+				return
+			}
+			if err := soc.Validate(ch); !errors.Is(err, c.err) {
+				t.Fatalf("got error %v, want %v", err, c.err)
+			}
 		})
 	}
 }
+
+// TestValidateBatch verifies that the batch validation returns the same
+// results as validating each chunk individually.
+func TestValidateBatch(t *testing.T) {
+	chunks := newUpdateChunks(t, 4)
+
+	wrongAddress := append([]byte(nil), chunks[1].Address().Bytes()...)
+	wrongAddress[0] = 255 - wrongAddress[0]
+	chunks = append(chunks,
+		swarm.NewChunk(swarm.NewAddress(wrongAddress), chunks[1].Data()),
+		swarm.NewChunk(chunks[2].Address(), []byte("small")),
+		swarm.NewChunk(chunks[3].Address(), nil),
+	)
+
+	errs := soc.ValidateBatch(chunks)
+	if len(errs) != len(chunks) {
+		t.Fatalf("got %d errors, want %d", len(errs), len(chunks))
+	}
+	for i, ch := range chunks {
+		if want := soc.Validate(ch); !errors.Is(errs[i], want) {
+			t.Fatalf("chunk %d: got error %v, want %v", i, errs[i], want)
+		}
+	}
+	for i, err := range errs[:4] {
+		if err != nil {
+			t.Fatalf("chunk %d: unexpected error %v", i, err)
+		}
+	}
+}
+
+// TestValidateWithOwner verifies that the validator accepts only valid chunks
+// signed by the expected owner.
+func TestValidateWithOwner(t *testing.T) {
+	privKey, err := crypto.GenerateSecp256k1Key()
+	if err != nil {
+		t.Fatal(err)
+	}
+	signer := crypto.NewDefaultSigner(privKey)
+	owner, err := signer.EthereumAddress()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	otherPrivKey, err := crypto.GenerateSecp256k1Key()
+	if err != nil {
+		t.Fatal(err)
+	}
+	otherOwner, err := crypto.NewDefaultSigner(otherPrivKey).EthereumAddress()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	ch, err := soc.NewUpdater([]byte("topic"), signer).Update(0, []byte("foo"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	t.Run("matching owner", func(t *testing.T) {
+		if err := soc.ValidateWithOwner(ch, owner.Bytes()); err != nil {
+			t.Fatal(err)
+		}
+		if !soc.ValidWithOwner(ch, owner.Bytes()) {
+			t.Fatal("chunk signed by the expected owner evaluates to invalid")
+		}
+	})
+
+	t.Run("mismatching owner", func(t *testing.T) {
+		if err := soc.ValidateWithOwner(ch, otherOwner.Bytes()); !errors.Is(err, soc.ErrUnexpectedOwner) {
+			t.Fatalf("got error %v, want %v", err, soc.ErrUnexpectedOwner)
+		}
+		if soc.ValidWithOwner(ch, otherOwner.Bytes()) {
+			t.Fatal("chunk signed by another owner evaluates to valid")
+		}
+	})
+
+	t.Run("invalid chunk", func(t *testing.T) {
+		invalid := swarm.NewChunk(ch.Address(), []byte("small"))
+		if err := soc.ValidateWithOwner(invalid, owner.Bytes()); !errors.Is(err, soc.ErrShortChunk) {
+			t.Fatalf("got error %v, want %v", err, soc.ErrShortChunk)
+		}
+	})
+}
+
+// TestValidAddress verifies that the address check accepts the chunk only
+// with the owner it was signed by.
+func TestValidAddress(t *testing.T) {
+	privKey, err := crypto.GenerateSecp256k1Key()
+	if err != nil {
+		t.Fatal(err)
+	}
+	signer := crypto.NewDefaultSigner(privKey)
+	owner, err := signer.EthereumAddress()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	ch, err := soc.NewUpdater([]byte("topic"), signer).Update(0, []byte("foo"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if !soc.ValidAddress(ch, owner.Bytes()) {
+		t.Fatal("chunk address evaluates to invalid")
+	}
+
+	otherOwner := append([]byte(nil), owner.Bytes()...)
+	otherOwner[0] = 255 - otherOwner[0]
+	if soc.ValidAddress(ch, otherOwner) {
+		t.Fatal("chunk address with another owner evaluates to valid")
+	}
+
+	if soc.ValidAddress(ch, owner.Bytes()[1:]) {
+		t.Fatal("chunk address with short owner evaluates to valid")
+	}
+
+	if soc.ValidAddress(swarm.NewChunk(ch.Address(), []byte("small")), owner.Bytes()) {
+		t.Fatal("short chunk evaluates to valid")
+	}
+}
+
+func BenchmarkValidAddress(b *testing.B) {
+	chunks := newUpdateChunks(b, 100)
+	owner, err := soc.Owner(chunks[0])
+	if err != nil {
+		b.Fatal(err)
+	}
+
+	b.ResetTimer()
+	for n := 0; n < b.N; n++ {
+		for _, ch := range chunks {
+			if !soc.ValidAddress(ch, owner) {
+				b.Fatal("invalid chunk address")
+			}
+		}
+	}
+}
+
+func BenchmarkValidate(b *testing.B) {
+	chunks := newUpdateChunks(b, 100)
+
+	b.ResetTimer()
+	for n := 0; n < b.N; n++ {
+		for _, ch := range chunks {
+			if err := soc.Validate(ch); err != nil {
+				b.Fatal(err)
+			}
+		}
+	}
+}
+
+func BenchmarkValidateBatch(b *testing.B) {
+	chunks := newUpdateChunks(b, 100)
+
+	b.ResetTimer()
+	for n := 0; n < b.N; n++ {
+		for _, err := range soc.ValidateBatch(chunks) {
+			if err != nil {
+				b.Fatal(err)
+			}
+		}
+	}
+}
+
+// newUpdateChunks creates count valid single-owner chunks signed by the same
+// owner.
+func newUpdateChunks(tb testing.TB, count int) []swarm.Chunk {
+	tb.Helper()
+
+	privKey, err := crypto.GenerateSecp256k1Key()
+	if err != nil {
+		tb.Fatal(err)
+	}
+	u := soc.NewUpdater([]byte("topic"), crypto.NewDefaultSigner(privKey))
+
+	chunks := make([]swarm.Chunk, count)
+	for i := range chunks {
+		chunks[i], err = u.Update(uint64(i), []byte(fmt.Sprintf("data %d", i)))
+		if err != nil {
+			tb.Fatal(err)
+		}
+	}
+	return chunks
+}
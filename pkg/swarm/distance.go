@@ -57,3 +57,17 @@ func DistanceCmp(a, x, y []byte) (int, error) {
 	}
 	return 0, nil
 }
+
+// DistanceTo returns the distance between the address and the other address,
+// as defined by Distance. It can be used to break ties between addresses in
+// the same proximity order bin.
+func (a Address) DistanceTo(other Address) (*big.Int, error) {
+	return Distance(a.b, other.b)
+}
+
+// Closer compares x and y to the address, as defined by DistanceCmp. It
+// returns 1 if x is closer to the address, -1 if y is closer and 0 if they
+// are equidistant, which in the xor metric means that x and y are equal.
+func (a Address) Closer(x, y Address) (int, error) {
+	return DistanceCmp(a.b, x.b, y.b)
+}
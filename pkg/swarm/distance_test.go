@@ -77,3 +77,47 @@ func TestDistanceCmp(t *testing.T) {
 		}
 	}
 }
+
+func TestAddressDistanceTo(t *testing.T) {
+	for _, dt := range distanceTests {
+		distance, err := NewAddress(dt.x).DistanceTo(NewAddress(dt.y))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if distance.String() != dt.result {
+			t.Fatalf("incorrect distance, expected %s, got %s (x: %x, y: %x)", dt.result, distance.String(), dt.x, dt.y)
+		}
+	}
+
+	if _, err := MustParseHexAddress("91").DistanceTo(MustParseHexAddress("9182")); err == nil {
+		t.Fatal("expected error for addresses of different length")
+	}
+}
+
+func TestAddressCloser(t *testing.T) {
+	for _, dt := range distanceCmpTests {
+		direction, err := NewAddress(dt.a).Closer(NewAddress(dt.x), NewAddress(dt.y))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if direction != dt.result {
+			t.Fatalf("incorrect distance compare, expected %d, got %d (a: %x, x: %x, y: %x)", dt.result, direction, dt.a, dt.x, dt.y)
+		}
+	}
+
+	// x and y are in the same proximity order bin of the target, so only the
+	// full distance tells which one is closer
+	target := MustParseHexAddress("f000")
+	x := MustParseHexAddress("8001")
+	y := MustParseHexAddress("8100")
+	if px, py := target.ProximityTo(x), target.ProximityTo(y); px != py {
+		t.Fatalf("got proximity orders %d and %d, want equal", px, py)
+	}
+	if direction, err := target.Closer(x, y); err != nil || direction != 1 {
+		t.Fatalf("got %d, %v, want 1", direction, err)
+	}
+
+	if _, err := target.Closer(x, MustParseHexAddress("80")); err == nil {
+		t.Fatal("expected error for addresses of different length")
+	}
+}
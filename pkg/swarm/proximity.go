@@ -37,6 +37,26 @@ func Proximity(one, other []byte) (ret uint8) {
 	return MaxPO
 }
 
+// ProximityTo returns the proximity order between the address and the
+// other address, as defined by Proximity.
+func (a Address) ProximityTo(other Address) uint8 {
+	return Proximity(a.b, other.b)
+}
+
+// Bin returns the value of the first depth bits of the address, the most
+// significant bits of its first byte, as the low bits of a byte. It can be
+// used as a bucket key of peers. The depth is limited to 8 and an empty
+// address is in bin 0.
+func (a Address) Bin(depth uint8) uint8 {
+	if len(a.b) == 0 || depth == 0 {
+		return 0
+	}
+	if depth > 8 {
+		depth = 8
+	}
+	return a.b[0] >> (8 - depth)
+}
+
 func ExtendedProximity(one, other []byte) (ret uint8) {
 	b := ExtendedPO/8 + 1
 	if l := uint8(len(one)); b > l {
@@ -195,3 +195,23 @@ func TestProximity(t *testing.T) {
 		}
 	}
 }
+
+func TestAddressProximityTo(t *testing.T) {
+	a := MustParseHexAddress("ca1e9f3938cc1425c6061b96ad9eb93e134dfe8734ad490164ef20af9d1cf59c")
+
+	if got := a.ProximityTo(a); got != MaxPO {
+		t.Errorf("got %v bin for identical addresses, want %v", got, MaxPO)
+	}
+
+	b := NewAddress(append([]byte(nil), a.Bytes()...))
+	b.b[0] ^= 0b10000000
+	if got := a.ProximityTo(b); got != 0 {
+		t.Errorf("got %v bin for addresses differing in the first bit, want %v", got, 0)
+	}
+
+	c := NewAddress(append([]byte(nil), a.Bytes()...))
+	c.b[1] ^= 0b00000001
+	if got := a.ProximityTo(c); got != 15 {
+		t.Errorf("got %v bin, want %v", got, 15)
+	}
+}
@@ -36,6 +36,15 @@ var (
 
 var (
 	ErrInvalidChunk = errors.New("invalid chunk")
+	// ErrInvalidAddress is returned if the address can not be parsed from
+	// its hex-encoded representation.
+	ErrInvalidAddress = errors.New("invalid address")
+	// ErrInvalidAddressLength is returned if the address is not HashSize
+	// bytes long.
+	ErrInvalidAddressLength = errors.New("invalid address length")
+	// ErrChunkTooLarge is returned if the chunk data is longer than
+	// ChunkWithSpanSize bytes.
+	ErrChunkTooLarge = errors.New("chunk too large")
 )
 
 // Address represents an address in Swarm metric space of
@@ -49,15 +58,44 @@ func NewAddress(b []byte) Address {
 	return Address{b: b}
 }
 
+// NewValidatedAddress constructs Address from a byte slice, returning
+// ErrInvalidAddressLength if it is not HashSize bytes long. It should be used
+// for addresses received from outside, while NewAddress is meant for
+// addresses that are known to be valid.
+func NewValidatedAddress(b []byte) (Address, error) {
+	if len(b) != HashSize {
+		return Address{}, fmt.Errorf("%w: got %d bytes, want %d", ErrInvalidAddressLength, len(b), HashSize)
+	}
+	return NewAddress(b), nil
+}
+
 // ParseHexAddress returns an Address from a hex-encoded string representation.
+// It returns ErrInvalidAddress if the string is not valid hex. Addresses of any
+// length are accepted, as both plain and encrypted references are parsed.
 func ParseHexAddress(s string) (a Address, err error) {
 	b, err := hex.DecodeString(s)
 	if err != nil {
-		return a, err
+		return a, fmt.Errorf("%w: %v", ErrInvalidAddress, err)
 	}
 	return NewAddress(b), nil
 }
 
+// ParseHexValidatedAddress returns an Address from a hex-encoded string
+// representation of exactly HashSize bytes. It returns ErrInvalidAddress if the
+// string is not valid hex or decodes to an address of a different length, and
+// should be used for user-supplied addresses that can not be encrypted
+// references.
+func ParseHexValidatedAddress(s string) (a Address, err error) {
+	a, err = ParseHexAddress(s)
+	if err != nil {
+		return Address{}, err
+	}
+	if len(a.b) != HashSize {
+		return Address{}, fmt.Errorf("%w: got %d bytes, want %d", ErrInvalidAddress, len(a.b), HashSize)
+	}
+	return a, nil
+}
+
 // MustParseHexAddress returns an Address from a hex-encoded string
 // representation, and panics if there is a parse error.
 func MustParseHexAddress(s string) Address {
@@ -78,6 +116,12 @@ func (a Address) Equal(b Address) bool {
 	return bytes.Equal(a.b, b.b)
 }
 
+// Compare returns an integer comparing two addresses lexicographically.
+// The result will be 0 if a == b, -1 if a < b, and +1 if a > b.
+func (a Address) Compare(b Address) int {
+	return bytes.Compare(a.b, b.b)
+}
+
 // MemberOf returns true if the address is a member of the
 // provided set.
 func (a Address) MemberOf(addrs []Address) bool {
@@ -119,6 +163,17 @@ func (a Address) MarshalJSON() ([]byte, error) {
 	return json.Marshal(a.String())
 }
 
+// MarshalText returns the hex-encoded representation of Address.
+func (a Address) MarshalText() ([]byte, error) {
+	return []byte(a.String()), nil
+}
+
+// UnmarshalText sets Address to a value from the hex-encoded representation.
+func (a *Address) UnmarshalText(text []byte) (err error) {
+	*a, err = ParseHexAddress(string(text))
+	return err
+}
+
 // ZeroAddress is the address that has no value.
 var ZeroAddress = NewAddress(nil)
 
@@ -146,6 +201,9 @@ type Chunk interface {
 	WithBatch(radius, depth uint8) Chunk
 	// Equal checks if the chunk is equal to another.
 	Equal(Chunk) bool
+	// Clone returns a deep copy of the chunk, so that changes to the data of
+	// one of the chunks do not affect the other.
+	Clone() Chunk
 }
 
 // Stamp interface for postage.Stamp to avoid circular dependency
@@ -172,6 +230,15 @@ func NewChunk(addr Address, data []byte) Chunk {
 	}
 }
 
+// NewValidChunk constructs a Chunk like NewChunk, returning ErrChunkTooLarge
+// if the data, the span and the payload, is longer than ChunkWithSpanSize.
+func NewValidChunk(addr Address, data []byte) (Chunk, error) {
+	if len(data) > ChunkWithSpanSize {
+		return nil, ErrChunkTooLarge
+	}
+	return NewChunk(addr, data), nil
+}
+
 func (c *chunk) WithTagID(t uint32) Chunk {
 	c.tagID = t
 	return c
@@ -219,3 +286,16 @@ func (c *chunk) String() string {
 func (c *chunk) Equal(cp Chunk) bool {
 	return c.Address().Equal(cp.Address()) && bytes.Equal(c.Data(), cp.Data())
 }
+
+// Clone copies the address and the data of the chunk. The stamp is shared,
+// as it is not modified after it is attached.
+func (c *chunk) Clone() Chunk {
+	return &chunk{
+		addr:   NewAddress(append([]byte(nil), c.addr.b...)),
+		sdata:  append([]byte(nil), c.sdata...),
+		tagID:  c.tagID,
+		stamp:  c.stamp,
+		radius: c.radius,
+		depth:  c.depth,
+	}
+}
@@ -5,7 +5,7 @@
 package swarm_test
 
 import (
-	"encoding/hex"
+	"bytes"
 	"encoding/json"
 	"errors"
 	"testing"
@@ -28,7 +28,17 @@ func TestAddress(t *testing.T) {
 		{
 			name:    "odd",
 			hex:     "0",
-			wantErr: hex.ErrLength,
+			wantErr: swarm.ErrInvalidAddress,
+		},
+		{
+			name:    "odd long",
+			hex:     "35a26b7bb6455cbabe7a0e05aafbd0b8b26feac843e3b9a649468d0ea37a12b",
+			wantErr: swarm.ErrInvalidAddress,
+		},
+		{
+			name:    "non hex",
+			hex:     "0x35",
+			wantErr: swarm.ErrInvalidAddress,
 		},
 		{
 			name: "zero",
@@ -64,6 +74,120 @@ func TestAddress(t *testing.T) {
 	}
 }
 
+func TestNewValidatedAddress(t *testing.T) {
+	for _, tc := range []struct {
+		name    string
+		size    int
+		wantErr error
+	}{
+		{
+			name:    "empty",
+			size:    0,
+			wantErr: swarm.ErrInvalidAddressLength,
+		},
+		{
+			name:    "under",
+			size:    swarm.HashSize - 12,
+			wantErr: swarm.ErrInvalidAddressLength,
+		},
+		{
+			name:    "over",
+			size:    swarm.HashSize + 1,
+			wantErr: swarm.ErrInvalidAddressLength,
+		},
+		{
+			name: "valid",
+			size: swarm.HashSize,
+		},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			b := bytes.Repeat([]byte{1}, tc.size)
+			a, err := swarm.NewValidatedAddress(b)
+			if !errors.Is(err, tc.wantErr) {
+				t.Fatalf("got error %v, want %v", err, tc.wantErr)
+			}
+			if err != nil {
+				if !a.IsZero() {
+					t.Fatalf("got address %v, want zero address", a)
+				}
+				return
+			}
+			if !bytes.Equal(a.Bytes(), b) {
+				t.Fatalf("got address %x, want %x", a.Bytes(), b)
+			}
+		})
+	}
+}
+
+func TestParseHexValidatedAddress(t *testing.T) {
+	for _, tc := range []struct {
+		name    string
+		hex     string
+		wantErr error
+	}{
+		{
+			name:    "blank",
+			hex:     "",
+			wantErr: swarm.ErrInvalidAddress,
+		},
+		{
+			name:    "odd",
+			hex:     "35a26b7bb6455cbabe7a0e05aafbd0b8b26feac843e3b9a649468d0ea37a12b",
+			wantErr: swarm.ErrInvalidAddress,
+		},
+		{
+			name:    "non hex",
+			hex:     "zz35a26b7bb6455cbabe7a0e05aafbd0b8b26feac843e3b9a649468d0ea37a12",
+			wantErr: swarm.ErrInvalidAddress,
+		},
+		{
+			name:    "short",
+			hex:     "24798dd5a470e927fa",
+			wantErr: swarm.ErrInvalidAddress,
+		},
+		{
+			name:    "long",
+			hex:     "35a26b7bb6455cbabe7a0e05aafbd0b8b26feac843e3b9a649468d0ea37a12b235a26b7bb6455cbabe7a0e05aafbd0b8b26feac843e3b9a649468d0ea37a12b2",
+			wantErr: swarm.ErrInvalidAddress,
+		},
+		{
+			name: "valid",
+			hex:  "35a26b7bb6455cbabe7a0e05aafbd0b8b26feac843e3b9a649468d0ea37a12b2",
+		},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			a, err := swarm.ParseHexValidatedAddress(tc.hex)
+			if !errors.Is(err, tc.wantErr) {
+				t.Fatalf("got error %v, want %v", err, tc.wantErr)
+			}
+			if err != nil {
+				if !a.IsZero() {
+					t.Fatalf("got address %v, want zero address", a)
+				}
+				return
+			}
+			if a.String() != tc.hex {
+				t.Fatalf("got address %v, want %v", a, tc.hex)
+			}
+		})
+	}
+}
+
+func TestMustParseHexAddress(t *testing.T) {
+	a := swarm.MustParseHexAddress("24798dd5a470e927fa")
+	if a.String() != "24798dd5a470e927fa" {
+		t.Fatalf("got address %v, want %v", a, "24798dd5a470e927fa")
+	}
+
+	defer func() {
+		err, ok := recover().(error)
+		if !ok || !errors.Is(err, swarm.ErrInvalidAddress) {
+			t.Fatalf("got panic %v, want %v", err, swarm.ErrInvalidAddress)
+		}
+	}()
+	swarm.MustParseHexAddress("xyz")
+}
+
 func TestAddress_jsonMarshalling(t *testing.T) {
 	a1 := swarm.MustParseHexAddress("24798dd5a470e927fa")
 
@@ -82,6 +206,63 @@ func TestAddress_jsonMarshalling(t *testing.T) {
 	}
 }
 
+func TestAddress_jsonMarshallingField(t *testing.T) {
+	type config struct {
+		Address swarm.Address   `json:"address"`
+		Peers   []swarm.Address `json:"peers"`
+	}
+
+	a := swarm.MustParseHexAddress("24798dd5a470e927fa")
+	c1 := config{
+		Address: a,
+		Peers:   []swarm.Address{a, swarm.ZeroAddress},
+	}
+
+	b, err := json.Marshal(c1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := `{"address":"24798dd5a470e927fa","peers":["24798dd5a470e927fa",""]}`
+	if string(b) != want {
+		t.Fatalf("got json %s, want %s", b, want)
+	}
+
+	var c2 config
+	if err := json.Unmarshal(b, &c2); err != nil {
+		t.Fatal(err)
+	}
+	if !c2.Address.Equal(a) {
+		t.Errorf("got address %v, want %v", c2.Address, a)
+	}
+	if len(c2.Peers) != 2 || !c2.Peers[0].Equal(a) || !c2.Peers[1].IsZero() {
+		t.Errorf("got peers %v, want %v", c2.Peers, c1.Peers)
+	}
+
+	if err := json.Unmarshal([]byte(`{"address":"xyz"}`), &c2); err == nil {
+		t.Error("expected error for invalid hex address")
+	}
+}
+
+func TestAddress_textMarshalling(t *testing.T) {
+	a1 := swarm.MustParseHexAddress("24798dd5a470e927fa")
+
+	text, err := a1.MarshalText()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(text) != a1.String() {
+		t.Fatalf("got text %s, want %s", text, a1)
+	}
+
+	var a2 swarm.Address
+	if err := a2.UnmarshalText(text); err != nil {
+		t.Fatal(err)
+	}
+	if !a1.Equal(a2) {
+		t.Error("unmarshalled address is not equal to the original")
+	}
+}
+
 func TestAddress_MemberOf(t *testing.T) {
 	a1 := swarm.MustParseHexAddress("24798dd5a470e927fa")
 	a2 := swarm.MustParseHexAddress("24798dd5a470e927fa")
@@ -99,3 +280,146 @@ func TestAddress_MemberOf(t *testing.T) {
 	}
 
 }
+
+func TestAddress_Bin(t *testing.T) {
+	a := swarm.NewAddress([]byte{0b10110100, 0xff})
+
+	for _, tc := range []struct {
+		depth uint8
+		want  uint8
+	}{
+		{depth: 0, want: 0},
+		{depth: 1, want: 0b1},
+		{depth: 3, want: 0b101},
+		{depth: 5, want: 0b10110},
+		{depth: 8, want: 0b10110100},
+		{depth: 9, want: 0b10110100},
+		{depth: swarm.MaxPO, want: 0b10110100},
+	} {
+		if got := a.Bin(tc.depth); got != tc.want {
+			t.Errorf("depth %d: got bin %08b, want %08b", tc.depth, got, tc.want)
+		}
+	}
+
+	if got := swarm.ZeroAddress.Bin(8); got != 0 {
+		t.Errorf("zero address: got bin %08b, want 0", got)
+	}
+}
+
+func TestAddress_Compare(t *testing.T) {
+	for _, tc := range []struct {
+		name string
+		a, b swarm.Address
+		want int
+	}{
+		{
+			name: "equal",
+			a:    swarm.MustParseHexAddress("24798dd5a470e927fa"),
+			b:    swarm.MustParseHexAddress("24798dd5a470e927fa"),
+			want: 0,
+		},
+		{
+			name: "less",
+			a:    swarm.MustParseHexAddress("24798dd5a470e927fa"),
+			b:    swarm.MustParseHexAddress("24798dd5a470e927fb"),
+			want: -1,
+		},
+		{
+			name: "greater",
+			a:    swarm.MustParseHexAddress("24798dd5a470e927fb"),
+			b:    swarm.MustParseHexAddress("24798dd5a470e927fa"),
+			want: 1,
+		},
+		{
+			name: "prefix",
+			a:    swarm.MustParseHexAddress("24798dd5"),
+			b:    swarm.MustParseHexAddress("24798dd5a470e927fa"),
+			want: -1,
+		},
+		{
+			name: "zero",
+			a:    swarm.ZeroAddress,
+			b:    swarm.NewAddress(nil),
+			want: 0,
+		},
+		{
+			name: "zero and non zero",
+			a:    swarm.ZeroAddress,
+			b:    swarm.MustParseHexAddress("00"),
+			want: -1,
+		},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			if got := tc.a.Compare(tc.b); got != tc.want {
+				t.Errorf("got %v, want %v", got, tc.want)
+			}
+			if got := tc.a.Equal(tc.b); got != (tc.want == 0) {
+				t.Errorf("got equal %v, want %v", got, tc.want == 0)
+			}
+		})
+	}
+}
+
+func TestNewValidChunk(t *testing.T) {
+	addr := swarm.MustParseHexAddress("24798dd5a470e927fa")
+
+	data := make([]byte, swarm.ChunkWithSpanSize)
+	ch, err := swarm.NewValidChunk(addr, data)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !ch.Equal(swarm.NewChunk(addr, data)) {
+		t.Fatal("valid chunk is not equal to the chunk created with NewChunk")
+	}
+
+	if _, err := swarm.NewValidChunk(addr, make([]byte, swarm.ChunkWithSpanSize+1)); !errors.Is(err, swarm.ErrChunkTooLarge) {
+		t.Fatalf("got error %v, want %v", err, swarm.ErrChunkTooLarge)
+	}
+}
+
+func TestChunk_WithTagID(t *testing.T) {
+	addr := swarm.MustParseHexAddress("24798dd5a470e927fa")
+	data := []byte("data")
+
+	ch := swarm.NewChunk(addr, data)
+	if got := ch.TagID(); got != 0 {
+		t.Fatalf("got tag id %d, want 0", got)
+	}
+
+	ch = ch.WithTagID(42)
+	if got := ch.TagID(); got != 42 {
+		t.Fatalf("got tag id %d, want 42", got)
+	}
+	if !ch.Address().Equal(addr) {
+		t.Fatalf("got address %s, want %s", ch.Address(), addr)
+	}
+	if !bytes.Equal(ch.Data(), data) {
+		t.Fatalf("got data %q, want %q", ch.Data(), data)
+	}
+	if !ch.Equal(swarm.NewChunk(addr, data)) {
+		t.Fatal("chunk with tag id is not equal to the chunk without it")
+	}
+}
+
+func TestChunk_Clone(t *testing.T) {
+	addr := swarm.MustParseHexAddress("24798dd5a470e927fa")
+	data := []byte("data")
+
+	ch := swarm.NewChunk(addr, data).WithTagID(42).WithBatch(1, 2)
+	clone := ch.Clone()
+	if !clone.Equal(ch) {
+		t.Fatal("clone is not equal to the chunk")
+	}
+	if clone.TagID() != 42 || clone.Radius() != 1 || clone.Depth() != 2 {
+		t.Fatalf("got tag id %d, radius %d, depth %d, want 42, 1, 2", clone.TagID(), clone.Radius(), clone.Depth())
+	}
+
+	clone.Data()[0] = 'D'
+	clone.Address().Bytes()[0] = 0
+	if !bytes.Equal(ch.Data(), []byte("data")) {
+		t.Fatalf("got data %q after changing the clone, want %q", ch.Data(), "data")
+	}
+	if !ch.Address().Equal(swarm.MustParseHexAddress("24798dd5a470e927fa")) {
+		t.Fatalf("got address %s after changing the clone, want %s", ch.Address(), "24798dd5a470e927fa")
+	}
+}
@@ -0,0 +1,65 @@
+// Copyright 2021 The Swarm Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package swarm
+
+import "errors"
+
+// ErrUnknownChunkType is returned if the chunk is not valid for any of the
+// registered chunk types.
+var ErrUnknownChunkType = errors.New("unknown chunk type")
+
+// ChunkType identifies a kind of chunk, like content-addressed or
+// single-owner chunk.
+type ChunkType byte
+
+const (
+	ChunkTypeContentAddressed ChunkType = iota + 1
+	ChunkTypeSingleOwner
+)
+
+// ValidatorFunc checks if the chunk is a valid chunk of a chunk type.
+type ValidatorFunc func(Chunk) bool
+
+// Validators is a registry of the validators of chunk types. As the type of
+// a chunk is not encoded in its data, the validators are tried in the order
+// in which they are added.
+type Validators struct {
+	types      []ChunkType
+	validators map[ChunkType]ValidatorFunc
+}
+
+// NewValidators creates an empty validators registry.
+func NewValidators() *Validators {
+	return &Validators{
+		validators: make(map[ChunkType]ValidatorFunc),
+	}
+}
+
+// Add registers the validator for the chunk type, replacing the validator
+// previously registered for the same type.
+func (v *Validators) Add(t ChunkType, f ValidatorFunc) {
+	if _, ok := v.validators[t]; !ok {
+		v.types = append(v.types, t)
+	}
+	v.validators[t] = f
+}
+
+// Type returns the type of the first registered validator that accepts the
+// chunk or ErrUnknownChunkType if there is none.
+func (v *Validators) Type(ch Chunk) (ChunkType, error) {
+	for _, t := range v.types {
+		if v.validators[t](ch) {
+			return t, nil
+		}
+	}
+	return 0, ErrUnknownChunkType
+}
+
+// Validate returns ErrUnknownChunkType if the chunk is not valid for any
+// of the registered chunk types.
+func (v *Validators) Validate(ch Chunk) error {
+	_, err := v.Type(ch)
+	return err
+}
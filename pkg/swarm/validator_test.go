@@ -0,0 +1,61 @@
+// Copyright 2021 The Swarm Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package swarm_test
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/ethersphere/bee/pkg/swarm"
+)
+
+func TestValidators(t *testing.T) {
+	v := swarm.NewValidators()
+	v.Add(swarm.ChunkTypeContentAddressed, func(ch swarm.Chunk) bool {
+		return string(ch.Data()) == "content"
+	})
+	v.Add(swarm.ChunkTypeSingleOwner, func(ch swarm.Chunk) bool {
+		return string(ch.Data()) == "soc"
+	})
+
+	for _, tc := range []struct {
+		name     string
+		data     string
+		wantType swarm.ChunkType
+		wantErr  error
+	}{
+		{
+			name:     "content addressed",
+			data:     "content",
+			wantType: swarm.ChunkTypeContentAddressed,
+		},
+		{
+			name:     "single owner",
+			data:     "soc",
+			wantType: swarm.ChunkTypeSingleOwner,
+		},
+		{
+			name:    "unknown",
+			data:    "unknown",
+			wantErr: swarm.ErrUnknownChunkType,
+		},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			ch := swarm.NewChunk(swarm.ZeroAddress, []byte(tc.data))
+
+			typ, err := v.Type(ch)
+			if !errors.Is(err, tc.wantErr) {
+				t.Fatalf("got error %v, want %v", err, tc.wantErr)
+			}
+			if typ != tc.wantType {
+				t.Fatalf("got type %v, want %v", typ, tc.wantType)
+			}
+
+			if err := v.Validate(ch); !errors.Is(err, tc.wantErr) {
+				t.Fatalf("got validate error %v, want %v", err, tc.wantErr)
+			}
+		})
+	}
+}
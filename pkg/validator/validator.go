@@ -0,0 +1,32 @@
+// Copyright 2021 The Swarm Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+// Package validator provides the registry of validators for all
+// chunk types supported by the node.
+package validator
+
+import (
+	"github.com/ethersphere/bee/pkg/cac"
+	"github.com/ethersphere/bee/pkg/soc"
+	"github.com/ethersphere/bee/pkg/swarm"
+)
+
+// New returns the validators registry with the content-addressed and
+// single-owner chunk validators.
+func New() *swarm.Validators {
+	v := swarm.NewValidators()
+	v.Add(swarm.ChunkTypeContentAddressed, cac.Valid)
+	v.Add(swarm.ChunkTypeSingleOwner, soc.Valid)
+	return v
+}
+
+// defaultValidators is the registry used by ChunkType.
+var defaultValidators = New()
+
+// ChunkType returns the type of the chunk, classified by the validators
+// returned by New, or swarm.ErrUnknownChunkType if the chunk is neither a
+// valid content-addressed nor a valid single-owner chunk.
+func ChunkType(ch swarm.Chunk) (swarm.ChunkType, error) {
+	return defaultValidators.Type(ch)
+}
@@ -0,0 +1,67 @@
+// Copyright 2021 The Swarm Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package validator_test
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/ethersphere/bee/pkg/cac"
+	soctesting "github.com/ethersphere/bee/pkg/soc/testing"
+	"github.com/ethersphere/bee/pkg/swarm"
+	"github.com/ethersphere/bee/pkg/validator"
+)
+
+func TestValidator(t *testing.T) {
+	v := validator.New()
+
+	contentChunk, err := cac.New([]byte("foo"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	socChunk := soctesting.GenerateMockSOC(t, []byte("foo")).Chunk()
+
+	for _, tc := range []struct {
+		name     string
+		chunk    swarm.Chunk
+		wantType swarm.ChunkType
+		wantErr  error
+	}{
+		{
+			name:     "content addressed",
+			chunk:    contentChunk,
+			wantType: swarm.ChunkTypeContentAddressed,
+		},
+		{
+			name:     "single owner",
+			chunk:    socChunk,
+			wantType: swarm.ChunkTypeSingleOwner,
+		},
+		{
+			name:    "unknown",
+			chunk:   swarm.NewChunk(swarm.MustParseHexAddress("0000e8e7d8a48c2a9339c97c1dc3461a9a7aa07e994c5cb8b38fd7c1b3e6ea48"), contentChunk.Data()),
+			wantErr: swarm.ErrUnknownChunkType,
+		},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			typ, err := v.Type(tc.chunk)
+			if !errors.Is(err, tc.wantErr) {
+				t.Fatalf("got error %v, want %v", err, tc.wantErr)
+			}
+			if typ != tc.wantType {
+				t.Fatalf("got type %v, want %v", typ, tc.wantType)
+			}
+
+			typ, err = validator.ChunkType(tc.chunk)
+			if !errors.Is(err, tc.wantErr) {
+				t.Fatalf("got error %v, want %v", err, tc.wantErr)
+			}
+			if typ != tc.wantType {
+				t.Fatalf("got type %v, want %v", typ, tc.wantType)
+			}
+		})
+	}
+}